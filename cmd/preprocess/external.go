@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+)
+
+// codeOverhead approximates the per-code memory cost beyond its bytes: the
+// string header plus its slot in the chunk slice.
+const codeOverhead = 32
+
+// run is one sorted, de-duplicated chunk of a single input file on disk.
+type run struct {
+	path string
+	file int
+}
+
+// processExternal is the bounded-memory counterpart of processInMemory. Each
+// input is cut into chunks of roughly budget bytes, which are sorted,
+// de-duplicated and spilled to temporary run files; a k-way merge over all
+// runs then counts in how many distinct inputs each code appears. Up to
+// sel.workers inputs are spilled at once, each with an equal share of the
+// budget.
+func processExternal(files []input, sel selection, budget int64, tmpDir string, rep *report, emit func(string, domain.CouponValidity) error) error {
+	dir, err := os.MkdirTemp(tmpDir, "preprocess-*")
+	if err != nil {
+		return fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	workers := min(sel.workers, len(files))
+	share := max(budget/int64(workers), 1)
+
+	perFile := make([][]run, len(files))
+	err = rep.stage("ingest", func() error {
+		var g errgroup.Group
+		g.SetLimit(workers)
+		for i, f := range files {
+			g.Go(func() error {
+				log.Printf("Sorting %s...", f.name)
+				var err error
+				perFile[i], err = spillRuns(f, i, sel, share, dir, rep)
+				return err
+			})
+		}
+		return g.Wait()
+	})
+	if err != nil {
+		return err
+	}
+
+	var runs []run
+	for _, fileRuns := range perFile {
+		runs = append(runs, fileRuns...)
+	}
+
+	log.Printf("Merging %d sorted runs...", len(runs))
+	return rep.stage("merge", func() error {
+		return mergeRuns(runs, len(files), sel, rep, emit)
+	})
+}
+
+func spillRuns(in input, fileIdx int, sel selection, budget int64, dir string, rep *report) ([]run, error) {
+	file, err := in.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	buf := make([]byte, 0, 1024*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	var runs []run
+	var chunk []string
+	var size int64
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%d-%d.run", fileIdx, len(runs)))
+		if err := writeRun(path, chunk); err != nil {
+			return err
+		}
+		runs = append(runs, run{path: path, file: fileIdx})
+		chunk = chunk[:0]
+		size = 0
+		return nil
+	}
+
+	for scanner.Scan() {
+		raw, validity, err := parseLine(scanner.Bytes())
+		if err != nil {
+			rep.malformed(fileIdx)
+			continue
+		}
+		code := string(raw)
+		if !rep.line(fileIdx, sel, code) {
+			continue
+		}
+		if !validity.IsZero() {
+			rep.Files[fileIdx].WithValidity++
+		}
+		line := encodeRunLine(code, validity)
+		chunk = append(chunk, line)
+		size += int64(len(line)) + codeOverhead
+		if size >= budget {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", in.name, err)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// writeRun sorts the encoded lines of chunk and writes each code once, with
+// the validity of its listings narrowed into one period.
+func writeRun(path string, chunk []string) error {
+	slices.Sort(chunk)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating run: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for i := 0; i < len(chunk); {
+		code, validity := decodeRunLine(chunk[i])
+		for i++; i < len(chunk); i++ {
+			next, v := decodeRunLine(chunk[i])
+			if next != code {
+				break
+			}
+			validity = narrow(validity, v)
+		}
+		w.WriteString(encodeRunLine(code, validity))
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("writing run: %w", err)
+	}
+	return f.Close()
+}
+
+type runReader struct {
+	scanner  *bufio.Scanner
+	file     *os.File
+	input    int
+	code     string
+	validity domain.CouponValidity
+}
+
+func (r *runReader) next() (bool, error) {
+	if r.scanner.Scan() {
+		r.code, r.validity = decodeRunLine(r.scanner.Text())
+		return true, nil
+	}
+	return false, r.scanner.Err()
+}
+
+// runHeap orders run readers by their current code.
+type runHeap []*runReader
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return h[i].code < h[j].code }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+func mergeRuns(runs []run, inputs int, sel selection, rep *report, emit func(string, domain.CouponValidity) error) error {
+	h := make(runHeap, 0, len(runs))
+	defer func() {
+		for _, r := range h {
+			r.file.Close()
+		}
+	}()
+
+	for _, rn := range runs {
+		f, err := os.Open(rn.path)
+		if err != nil {
+			return fmt.Errorf("opening run: %w", err)
+		}
+		r := &runReader{scanner: bufio.NewScanner(f), file: f, input: rn.file}
+		ok, err := r.next()
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("reading run: %w", err)
+		}
+		if !ok {
+			f.Close()
+			continue
+		}
+		h = append(h, r)
+	}
+	heap.Init(&h)
+
+	// seen[i] == gen marks input i as already counted for the current code,
+	// so a code repeated across runs of the same input counts once.
+	seen := make([]int, inputs)
+	gen := 0
+	var found []int
+
+	for h.Len() > 0 {
+		code := h[0].code
+		var validity domain.CouponValidity
+		gen++
+		found = found[:0]
+
+		for h.Len() > 0 && h[0].code == code {
+			r := h[0]
+			validity = narrow(validity, r.validity)
+			if seen[r.input] != gen {
+				seen[r.input] = gen
+				found = append(found, r.input)
+			}
+
+			ok, err := r.next()
+			if err != nil {
+				return fmt.Errorf("reading run: %w", err)
+			}
+			if ok {
+				heap.Fix(&h, 0)
+			} else {
+				r.file.Close()
+				heap.Pop(&h)
+			}
+		}
+
+		if rep.code(sel, found) {
+			if err := emit(code, validity); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseSize parses a byte count with an optional KB/MB/GB (powers of 1024)
+// suffix, returning def for an empty string.
+func parseSize(s string, def int64) (int64, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	mult := int64(1)
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix))
+			mult = unit.mult
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q is not a positive size", s)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// input is one list of codes. Plain, gzip and zstd files are streamed from
+// disk each time they are opened; members of tar archives are extracted to
+// temporary files first, since an archive can only be read front to back.
+type input struct {
+	name string
+	open func() (io.ReadCloser, error)
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// resolveInputs expands COUPON_FILES entries into inputs. Compression is
+// detected from magic bytes rather than the extension; "-" reads stdin and
+// may appear at most once. Tar members are extracted to a directory under
+// tmpRoot, which cleanup removes.
+func resolveInputs(specs []string, tmpRoot string) (inputs []input, cleanup func(), err error) {
+	var tmpDir string
+	cleanup = func() {
+		if tmpDir != "" {
+			os.RemoveAll(tmpDir)
+		}
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	stdinUsed := false
+
+	for _, spec := range specs {
+		var src io.ReadCloser
+		if spec == "-" {
+			if stdinUsed {
+				return nil, nil, errors.New("stdin (-) can only be listed once")
+			}
+			stdinUsed = true
+			src = os.Stdin
+		} else {
+			f, err := os.Open(spec)
+			if err != nil {
+				return nil, nil, fmt.Errorf("opening %s: %w", spec, err)
+			}
+			src = f
+		}
+
+		r, err := decompress(src)
+		if err != nil {
+			src.Close()
+			return nil, nil, fmt.Errorf("reading %s: %w", spec, err)
+		}
+
+		if isTar(r) {
+			if tmpDir == "" {
+				if tmpDir, err = os.MkdirTemp(tmpRoot, "preprocess-inputs-*"); err != nil {
+					r.Close()
+					return nil, nil, fmt.Errorf("creating temp dir: %w", err)
+				}
+			}
+			members, err := extractTar(spec, r, tmpDir, len(inputs))
+			r.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			inputs = append(inputs, members...)
+			continue
+		}
+
+		if spec == "-" {
+			// stdin cannot be reopened, so hand out the stream we have.
+			inputs = append(inputs, input{name: "-", open: once(r)})
+			continue
+		}
+
+		r.Close()
+		path := spec
+		inputs = append(inputs, input{name: spec, open: func() (io.ReadCloser, error) {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("opening %s: %w", path, err)
+			}
+			return decompress(f)
+		}})
+	}
+	return inputs, cleanup, nil
+}
+
+// peekReader is a buffered, possibly decompressing, view of a source that
+// closes every layer.
+type peekReader struct {
+	*bufio.Reader
+	closers []func() error
+}
+
+func (r *peekReader) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		err = errors.Join(err, r.closers[i]())
+	}
+	return err
+}
+
+// decompress wraps src in a gzip or zstd reader if it starts with the
+// matching magic bytes. The result takes ownership of src.
+func decompress(src io.ReadCloser) (*peekReader, error) {
+	br := bufio.NewReaderSize(src, 64*1024)
+	r := &peekReader{closers: []func() error{src.Close}}
+
+	head, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		r.closers = append(r.closers, gz.Close)
+		r.Reader = bufio.NewReaderSize(gz, 64*1024)
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		r.closers = append(r.closers, func() error { zr.Close(); return nil })
+		r.Reader = bufio.NewReaderSize(zr, 64*1024)
+	default:
+		r.Reader = br
+	}
+	return r, nil
+}
+
+// isTar reports whether r starts with a POSIX or GNU tar header.
+func isTar(r *peekReader) bool {
+	head, err := r.Peek(263)
+	return err == nil && bytes.HasPrefix(head[257:], []byte("ustar"))
+}
+
+// extractTar writes every regular file in the archive to tmpDir and returns
+// one input per member, named "<archive>:<member>".
+func extractTar(name string, r io.Reader, tmpDir string, seq int) ([]input, error) {
+	var inputs []input
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return inputs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		path := filepath.Join(tmpDir, "member-"+strconv.Itoa(seq+len(inputs)))
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("extracting %s: %w", name, err)
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("extracting %s:%s: %w", name, hdr.Name, err)
+		}
+
+		inputs = append(inputs, input{name: name + ":" + hdr.Name, open: func() (io.ReadCloser, error) {
+			// Members may themselves be compressed.
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			return decompress(f)
+		}})
+	}
+}
+
+// once returns an opener that yields r the first time and fails afterwards.
+func once(r io.ReadCloser) func() (io.ReadCloser, error) {
+	used := false
+	return func() (io.ReadCloser, error) {
+		if used {
+			return nil, errors.New("stdin already consumed")
+		}
+		used = true
+		return r, nil
+	}
+}
@@ -2,18 +2,151 @@ package main
 
 import (
 	"bufio"
+	"container/heap"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"hash/maphash"
 	"log"
+	"math"
 	"math/bits"
 	"os"
-	"sort"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Sanjaiy/foodieapp/internal/database"
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
+	pgstore "github.com/Sanjaiy/foodieapp/internal/store/postgres"
 )
 
-func process(filename string, bit uint8, store map[string]uint8) error {
-	file, err := os.Open(filename)
+// selection decides which codes make it into the output: codes that pass
+// rules and appear in at least minFiles of the inputs. workers is the
+// concurrency used to get there.
+type selection struct {
+	rules    helpers.CodeRules
+	minFiles int
+	workers  int
+}
+
+// fileSet records which inputs a code appeared in. The first 64 inputs live
+// in lo so the common case needs no allocation.
+type fileSet struct {
+	lo uint64
+	hi []uint64
+}
+
+func (s *fileSet) add(i int) {
+	if i < 64 {
+		s.lo |= 1 << uint(i)
+		return
+	}
+	w := i/64 - 1
+	for len(s.hi) <= w {
+		s.hi = append(s.hi, 0)
+	}
+	s.hi[w] |= 1 << uint(i%64)
+}
+
+// appendTo appends the members of s to dst in ascending order.
+func (s fileSet) appendTo(dst []int) []int {
+	for w, word := range append([]uint64{s.lo}, s.hi...) {
+		for word != 0 {
+			dst = append(dst, w*64+bits.TrailingZeros64(word))
+			word &= word - 1
+		}
+	}
+	return dst
+}
+
+func (s fileSet) count() int {
+	n := bits.OnesCount64(s.lo)
+	for _, w := range s.hi {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// shardedStore maps each accepted code to the inputs it appeared in. Codes
+// are spread over independently locked shards by hash so that concurrent
+// readers rarely contend, and each shard can be scanned on its own later.
+type shardedStore struct {
+	seed   maphash.Seed
+	shards []storeShard
+}
+
+type storeShard struct {
+	mu    sync.Mutex
+	codes map[string]fileSet
+	// validity holds the narrowed period of codes listed with one.
+	validity map[string]domain.CouponValidity
+}
+
+// dated is a code listed with a validity period.
+type dated struct {
+	code     string
+	validity domain.CouponValidity
+}
+
+// insertBatch is how many codes a reader buffers per shard before taking
+// the shard lock.
+const insertBatch = 256
+
+func newShardedStore(n int) *shardedStore {
+	s := &shardedStore{seed: maphash.MakeSeed(), shards: make([]storeShard, n)}
+	for i := range s.shards {
+		s.shards[i].codes = make(map[string]fileSet)
+		s.shards[i].validity = make(map[string]domain.CouponValidity)
+	}
+	return s
+}
+
+func (s *shardedStore) shardOf(code []byte) int {
+	return int(maphash.Bytes(s.seed, code) % uint64(len(s.shards)))
+}
+
+func (s *shardedStore) add(shard, idx int, codes []string) {
+	sh := &s.shards[shard]
+	sh.mu.Lock()
+	for _, code := range codes {
+		set := sh.codes[code]
+		set.add(idx)
+		sh.codes[code] = set
+	}
+	sh.mu.Unlock()
+}
+
+func (s *shardedStore) addValidity(shard int, codes []dated) {
+	sh := &s.shards[shard]
+	sh.mu.Lock()
+	for _, d := range codes {
+		if v, ok := sh.validity[d.code]; ok {
+			d.validity = narrow(v, d.validity)
+		}
+		sh.validity[d.code] = d.validity
+	}
+	sh.mu.Unlock()
+}
+
+// validity returns the period of code once ingestion has finished.
+func (s *shardedStore) validity(code string) domain.CouponValidity {
+	return s.shards[s.shardOf([]byte(code))].validity[code]
+}
+
+// process reads one input into store. It only touches rep.Files[idx], so
+// inputs can be processed concurrently.
+func process(in input, idx int, sel selection, store *shardedStore, rep *report) error {
+	file, err := in.open()
 	if err != nil {
-		return fmt.Errorf("opening %s: %w", filename, err)
+		return err
 	}
 	defer file.Close()
 
@@ -21,17 +154,57 @@ func process(filename string, bit uint8, store map[string]uint8) error {
 	buf := make([]byte, 0, 1024*1024)
 	scanner.Buffer(buf, 1024*1024)
 
+	batches := make([][]string, len(store.shards))
+	datedBatches := make([][]dated, len(store.shards))
 	for scanner.Scan() {
-		code := scanner.Text()
-		if len(code) >= 8 && len(code) <= 10 {
-			store[code] |= bit
+		code, validity, err := parseLine(scanner.Bytes())
+		if err != nil {
+			rep.malformed(idx)
+			continue
+		}
+		if !rep.line(idx, sel, string(code)) {
+			continue
+		}
+		shard := store.shardOf(code)
+		batches[shard] = append(batches[shard], string(code))
+		if len(batches[shard]) == insertBatch {
+			store.add(shard, idx, batches[shard])
+			batches[shard] = batches[shard][:0]
+		}
+		if !validity.IsZero() {
+			rep.Files[idx].WithValidity++
+			datedBatches[shard] = append(datedBatches[shard], dated{string(code), validity})
+			if len(datedBatches[shard]) == insertBatch {
+				store.addValidity(shard, datedBatches[shard])
+				datedBatches[shard] = datedBatches[shard][:0]
+			}
 		}
 	}
+	for shard, batch := range batches {
+		store.add(shard, idx, batch)
+		store.addValidity(shard, datedBatches[shard])
+	}
 
-	return scanner.Err()
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", in.name, err)
+	}
+	return nil
 }
 
 func main() {
+	// -target=postgres loads the codes into the coupon_codes table used by
+	// COUPON_STORE=postgres, in the database at DATABASE_URL, instead of
+	// writing OUTPUT_PATH.
+	target := flag.String("target", getEnv("PREPROCESS_TARGET", "file"), "where to write valid codes: file or postgres")
+	flag.Parse()
+	if *target != "file" && *target != "postgres" {
+		log.Fatalf("Unknown target %q: must be file or postgres", *target)
+	}
+	databaseURL := os.Getenv("DATABASE_URL")
+	if *target == "postgres" && databaseURL == "" {
+		log.Fatalf("DATABASE_URL is required for target postgres")
+	}
+
 	couponFiles := os.Getenv("COUPON_FILES")
 	if couponFiles == "" {
 		couponFiles = "data/coupon1.txt,data/coupon2.txt,data/coupon3.txt"
@@ -43,39 +216,396 @@ func main() {
 		outputPath = "data/valid_codes.txt"
 	}
 
-	store := make(map[string]uint8, 1000)
+	reportPath := os.Getenv("REPORT_PATH")
+	if reportPath == "" {
+		reportPath = outputPath + ".report.json"
+	}
+
+	// OUTPUT_FORMAT=binary writes the fixed-width index read by
+	// helpers.CouponLookup instead of one code per line.
+	outputFormat := os.Getenv("OUTPUT_FORMAT")
+	if outputFormat == "" {
+		outputFormat = "text"
+	}
+	if outputFormat != "text" && outputFormat != "binary" {
+		log.Fatalf("Unknown OUTPUT_FORMAT %q: must be text or binary", outputFormat)
+	}
+
+	// PREPROCESS_MODE=external sorts each input in chunks of at most
+	// MEMORY_BUDGET bytes on disk and merges them, for inputs that do not
+	// fit in memory.
+	mode := os.Getenv("PREPROCESS_MODE")
+	if mode == "" {
+		mode = "memory"
+	}
+	budget, err := parseSize(os.Getenv("MEMORY_BUDGET"), 256<<20)
+	if err != nil {
+		log.Fatalf("Invalid MEMORY_BUDGET: %v", err)
+	}
+
+	// WORKERS bounds how many inputs are read at once and how many shards
+	// are merged in parallel. The output does not depend on it.
+	workers := runtime.GOMAXPROCS(0)
+	if v := os.Getenv("WORKERS"); v != "" {
+		if workers, err = strconv.Atoi(v); err != nil || workers < 1 {
+			log.Fatalf("Invalid WORKERS %q: must be a positive integer", v)
+		}
+	}
+
+	// FILTER_FPR is the false-positive rate of the Bloom filter written next
+	// to OUTPUT_PATH, which lets the API server reject most unknown codes
+	// without searching the file. 0 writes no filter.
+	filterFPR := helpers.DefaultCouponFilterFPR
+	if v := os.Getenv("FILTER_FPR"); v != "" {
+		if filterFPR, err = strconv.ParseFloat(v, 64); err != nil || filterFPR < 0 || filterFPR >= 1 {
+			log.Fatalf("Invalid FILTER_FPR %q: must be 0 or in (0, 1)", v)
+		}
+	}
+
+	// Length and pattern rules are shared with the API server's lookup.
+	rules, err := helpers.CodeRulesFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid code rules: %v", err)
+	}
+
+	start := time.Now()
+	inputs, cleanup, err := resolveInputs(files, os.Getenv("SORT_TMP_DIR"))
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	// log.Fatalf skips deferred calls, so extracted archives are removed
+	// explicitly on every exit path.
+	fatalf := func(format string, v ...any) {
+		cleanup()
+		log.Fatalf(format, v...)
+	}
+
+	minFiles, err := parseThreshold(os.Getenv("MIN_FILES"), len(inputs))
+	if err != nil {
+		fatalf("Invalid MIN_FILES: %v", err)
+	}
+	sel := selection{rules: rules, minFiles: minFiles, workers: workers}
+
+	rep := newReport(inputs)
+	rep.Output, rep.Format, rep.Mode = outputPath, outputFormat, mode
+	rep.Rules = reportRules{MinLength: rules.MinLength, MaxLength: rules.MaxLength, MinFiles: minFiles}
+	if rules.Pattern != nil {
+		rep.Rules.Pattern = os.Getenv("COUPON_PATTERN")
+	}
+
+	fill := func(w codeWriter) error {
+		switch mode {
+		case "memory":
+			return processInMemory(inputs, sel, rep, w.WriteValidity)
+		case "external":
+			return processExternal(inputs, sel, budget, os.Getenv("SORT_TMP_DIR"), rep, w.WriteValidity)
+		default:
+			return fmt.Errorf("unknown PREPROCESS_MODE %q: must be memory or external", mode)
+		}
+	}
+
+	destination := outputPath
+	if *target == "postgres" {
+		destination = "coupon_codes"
+		rep.Output, rep.Format = destination, "postgres"
+		err = loadCodes(context.Background(), databaseURL, rules, fill)
+	} else {
+		rep.Filter, err = writeCodes(outputPath, outputFormat, rules.MaxLength, rep.hasValidity, filterFPR, fill)
+	}
+	if err != nil {
+		fatalf("Error: %v", err)
+	}
+	cleanup()
+
+	rep.finish(time.Since(start))
+	if err := rep.write(reportPath); err != nil {
+		log.Fatalf("Error writing report: %v", err)
+	}
+
+	if f := rep.Filter; f != nil {
+		log.Printf("Filter written to %s: %d bits, %d hashes, expected false-positive rate %.4f", f.Path, f.Bits, f.Hashes, f.ExpectedFPR)
+	}
+	log.Printf("Done. %d valid codes written to %s (report: %s)", rep.Valid, destination, reportPath)
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// parseThreshold turns MIN_FILES into an absolute file count. An integer is
+// taken as is; a decimal ("0.5") or percentage ("50%") is a fraction of the
+// number of inputs, rounded up. The default is 2.
+func parseThreshold(s string, files int) (int, error) {
+	if s == "" {
+		s = "2"
+	}
+
+	var n int
+	if strings.ContainsAny(s, ".%") {
+		frac, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", s)
+		}
+		if strings.HasSuffix(s, "%") {
+			frac /= 100
+		}
+		if frac <= 0 || frac > 1 {
+			return 0, fmt.Errorf("fraction %q must be in (0, 1]", s)
+		}
+		n = int(math.Ceil(frac * float64(files)))
+	} else {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil {
+			return 0, fmt.Errorf("%q is not a number", s)
+		}
+	}
 
-	for i, f := range files {
-		log.Printf("Processing %s...", f)
-		if err := process(f, 1<<uint(i), store); err != nil {
-			log.Fatalf("Error processing %s: %v", f, err)
+	if n < 1 || n > files {
+		return 0, fmt.Errorf("%q requires %d of %d files", s, n, files)
+	}
+	return n, nil
+}
+
+// processInMemory reads up to sel.workers inputs concurrently into one
+// sharded store, then selects and sorts each shard in parallel and merges
+// the sorted shards. The output is the same for any worker count.
+func processInMemory(files []input, sel selection, rep *report, emit func(string, domain.CouponValidity) error) error {
+	store := newShardedStore(sel.workers * 4)
+
+	err := rep.stage("ingest", func() error {
+		var g errgroup.Group
+		g.SetLimit(sel.workers)
+		for i, f := range files {
+			g.Go(func() error {
+				log.Printf("Processing %s...", f.name)
+				return process(f, i, sel, store, rep)
+			})
 		}
+		return g.Wait()
+	})
+	if err != nil {
+		return err
 	}
 
 	var valid []string
-	for code, mask := range store {
-		if bits.OnesCount8(mask) >= 2 {
-			valid = append(valid, code)
+	rep.stage("select", func() error {
+		shardValid := make([][]string, len(store.shards))
+		shardReports := make([]*report, len(store.shards))
+
+		var g errgroup.Group
+		g.SetLimit(sel.workers)
+		for s := range store.shards {
+			g.Go(func() error {
+				part := newReport(files)
+				var inputs []int
+				for code, set := range store.shards[s].codes {
+					inputs = set.appendTo(inputs[:0])
+					if part.code(sel, inputs) {
+						shardValid[s] = append(shardValid[s], code)
+					}
+				}
+				store.shards[s].codes = nil
+				slices.Sort(shardValid[s])
+				shardReports[s] = part
+				return nil
+			})
+		}
+		g.Wait()
+
+		for _, part := range shardReports {
+			rep.merge(part)
+		}
+		valid = mergeSorted(shardValid)
+		return nil
+	})
+
+	dated := rep.hasValidity()
+	return rep.stage("write", func() error {
+		for _, code := range valid {
+			var validity domain.CouponValidity
+			if dated {
+				validity = store.validity(code)
+			}
+			if err := emit(code, validity); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// mergeSorted merges sorted, mutually disjoint lists into one sorted list.
+func mergeSorted(lists [][]string) []string {
+	n := 0
+	h := make(listHeap, 0, len(lists))
+	for _, l := range lists {
+		n += len(l)
+		if len(l) > 0 {
+			h = append(h, l)
+		}
+	}
+	heap.Init(&h)
+
+	out := make([]string, 0, n)
+	for h.Len() > 0 {
+		out = append(out, h[0][0])
+		if h[0] = h[0][1:]; len(h[0]) > 0 {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return out
+}
+
+// listHeap orders non-empty sorted lists by their first element.
+type listHeap [][]string
+
+func (h listHeap) Len() int           { return len(h) }
+func (h listHeap) Less(i, j int) bool { return h[i][0] < h[j][0] }
+func (h listHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *listHeap) Push(x any)        { *h = append(*h, x.([]string)) }
+func (h *listHeap) Pop() any {
+	old := *h
+	l := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return l
+}
+
+// codeWriter receives the valid codes in sorted order.
+type codeWriter interface {
+	WriteValidity(code string, v domain.CouponValidity) error
+	Close() error
+}
+
+type textWriter struct {
+	buf *bufio.Writer
+}
+
+func (w *textWriter) WriteValidity(code string, v domain.CouponValidity) error {
+	w.buf.WriteString(helpers.FormatCouponLine(code, v))
+	return w.buf.WriteByte('\n')
+}
+
+// indexWriter picks the binary index version when the first code arrives,
+// by which time every input has been read and dated tells whether any code
+// has a validity period. Plain code lists keep the smaller version 1.
+type indexWriter struct {
+	out   *os.File
+	width int
+	dated func() bool
+	w     *helpers.CouponIndexWriter
+}
+
+func (w *indexWriter) WriteValidity(code string, v domain.CouponValidity) error {
+	if w.w == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	return w.w.WriteValidity(code, v)
+}
+
+func (w *indexWriter) open() error {
+	var err error
+	if w.dated() {
+		w.w, err = helpers.NewCouponIndexWriterWithValidity(w.out, w.width)
+	} else {
+		w.w, err = helpers.NewCouponIndexWriter(w.out, w.width)
+	}
+	return err
+}
+
+func (w *indexWriter) Close() error {
+	if w.w == nil {
+		if err := w.open(); err != nil {
+			return err
 		}
 	}
+	return w.w.Close()
+}
 
-	sort.Strings(valid)
+func (w *textWriter) Close() error {
+	return w.buf.Flush()
+}
 
-	out, err := os.Create(outputPath)
+// writeCodes writes to a temporary file in the output directory and renames
+// it into place. The API server keeps the previous file mmapped; truncating
+// it in place would make those pages vanish underneath it (SIGBUS), whereas
+// a rename leaves the old inode intact until the server unmaps it.
+//
+// With a positive filterFPR the filter is built from the temporary file and
+// renamed into place first. Until the codes follow, the server ignores it as
+// belonging to another file.
+func writeCodes(outputPath, format string, width int, dated func() bool, filterFPR float64, fill func(codeWriter) error) (*helpers.CouponFilterInfo, error) {
+	out, err := os.CreateTemp(filepath.Dir(outputPath), filepath.Base(outputPath)+".tmp*")
 	if err != nil {
-		log.Fatalf("Error creating output file: %v", err)
+		return nil, err
+	}
+	defer os.Remove(out.Name())
+
+	var w codeWriter = &textWriter{buf: bufio.NewWriter(out)}
+	if format == "binary" {
+		w = &indexWriter{out: out, width: width, dated: dated}
+	}
+
+	if err := fill(w); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		out.Close()
+		return nil, err
+	}
+
+	if err := out.Chmod(0o644); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
 	}
-	defer out.Close()
 
-	writer := bufio.NewWriter(out)
-	for i, code := range valid {
-		if i > 0 {
-			writer.WriteByte('\n')
+	var filter *helpers.CouponFilterInfo
+	filterPath := helpers.CouponFilterPath(outputPath)
+	if filterFPR > 0 {
+		info, err := helpers.BuildCouponFilter(out.Name(), filterPath, filterFPR)
+		if err != nil {
+			return nil, fmt.Errorf("building filter: %w", err)
 		}
-		writer.WriteString(code)
+		filter = &info
+	} else if err := os.Remove(filterPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return filter, os.Rename(out.Name(), outputPath)
+}
+
+// loadCodes replaces the contents of the coupon_codes table of the database
+// at databaseURL in a single transaction.
+func loadCodes(ctx context.Context, databaseURL string, rules helpers.CodeRules, fill func(codeWriter) error) error {
+	dbConn, err := database.Connect(ctx, databaseURL)
+	if err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+	defer dbConn.Close()
+	if err := database.Migrate(dbConn); err != nil {
+		return fmt.Errorf("running migrations: %w", err)
 	}
-	writer.WriteByte('\n')
-	writer.Flush()
 
-	log.Printf("Done. %d valid codes written to %s", len(valid), outputPath)
+	load, err := pgstore.NewCouponStore(dbConn, rules).BeginLoad(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fill(load); err != nil {
+		load.Abort()
+		return err
+	}
+	if err := load.Close(); err != nil {
+		return err
+	}
+	log.Printf("coupon_codes updated: %d added, %d updated, %d removed", load.Added, load.Updated, load.Removed)
+	return nil
 }
@@ -1,10 +1,27 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
 )
 
 func TestPreprocessor(t *testing.T) {
@@ -59,3 +76,479 @@ func TestPreprocessor(t *testing.T) {
 		}
 	}
 }
+
+func TestPreprocessorBinaryOutput(t *testing.T) {
+	dir := t.TempDir()
+
+	os.WriteFile(dir+"/f1.txt", []byte("OVER9000\nGNULINUX\nJTK0BIW9\n"), 0644)
+	os.WriteFile(dir+"/f2.txt", []byte("OVER9000\nGNULINUX\nSIXTYOFF\n"), 0644)
+
+	outputPath := dir + "/valid_codes.idx"
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Env = append(os.Environ(),
+		"COUPON_FILES="+dir+"/f1.txt,"+dir+"/f2.txt",
+		"OUTPUT_PATH="+outputPath,
+		"OUTPUT_FORMAT=binary",
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("preprocessor failed: %v\noutput: %s", err, output)
+	}
+
+	lookup, err := helpers.NewCouponLookup(outputPath, helpers.DefaultCodeRules)
+	if err != nil {
+		t.Fatalf("failed to load binary output: %v", err)
+	}
+	defer lookup.Close()
+
+	if got := lookup.Status().Codes; got != 2 {
+		t.Errorf("expected 2 codes, got %d", got)
+	}
+	if !lookup.IsValid("OVER9000") || !lookup.IsValid("GNULINUX") || lookup.IsValid("SIXTYOFF") {
+		t.Error("unexpected lookup result for binary output")
+	}
+	if f := lookup.Status().Filter; f == nil || f.Codes != 2 || f.TargetFPR != helpers.DefaultCouponFilterFPR {
+		t.Errorf("expected default filter for binary output, got %+v", f)
+	}
+}
+
+func TestPreprocessorFilterDisabled(t *testing.T) {
+	dir := t.TempDir()
+
+	os.WriteFile(dir+"/f1.txt", []byte("OVER9000\nGNULINUX\n"), 0644)
+	os.WriteFile(dir+"/f2.txt", []byte("OVER9000\n"), 0644)
+
+	outputPath := dir + "/valid_codes.txt"
+	os.WriteFile(helpers.CouponFilterPath(outputPath), []byte("stale"), 0644)
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Env = append(os.Environ(),
+		"COUPON_FILES="+dir+"/f1.txt,"+dir+"/f2.txt",
+		"OUTPUT_PATH="+outputPath,
+		"FILTER_FPR=0",
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("preprocessor failed: %v\noutput: %s", err, output)
+	}
+	if _, err := os.Stat(helpers.CouponFilterPath(outputPath)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected stale filter to be removed, got %v", err)
+	}
+}
+
+func TestPreprocessorExternalMatchesMemory(t *testing.T) {
+	dir := t.TempDir()
+
+	// Repeat codes within a file so chunks of the same input overlap.
+	os.WriteFile(dir+"/f1.txt", []byte("OVER9000\nGNULINUX\nJTK0BIW9\nSHORT\nOVER9000\nZZZZZZZZ\n"), 0644)
+	os.WriteFile(dir+"/f2.txt", []byte("OVER9000\nGNULINUX\nSIXTYOFF\nGBR9297T\nJTK0BIW9\n"), 0644)
+	os.WriteFile(dir+"/f3.txt", []byte("OVER9000\nGBR9297T\nTOOLONGCODE12345\nZZZZZZZZ\nZZZZZZZZ\n"), 0644)
+	files := "COUPON_FILES=" + dir + "/f1.txt," + dir + "/f2.txt," + dir + "/f3.txt"
+
+	run := func(output string, extra ...string) []byte {
+		cmd := exec.Command("go", "run", ".")
+		cmd.Env = append(os.Environ(), append([]string{files, "OUTPUT_PATH=" + output}, extra...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("preprocessor failed: %v\noutput: %s", err, out)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		return data
+	}
+
+	memory := run(dir + "/memory.txt")
+	// A 64 byte budget spills a run for every code or two.
+	external := run(dir+"/external.txt", "PREPROCESS_MODE=external", "MEMORY_BUDGET=64", "SORT_TMP_DIR="+dir)
+
+	if string(memory) != string(external) {
+		t.Errorf("external output differs from memory output:\n%s\nvs\n%s", external, memory)
+	}
+	if want := "GBR9297T\nGNULINUX\nJTK0BIW9\nOVER9000\nZZZZZZZZ\n"; string(external) != want {
+		t.Errorf("unexpected output:\n%s", external)
+	}
+}
+
+func TestPreprocessorValidity(t *testing.T) {
+	dir := t.TempDir()
+
+	os.WriteFile(dir+"/f1.txt", []byte("OVER9000,2026-01-01,2026-03-01\nGNULINUX\nJTK0BIW9,2026-13-01,\nGBR9297T,,2026-06-01\n"), 0644)
+	os.WriteFile(dir+"/f2.txt", []byte("OVER9000,2026-02-01T10:00:00Z,\nGNULINUX\nJTK0BIW9\nGBR9297T,,2026-05-01\n"), 0644)
+	files := "COUPON_FILES=" + dir + "/f1.txt," + dir + "/f2.txt"
+
+	run := func(output string, extra ...string) {
+		cmd := exec.Command("go", "run", ".")
+		cmd.Env = append(os.Environ(), append([]string{files, "OUTPUT_PATH=" + output}, extra...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("preprocessor failed: %v\noutput: %s", err, out)
+		}
+	}
+
+	run(dir+"/memory.txt", "REPORT_PATH="+dir+"/report.json")
+	run(dir+"/external.txt", "PREPROCESS_MODE=external", "MEMORY_BUDGET=64", "SORT_TMP_DIR="+dir)
+	run(dir+"/codes.idx", "OUTPUT_FORMAT=binary")
+
+	memory, _ := os.ReadFile(dir + "/memory.txt")
+	external, _ := os.ReadFile(dir + "/external.txt")
+	// Listings of the same code narrow to the latest start and earliest end;
+	// the malformed JTK0BIW9 line does not count towards its threshold.
+	want := "GBR9297T,,2026-05-01T00:00:00Z\nGNULINUX\nOVER9000,2026-02-01T10:00:00Z,2026-03-01T00:00:00Z\n"
+	if string(memory) != want {
+		t.Errorf("unexpected memory output:\n%s", memory)
+	}
+	if string(external) != want {
+		t.Errorf("unexpected external output:\n%s", external)
+	}
+
+	var rep struct {
+		Files []struct {
+			RejectedFormat int `json:"rejectedFormat"`
+			WithValidity   int `json:"withValidity"`
+		} `json:"files"`
+		Rejected struct {
+			Format int `json:"format"`
+		} `json:"rejected"`
+	}
+	data, _ := os.ReadFile(dir + "/report.json")
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+	if rep.Files[0].RejectedFormat != 1 || rep.Files[0].WithValidity != 2 || rep.Files[1].WithValidity != 2 || rep.Rejected.Format != 1 {
+		t.Errorf("unexpected report %+v", rep)
+	}
+
+	lookup, err := helpers.NewCouponLookup(dir+"/codes.idx", helpers.DefaultCodeRules)
+	if err != nil {
+		t.Fatalf("failed to load binary output: %v", err)
+	}
+	defer lookup.Close()
+
+	v, rejection := lookup.Lookup("OVER9000")
+	if rejection != "" || !v.StartsAt.Equal(time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)) || !v.EndsAt.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected OVER9000 validity %+v (%q)", v, rejection)
+	}
+	if v, rejection := lookup.Lookup("GNULINUX"); rejection != "" || !v.IsZero() {
+		t.Errorf("expected GNULINUX valid forever, got %+v (%q)", v, rejection)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{"", 256 << 20, false},
+		{"1024", 1024, false},
+		{"64KB", 64 << 10, false},
+		{"512mb", 512 << 20, false},
+		{"2GB", 2 << 30, false},
+		{"0", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSize(tt.in, 256<<20)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d (err %v)", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestPreprocessorThresholdAndRules(t *testing.T) {
+	dir := t.TempDir()
+
+	// 10 inputs: more than the old 8-bit mask could hold. SHARED9X is in
+	// every file, HALFCODE in the last five, RARECODE only in the tenth.
+	var paths []string
+	for i := 0; i < 10; i++ {
+		lines := "SHARED9X\nlower123\nSEVEN77\n"
+		if i >= 5 {
+			lines += "HALFCODE\n"
+		}
+		if i == 9 {
+			lines += "RARECODE\n"
+		}
+		path := dir + "/f" + strconv.Itoa(i) + ".txt"
+		os.WriteFile(path, []byte(lines), 0644)
+		paths = append(paths, path)
+	}
+
+	for _, mode := range []string{"memory", "external"} {
+		outputPath := dir + "/" + mode + ".txt"
+		cmd := exec.Command("go", "run", ".")
+		cmd.Env = append(os.Environ(),
+			"COUPON_FILES="+strings.Join(paths, ","),
+			"OUTPUT_PATH="+outputPath,
+			"PREPROCESS_MODE="+mode,
+			"MIN_FILES=50%",
+			"COUPON_MIN_LENGTH=7",
+			"COUPON_PATTERN=[A-Z0-9]+",
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: preprocessor failed: %v\noutput: %s", mode, err, output)
+		}
+
+		data, _ := os.ReadFile(outputPath)
+		if want := "HALFCODE\nSEVEN77\nSHARED9X\n"; string(data) != want {
+			t.Errorf("%s: expected %q, got %q", mode, want, data)
+		}
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		in    string
+		files int
+		want  int
+		err   bool
+	}{
+		{"", 3, 2, false},
+		{"3", 3, 3, false},
+		{"0.5", 3, 2, false},
+		{"50%", 10, 5, false},
+		{"100%", 4, 4, false},
+		{"1.0", 4, 4, false},
+		{"4", 3, 0, true},
+		{"0", 3, 0, true},
+		{"150%", 3, 0, true},
+		{"half", 3, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseThreshold(tt.in, tt.files)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseThreshold(%q, %d) = %d, %v; want %d (err %v)", tt.in, tt.files, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestFileSet(t *testing.T) {
+	var s fileSet
+	for _, i := range []int{0, 3, 3, 63, 64, 200} {
+		s.add(i)
+	}
+	if got := s.count(); got != 5 {
+		t.Errorf("expected 5 files, got %d", got)
+	}
+	if got := s.appendTo(nil); !slices.Equal(got, []int{0, 3, 63, 64, 200}) {
+		t.Errorf("unexpected members %v", got)
+	}
+}
+
+func TestPreprocessorReport(t *testing.T) {
+	dir := t.TempDir()
+
+	os.WriteFile(dir+"/f1.txt", []byte("OVER9000\nGNULINUX\nJTK0BIW9\nSHORT\nOVER9000\n"), 0644)
+	os.WriteFile(dir+"/f2.txt", []byte("OVER9000\nGNULINUX\nSIXTYOFF\nGBR9297T\n"), 0644)
+	os.WriteFile(dir+"/f3.txt", []byte("OVER9000\nGBR9297T\nTOOLONGCODE12345\n"), 0644)
+
+	for _, mode := range []string{"memory", "external"} {
+		reportPath := dir + "/" + mode + ".json"
+		cmd := exec.Command("go", "run", ".")
+		cmd.Env = append(os.Environ(),
+			"COUPON_FILES="+dir+"/f1.txt,"+dir+"/f2.txt,"+dir+"/f3.txt",
+			"OUTPUT_PATH="+dir+"/"+mode+".txt",
+			"REPORT_PATH="+reportPath,
+			"PREPROCESS_MODE="+mode,
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: preprocessor failed: %v\noutput: %s", mode, err, output)
+		}
+
+		data, err := os.ReadFile(reportPath)
+		if err != nil {
+			t.Fatalf("%s: failed to read report: %v", mode, err)
+		}
+		var rep struct {
+			Files []struct {
+				Lines             int `json:"lines"`
+				RejectedLength    int `json:"rejectedLength"`
+				Unique            int `json:"unique"`
+				Duplicates        int `json:"duplicates"`
+				RejectedFrequency int `json:"rejectedFrequency"`
+			} `json:"files"`
+			Valid    int `json:"valid"`
+			Rejected struct {
+				Length    int `json:"length"`
+				Frequency int `json:"frequency"`
+			} `json:"rejected"`
+			Overlap [][]int `json:"overlap"`
+			Stages  []struct {
+				Name string `json:"name"`
+			} `json:"stages"`
+		}
+		if err := json.Unmarshal(data, &rep); err != nil {
+			t.Fatalf("%s: invalid report: %v", mode, err)
+		}
+
+		f1 := rep.Files[0]
+		if f1.Lines != 5 || f1.RejectedLength != 1 || f1.Unique != 3 || f1.Duplicates != 1 || f1.RejectedFrequency != 1 {
+			t.Errorf("%s: unexpected f1 stats %+v", mode, f1)
+		}
+		if rep.Valid != 3 || rep.Rejected.Length != 2 || rep.Rejected.Frequency != 2 {
+			t.Errorf("%s: unexpected totals valid=%d rejected=%+v", mode, rep.Valid, rep.Rejected)
+		}
+		want := [][]int{{3, 2, 1}, {2, 4, 2}, {1, 2, 2}}
+		for i := range want {
+			if !slices.Equal(rep.Overlap[i], want[i]) {
+				t.Errorf("%s: expected overlap %v, got %v", mode, want, rep.Overlap)
+				break
+			}
+		}
+		if len(rep.Stages) == 0 || rep.Stages[0].Name != "ingest" {
+			t.Errorf("%s: expected stage timings, got %+v", mode, rep.Stages)
+		}
+	}
+}
+
+// writeSyntheticInputs writes files inputs of lines random codes drawn from a
+// shared pool, so that a good share of codes appear in several files.
+func writeSyntheticInputs(tb testing.TB, dir string, files, lines int) []string {
+	tb.Helper()
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	pool := make([]string, lines)
+	for i := range pool {
+		b := make([]byte, 7+rng.IntN(5))
+		for j := range b {
+			b[j] = alphabet[rng.IntN(len(alphabet))]
+		}
+		pool[i] = string(b)
+	}
+
+	paths := make([]string, files)
+	for f := range paths {
+		var sb strings.Builder
+		for range lines {
+			sb.WriteString(pool[rng.IntN(len(pool))])
+			sb.WriteByte('\n')
+		}
+		paths[f] = filepath.Join(dir, "synthetic"+strconv.Itoa(f)+".txt")
+		if err := os.WriteFile(paths[f], []byte(sb.String()), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func runInMemory(tb testing.TB, files []string, workers int) []string {
+	tb.Helper()
+	inputs, cleanup, err := resolveInputs(files, "")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer cleanup()
+
+	sel := selection{rules: helpers.DefaultCodeRules, minFiles: 2, workers: workers}
+	var out []string
+	err = processInMemory(inputs, sel, newReport(inputs), func(code string, _ domain.CouponValidity) error {
+		out = append(out, code)
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return out
+}
+
+func TestProcessInMemoryWorkerCountIndependent(t *testing.T) {
+	files := writeSyntheticInputs(t, t.TempDir(), 4, 20000)
+
+	want := runInMemory(t, files, 1)
+	if !slices.IsSorted(want) || len(want) == 0 {
+		t.Fatalf("expected sorted non-empty output, got %d codes", len(want))
+	}
+	for _, workers := range []int{2, 3, 8} {
+		if got := runInMemory(t, files, workers); !slices.Equal(got, want) {
+			t.Errorf("workers=%d: output differs from workers=1 (%d vs %d codes)", workers, len(got), len(want))
+		}
+	}
+}
+
+func TestMergeSorted(t *testing.T) {
+	got := mergeSorted([][]string{{"B", "E"}, nil, {"A", "D", "F"}, {"C"}})
+	if want := []string{"A", "B", "C", "D", "E", "F"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// BenchmarkProcessInMemory reads 4 inputs of 1M lines each. Compare the
+// worker counts on a machine with at least 4 CPUs.
+func BenchmarkProcessInMemory(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	files := writeSyntheticInputs(b, b.TempDir(), 4, 1_000_000)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			for b.Loop() {
+				runInMemory(b, files, workers)
+			}
+		})
+	}
+}
+
+func TestPreprocessorCompressedAndArchiveInputs(t *testing.T) {
+	dir := t.TempDir()
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("OVER9000\nGNULINUX\nJTK0BIW9\nSHORT\n"))
+	gw.Close()
+	os.WriteFile(dir+"/f1.txt.gz", gz.Bytes(), 0644)
+
+	zw, _ := zstd.NewWriter(nil)
+	os.WriteFile(dir+"/f2.zst", zw.EncodeAll([]byte("OVER9000\nGNULINUX\nSIXTYOFF\nGBR9297T\n"), nil), 0644)
+
+	// A gzipped tar holding two more lists.
+	var tgz bytes.Buffer
+	tgw := gzip.NewWriter(&tgz)
+	tw := tar.NewWriter(tgw)
+	for name, body := range map[string]string{
+		"a.txt": "SIXTYOFF\nTARCODE1\n",
+		"b.txt": "TARCODE1\n",
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(body))
+	}
+	tw.Close()
+	tgw.Close()
+	os.WriteFile(dir+"/more.tar.gz", tgz.Bytes(), 0644)
+
+	outputPath := dir + "/valid_codes.txt"
+	cmd := exec.Command("go", "run", ".")
+	cmd.Stdin = strings.NewReader("OVER9000\nGBR9297T\nTOOLONGCODE12345\n")
+	cmd.Env = append(os.Environ(),
+		"COUPON_FILES="+dir+"/f1.txt.gz,"+dir+"/f2.zst,-,"+dir+"/more.tar.gz",
+		"OUTPUT_PATH="+outputPath,
+		"SORT_TMP_DIR="+dir,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("preprocessor failed: %v\noutput: %s", err, output)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if want := "GBR9297T\nGNULINUX\nOVER9000\nSIXTYOFF\nTARCODE1\n"; string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+
+	report, _ := os.ReadFile(outputPath + ".report.json")
+	if !strings.Contains(string(report), `"path": "`+dir+`/more.tar.gz:a.txt"`) {
+		t.Errorf("expected tar members to be reported as inputs, got:\n%s", report)
+	}
+
+	leftovers, _ := filepath.Glob(dir + "/preprocess-inputs-*")
+	if len(leftovers) != 0 {
+		t.Errorf("expected extracted members to be removed, found %v", leftovers)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
+)
+
+// report is the machine-readable summary of a run, written as JSON next to
+// the output file.
+type report struct {
+	Output   string       `json:"output"`
+	Format   string       `json:"format"`
+	Mode     string       `json:"mode"`
+	Rules    reportRules  `json:"rules"`
+	Files    []fileReport `json:"files"`
+	Valid    int          `json:"valid"`
+	Rejected rejections   `json:"rejected"`
+	// Overlap[i][j] is the number of distinct accepted codes found in both
+	// Files[i] and Files[j]; the diagonal is each file's distinct codes.
+	Overlap [][]int  `json:"overlap"`
+	Stages  []stage  `json:"stages"`
+	Elapsed duration `json:"elapsedMs"`
+	// Filter describes the Bloom filter written next to the output, if any.
+	Filter *helpers.CouponFilterInfo `json:"filter,omitempty"`
+}
+
+type reportRules struct {
+	MinLength int    `json:"minLength"`
+	MaxLength int    `json:"maxLength"`
+	Pattern   string `json:"pattern,omitempty"`
+	MinFiles  int    `json:"minFiles"`
+}
+
+// fileReport counts lines of one input. Format, length and pattern
+// rejections and WithValidity count lines; Unique, Duplicates and
+// RejectedFrequency count accepted codes.
+type fileReport struct {
+	Path              string `json:"path"`
+	Lines             int    `json:"lines"`
+	RejectedFormat    int    `json:"rejectedFormat"`
+	RejectedLength    int    `json:"rejectedLength"`
+	RejectedPattern   int    `json:"rejectedPattern"`
+	WithValidity      int    `json:"withValidity"`
+	Unique            int    `json:"unique"`
+	Duplicates        int    `json:"duplicates"`
+	RejectedFrequency int    `json:"rejectedFrequency"`
+
+	accepted int
+}
+
+type rejections struct {
+	Format    int `json:"format"`
+	Length    int `json:"length"`
+	Pattern   int `json:"pattern"`
+	Frequency int `json:"frequency"`
+}
+
+type stage struct {
+	Name    string   `json:"name"`
+	Elapsed duration `json:"elapsedMs"`
+}
+
+// duration marshals as fractional milliseconds.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(float64(time.Duration(d).Microseconds()) / 1000)
+}
+
+func newReport(files []input) *report {
+	r := &report{
+		Files:   make([]fileReport, len(files)),
+		Overlap: make([][]int, len(files)),
+	}
+	for i, f := range files {
+		r.Files[i].Path = f.name
+		r.Overlap[i] = make([]int, len(files))
+	}
+	return r
+}
+
+// line records one input line of file i against the code rules.
+func (r *report) line(i int, sel selection, code string) bool {
+	f := &r.Files[i]
+	f.Lines++
+	switch {
+	case !sel.rules.ValidLength(code):
+		f.RejectedLength++
+		return false
+	case !sel.rules.Accept(code):
+		f.RejectedPattern++
+		return false
+	}
+	f.accepted++
+	return true
+}
+
+// malformed records a line of file i that could not be parsed.
+func (r *report) malformed(i int) {
+	r.Files[i].Lines++
+	r.Files[i].RejectedFormat++
+}
+
+// hasValidity reports whether any accepted line carried a validity period.
+func (r *report) hasValidity() bool {
+	for _, f := range r.Files {
+		if f.WithValidity > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// code records one distinct accepted code found in the given inputs and
+// reports whether it meets the threshold.
+func (r *report) code(sel selection, inputs []int) bool {
+	valid := len(inputs) >= sel.minFiles
+	for _, i := range inputs {
+		r.Files[i].Unique++
+		if !valid {
+			r.Files[i].RejectedFrequency++
+		}
+		for _, j := range inputs {
+			r.Overlap[i][j]++
+		}
+	}
+	if valid {
+		r.Valid++
+	} else {
+		r.Rejected.Frequency++
+	}
+	return valid
+}
+
+// merge adds the per-code tallies of part, built over the same files.
+func (r *report) merge(part *report) {
+	for i := range r.Files {
+		r.Files[i].Unique += part.Files[i].Unique
+		r.Files[i].RejectedFrequency += part.Files[i].RejectedFrequency
+		for j := range r.Overlap[i] {
+			r.Overlap[i][j] += part.Overlap[i][j]
+		}
+	}
+	r.Valid += part.Valid
+	r.Rejected.Frequency += part.Rejected.Frequency
+}
+
+// stage times fn and records it under name.
+func (r *report) stage(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	r.Stages = append(r.Stages, stage{Name: name, Elapsed: duration(time.Since(start))})
+	return err
+}
+
+func (r *report) finish(elapsed time.Duration) {
+	for i := range r.Files {
+		f := &r.Files[i]
+		f.Duplicates = f.accepted - f.Unique
+		r.Rejected.Format += f.RejectedFormat
+		r.Rejected.Length += f.RejectedLength
+		r.Rejected.Pattern += f.RejectedPattern
+	}
+	r.Elapsed = duration(elapsed)
+}
+
+func (r *report) write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
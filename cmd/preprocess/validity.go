@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
+)
+
+// parseLine splits an input line into its code and validity period. Plain
+// lines are just the code; CSV lines are "code,start,end" with either bound
+// optionally empty.
+func parseLine(line []byte) (code []byte, v domain.CouponValidity, err error) {
+	i := bytes.IndexByte(line, ',')
+	if i < 0 {
+		return line, v, nil
+	}
+	start, end, ok := strings.Cut(string(line[i+1:]), ",")
+	if !ok {
+		return nil, v, errors.New("expected code,start,end")
+	}
+	v, err = helpers.ParseValidity(start, end)
+	return line[:i], v, err
+}
+
+// narrow combines the periods of two listings of the same code. A code is
+// only valid while every listing says so: the later start and the earlier
+// end win.
+func narrow(a, b domain.CouponValidity) domain.CouponValidity {
+	if b.StartsAt.After(a.StartsAt) {
+		a.StartsAt = b.StartsAt
+	}
+	if !b.EndsAt.IsZero() && (a.EndsAt.IsZero() || b.EndsAt.Before(a.EndsAt)) {
+		a.EndsAt = b.EndsAt
+	}
+	return a
+}
+
+// encodeRunLine writes code and its period as a line of a run file, with the
+// bounds as Unix seconds. The tab sorts before every character of a code, so
+// lines still sort by code.
+func encodeRunLine(code string, v domain.CouponValidity) string {
+	if v.IsZero() {
+		return code
+	}
+	return code + "\t" + strconv.FormatInt(unixOrZero(v.StartsAt), 10) + "\t" + strconv.FormatInt(unixOrZero(v.EndsAt), 10)
+}
+
+func decodeRunLine(line string) (string, domain.CouponValidity) {
+	code, rest, ok := strings.Cut(line, "\t")
+	if !ok {
+		return line, domain.CouponValidity{}
+	}
+	start, end, _ := strings.Cut(rest, "\t")
+	return code, domain.CouponValidity{StartsAt: fromUnix(start), EndsAt: fromUnix(end)}
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnix(s string) time.Time {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(n, 0).UTC()
+}
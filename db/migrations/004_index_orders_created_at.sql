@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_orders_created_at_id ON orders(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_coupon_code ON orders(coupon_code) WHERE coupon_code IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_orders_coupon_code;
+DROP INDEX IF EXISTS idx_orders_created_at_id;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'placed'
+    CHECK (status IN ('placed', 'accepted', 'preparing', 'ready', 'completed', 'cancelled', 'rejected'));
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id          BIGSERIAL PRIMARY KEY,
+    order_id    UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status   TEXT NOT NULL,
+    changed_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_order_status_history_order_id ON order_status_history(order_id, changed_at);
+
+-- Existing orders were implicitly placed when they were created.
+INSERT INTO order_status_history (order_id, from_status, to_status, changed_at)
+SELECT id, NULL, 'placed', created_at FROM orders;
+
+-- +goose Down
+DROP TABLE IF EXISTS order_status_history;
+ALTER TABLE orders DROP COLUMN IF EXISTS status;
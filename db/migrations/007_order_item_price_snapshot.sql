@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS product_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS unit_price   NUMERIC(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS line_total   NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+-- Best-effort backfill: orders placed before this migration get the catalogue
+-- price as it is now, since the price at checkout was never recorded.
+UPDATE order_items oi
+SET product_name = p.name,
+    unit_price   = p.price,
+    line_total   = p.price * oi.quantity
+FROM products p
+WHERE p.id = oi.product_id;
+
+ALTER TABLE order_items
+    ALTER COLUMN product_name DROP DEFAULT,
+    ALTER COLUMN unit_price DROP DEFAULT,
+    ALTER COLUMN line_total DROP DEFAULT;
+
+-- +goose Down
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS line_total,
+    DROP COLUMN IF EXISTS unit_price,
+    DROP COLUMN IF EXISTS product_name;
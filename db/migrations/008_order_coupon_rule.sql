@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS coupon_rule JSONB;
+
+-- +goose Down
+ALTER TABLE orders DROP COLUMN IF EXISTS coupon_rule;
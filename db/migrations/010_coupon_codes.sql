@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS coupon_codes (
+    code       TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- cmd/preprocess --target=postgres COPYs a full code list here and then
+-- syncs coupon_codes from it, so codes keep their metadata across loads.
+CREATE UNLOGGED TABLE IF NOT EXISTS coupon_codes_staging (
+    code TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS coupon_codes_staging;
+DROP TABLE IF EXISTS coupon_codes;
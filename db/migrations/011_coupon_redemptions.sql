@@ -0,0 +1,40 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id          BIGSERIAL PRIMARY KEY,
+    order_id    UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    code        TEXT NOT NULL,
+    customer_id TEXT,
+    discount    NUMERIC(10,2) NOT NULL,
+    redeemed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_coupon_redemptions_redeemed_at ON coupon_redemptions(redeemed_at, code);
+
+-- Running totals checked against the usage limits. Claiming a redemption
+-- upserts the code's row, which holds its lock until the order commits, so
+-- concurrent orders for the same code are counted one after another.
+CREATE TABLE IF NOT EXISTS coupon_usage (
+    code        TEXT PRIMARY KEY,
+    redemptions INT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS coupon_customer_usage (
+    code        TEXT NOT NULL,
+    customer_id TEXT NOT NULL,
+    redemptions INT NOT NULL,
+    PRIMARY KEY (code, customer_id)
+);
+
+-- Orders placed before the ledger existed count towards the global limits.
+INSERT INTO coupon_redemptions (order_id, code, discount, redeemed_at)
+SELECT id, coupon_code, discounts, created_at
+FROM orders
+WHERE coupon_code IS NOT NULL AND coupon_rejection IS NULL;
+
+INSERT INTO coupon_usage (code, redemptions)
+SELECT code, COUNT(*) FROM coupon_redemptions GROUP BY code;
+
+-- +goose Down
+DROP TABLE IF EXISTS coupon_customer_usage;
+DROP TABLE IF EXISTS coupon_usage;
+DROP TABLE IF EXISTS coupon_redemptions;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE coupon_codes ADD COLUMN IF NOT EXISTS starts_at TIMESTAMPTZ;
+
+ALTER TABLE coupon_codes_staging
+    ADD COLUMN IF NOT EXISTS starts_at  TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE coupon_codes_staging
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS starts_at;
+
+ALTER TABLE coupon_codes DROP COLUMN IF EXISTS starts_at;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- source tells codes loaded by cmd/preprocess apart from codes added through
+-- the admin API; a load only removes codes it owns. disabled_at is set while
+-- an admin has switched the code off.
+ALTER TABLE coupon_codes
+    ADD COLUMN IF NOT EXISTS source      TEXT NOT NULL DEFAULT 'preprocess'
+        CHECK (source IN ('preprocess', 'admin')),
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE coupon_codes
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS source;
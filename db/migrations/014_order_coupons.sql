@@ -0,0 +1,24 @@
+-- +goose Up
+-- Every coupon submitted with an order, in request order. The first one is
+-- also kept in the coupon columns of orders.
+CREATE TABLE IF NOT EXISTS order_coupons (
+    order_id  UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    position  INT NOT NULL,
+    code      TEXT NOT NULL,
+    rule      JSONB,
+    rejection TEXT,
+    discount  NUMERIC(10,2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (order_id, position)
+);
+
+CREATE INDEX idx_order_coupons_code ON order_coupons(code);
+
+INSERT INTO order_coupons (order_id, position, code, rule, rejection, discount)
+SELECT id, 0, coupon_code, coupon_rule, coupon_rejection,
+       CASE WHEN coupon_rule IS NOT NULL THEN discounts ELSE 0 END
+FROM orders
+WHERE coupon_code IS NOT NULL
+  AND (coupon_rule IS NOT NULL OR coupon_rejection IS NOT NULL);
+
+-- +goose Down
+DROP TABLE IF EXISTS order_coupons;
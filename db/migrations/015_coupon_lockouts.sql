@@ -0,0 +1,17 @@
+-- +goose Up
+-- Audit log of clients locked out of coupon lookups for submitting too many
+-- unknown codes. The lockouts themselves are tracked in memory.
+CREATE TABLE IF NOT EXISTS coupon_lockouts (
+    id           BIGSERIAL PRIMARY KEY,
+    kind         TEXT NOT NULL CHECK (kind IN ('api_key', 'ip')),
+    subject      TEXT NOT NULL,
+    failures     INT NOT NULL,
+    strike       INT NOT NULL,
+    locked_at    TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_coupon_lockouts_locked_at ON coupon_lockouts(locked_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS coupon_lockouts;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- Products are managed through the API from here on. categories lists the
+-- categories a product may be filed under, deleted_at hides a product from
+-- the catalog while past orders keep referring to it, and new products get
+-- the next number after the seeded ids.
+CREATE TABLE IF NOT EXISTS categories (
+    name TEXT PRIMARY KEY
+);
+
+INSERT INTO categories (name)
+SELECT DISTINCT category FROM products
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE products
+    ADD CONSTRAINT products_category_fkey FOREIGN KEY (category) REFERENCES categories(name),
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE SEQUENCE IF NOT EXISTS products_id_seq OWNED BY products.id;
+SELECT setval('products_id_seq',
+    COALESCE((SELECT MAX(id::BIGINT) FROM products WHERE id ~ '^[0-9]{1,18}$'), 0) + 1, false);
+ALTER TABLE products ALTER COLUMN id SET DEFAULT nextval('products_id_seq')::TEXT;
+
+-- +goose Down
+ALTER TABLE products ALTER COLUMN id DROP DEFAULT;
+DROP SEQUENCE IF EXISTS products_id_seq;
+
+ALTER TABLE products
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP CONSTRAINT IF EXISTS products_category_fkey;
+
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- GET /api/product filters by category and price and searches names by
+-- substring; pg_trgm lets the name search use an index.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_products_category_price ON products(category, price);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_products_category_price;
+DROP INDEX IF EXISTS idx_products_name_trgm;
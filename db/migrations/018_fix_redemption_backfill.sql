@@ -0,0 +1,23 @@
+-- +goose Up
+-- The backfill in 011 also counted orders whose coupon was never applied:
+-- orders placed before coupon_rejection existed kept the code of a rejected
+-- coupon with no discount. Remove those redemptions and give the uses back.
+-- Live redemptions always have an applied order_coupons row, and the
+-- backfilled ones never have a customer.
+WITH removed AS (
+    DELETE FROM coupon_redemptions r
+    WHERE r.customer_id IS NULL
+      AND r.discount = 0
+      AND NOT EXISTS (
+          SELECT 1 FROM order_coupons oc
+          WHERE oc.order_id = r.order_id AND oc.code = r.code AND oc.rule IS NOT NULL
+      )
+    RETURNING r.code
+)
+UPDATE coupon_usage u
+SET redemptions = u.redemptions - d.n
+FROM (SELECT code, COUNT(*) AS n FROM removed GROUP BY code) d
+WHERE u.code = d.code;
+
+-- +goose Down
+-- The removed redemptions were never real; there is nothing to restore.
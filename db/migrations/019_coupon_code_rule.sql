@@ -0,0 +1,7 @@
+-- +goose Up
+-- A rule given when a code is added through the admin API. It takes
+-- precedence over the rules file; codes without one use the file.
+ALTER TABLE coupon_codes ADD COLUMN IF NOT EXISTS rule JSONB;
+
+-- +goose Down
+ALTER TABLE coupon_codes DROP COLUMN IF EXISTS rule;
@@ -0,0 +1,56 @@
+-- name: GetCouponCode :one
+SELECT code, expires_at, created_at, starts_at, source, disabled_at, rule
+FROM coupon_codes
+WHERE code = $1;
+
+-- name: ListCouponCodes :many
+SELECT code, expires_at, created_at, starts_at, source, disabled_at, rule
+FROM coupon_codes
+WHERE (sqlc.narg('source')::text IS NULL OR source = sqlc.narg('source'))
+  AND (sqlc.narg('disabled')::bool IS NULL OR (disabled_at IS NOT NULL) = sqlc.narg('disabled'))
+  AND (sqlc.narg('after_code')::text IS NULL OR code > sqlc.narg('after_code'))
+ORDER BY code
+LIMIT sqlc.arg('page_size');
+
+-- name: CreateCouponCode :one
+-- Adds a code through the admin API. An existing code is left unchanged and
+-- no row is returned.
+INSERT INTO coupon_codes (code, starts_at, expires_at, source, rule)
+VALUES ($1, $2, $3, 'admin', $4)
+ON CONFLICT (code) DO NOTHING
+RETURNING code, expires_at, created_at, starts_at, source, disabled_at, rule;
+
+-- name: SetCouponCodeDisabled :one
+-- Disabling keeps the time the code was first switched off.
+UPDATE coupon_codes
+SET disabled_at = CASE WHEN sqlc.arg('disabled')::bool THEN COALESCE(disabled_at, NOW()) END
+WHERE code = sqlc.arg('code')
+RETURNING code, expires_at, created_at, starts_at, source, disabled_at, rule;
+
+-- name: TruncateCouponCodesStaging :exec
+TRUNCATE coupon_codes_staging;
+
+-- name: DeleteUnstagedCouponCodes :execrows
+-- Removes codes loaded by cmd/preprocess that are missing from the freshly
+-- loaded staging table. Codes added through the admin API are kept.
+DELETE FROM coupon_codes c
+WHERE c.source = 'preprocess'
+  AND NOT EXISTS (
+    SELECT 1 FROM coupon_codes_staging s WHERE s.code = c.code
+);
+
+-- name: UpdateStagedCouponCodes :execrows
+-- Applies the validity periods of staged codes that are already known.
+UPDATE coupon_codes c
+SET starts_at = s.starts_at,
+    expires_at = s.expires_at
+FROM coupon_codes_staging s
+WHERE s.code = c.code
+  AND (c.starts_at IS DISTINCT FROM s.starts_at OR c.expires_at IS DISTINCT FROM s.expires_at);
+
+-- name: InsertStagedCouponCodes :execrows
+-- Adds staged codes that are not known yet under the given source; existing
+-- codes keep their created_at, source and disabled_at.
+INSERT INTO coupon_codes (code, starts_at, expires_at, source)
+SELECT DISTINCT ON (code) code, starts_at, expires_at, sqlc.arg('source')::text FROM coupon_codes_staging
+ON CONFLICT (code) DO NOTHING;
@@ -0,0 +1,22 @@
+-- name: CreateIdempotencyKey :one
+-- Stores the response for a key. An expired row with the same key is
+-- replaced; a live one is left untouched and no row is returned.
+INSERT INTO idempotency_keys (key, request_hash, order_id, response, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash,
+    order_id     = EXCLUDED.order_id,
+    response     = EXCLUDED.response,
+    created_at   = NOW(),
+    expires_at   = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= NOW()
+RETURNING key;
+
+-- name: GetIdempotencyKey :one
+SELECT key, request_hash, order_id, response, created_at, expires_at
+FROM idempotency_keys
+WHERE key = $1 AND expires_at > NOW();
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at <= NOW();
@@ -0,0 +1,12 @@
+-- name: CreateCouponLockout :exec
+INSERT INTO coupon_lockouts (kind, subject, failures, strike, locked_at, locked_until)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: ListCouponLockouts :many
+SELECT id, kind, subject, failures, strike, locked_at, locked_until
+FROM coupon_lockouts
+WHERE locked_at >= sqlc.arg('locked_from')
+  AND locked_at < sqlc.arg('locked_to')
+  AND (sqlc.narg('subject')::text IS NULL OR subject = sqlc.narg('subject'))
+ORDER BY locked_at DESC, id DESC
+LIMIT sqlc.arg('page_size');
@@ -1,18 +1,61 @@
 -- name: CreateOrder :one
-INSERT INTO orders (coupon_code, total, discounts)
-VALUES ($1, $2, $3)
-RETURNING id, coupon_code, total, discounts, created_at;
+INSERT INTO orders (coupon_code, total, discounts, coupon_rule, coupon_rejection)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, coupon_code, total, discounts, created_at, status, coupon_rule, coupon_rejection;
 
 -- name: CreateOrderItem :exec
-INSERT INTO order_items (order_id, product_id, quantity)
-VALUES ($1, $2, $3);
+INSERT INTO order_items (order_id, product_id, product_name, quantity, unit_price, line_total)
+VALUES ($1, $2, $3, $4, $5, $6);
 
 -- name: GetOrder :one
-SELECT id, coupon_code, total, discounts, created_at
+SELECT id, coupon_code, total, discounts, created_at, status, coupon_rule, coupon_rejection
 FROM orders
 WHERE id = $1;
 
+-- name: CreateOrderCoupon :exec
+INSERT INTO order_coupons (order_id, position, code, rule, rejection, discount)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: GetOrderCoupons :many
+SELECT order_id, position, code, rule, rejection, discount
+FROM order_coupons
+WHERE order_id = $1
+ORDER BY position;
+
 -- name: GetOrderItems :many
-SELECT product_id, quantity
+SELECT product_id, product_name, quantity, unit_price, line_total
 FROM order_items
-WHERE order_id = $1;
+WHERE order_id = $1
+ORDER BY id;
+
+-- name: ListOrders :many
+SELECT id, coupon_code, total, discounts, created_at, status, coupon_rule, coupon_rejection
+FROM orders
+WHERE (sqlc.narg('created_from')::timestamptz IS NULL OR created_at >= sqlc.narg('created_from'))
+  AND (sqlc.narg('created_to')::timestamptz IS NULL OR created_at < sqlc.narg('created_to'))
+  AND (sqlc.narg('coupon_code')::text IS NULL OR coupon_code = sqlc.narg('coupon_code')
+       OR EXISTS (SELECT 1 FROM order_coupons oc
+                  WHERE oc.order_id = orders.id AND oc.code = sqlc.narg('coupon_code')))
+  AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+  AND (sqlc.narg('min_total')::numeric IS NULL OR total >= sqlc.narg('min_total'))
+  AND (sqlc.narg('max_total')::numeric IS NULL OR total <= sqlc.narg('max_total'))
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+       OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: UpdateOrderStatus :one
+UPDATE orders
+SET status = sqlc.arg('to_status')
+WHERE id = sqlc.arg('id') AND status = sqlc.arg('from_status')
+RETURNING id, coupon_code, total, discounts, created_at, status, coupon_rule, coupon_rejection;
+
+-- name: CreateOrderStatusHistory :exec
+INSERT INTO order_status_history (order_id, from_status, to_status)
+VALUES ($1, $2, $3);
+
+-- name: GetOrderStatusHistory :many
+SELECT from_status, to_status, changed_at
+FROM order_status_history
+WHERE order_id = $1
+ORDER BY changed_at, id;
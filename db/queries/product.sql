@@ -1,14 +1,69 @@
 -- name: ListProducts :many
-SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop
+-- Lists the catalog in the order sort names: 'name', 'price', either with a
+-- leading '-' for descending, or empty for menu order, which puts numeric
+-- ids in numeric order. Ties are broken by id. The cursor columns hold the
+-- sort key and id of the last product of the previous page. A null
+-- page_size lists every match.
+SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop, deleted_at
 FROM products
-ORDER BY id;
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('categories')::text[] IS NULL OR category = ANY(sqlc.narg('categories')::text[]))
+  AND (sqlc.narg('min_price')::numeric IS NULL OR price >= sqlc.narg('min_price'))
+  AND (sqlc.narg('max_price')::numeric IS NULL OR price <= sqlc.narg('max_price'))
+  AND (sqlc.narg('name_pattern')::text IS NULL OR name ILIKE sqlc.narg('name_pattern'))
+  AND (sqlc.narg('cursor_id')::text IS NULL OR CASE sqlc.arg('sort')::text
+        WHEN 'name' THEN (name, id) > (sqlc.narg('cursor_name')::text, sqlc.narg('cursor_id'))
+        WHEN '-name' THEN (name, id) < (sqlc.narg('cursor_name')::text, sqlc.narg('cursor_id'))
+        WHEN 'price' THEN (price, id) > (sqlc.narg('cursor_price')::numeric, sqlc.narg('cursor_id'))
+        WHEN '-price' THEN (price, id) < (sqlc.narg('cursor_price')::numeric, sqlc.narg('cursor_id'))
+        ELSE (LENGTH(id), id) > (LENGTH(sqlc.narg('cursor_id')), sqlc.narg('cursor_id'))
+      END)
+ORDER BY
+  CASE WHEN sqlc.arg('sort') = 'name' THEN name END,
+  CASE WHEN sqlc.arg('sort') = '-name' THEN name END DESC,
+  CASE WHEN sqlc.arg('sort') = 'price' THEN price END,
+  CASE WHEN sqlc.arg('sort') = '-price' THEN price END DESC,
+  CASE WHEN sqlc.arg('sort') IN ('name', 'price') THEN id END,
+  CASE WHEN sqlc.arg('sort') IN ('-name', '-price') THEN id END DESC,
+  LENGTH(id), id
+LIMIT sqlc.narg('page_size');
 
 -- name: GetProduct :one
-SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop
+SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop, deleted_at
 FROM products
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: GetProductsByIDs :many
-SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop
+-- Deleted products are included: past orders still refer to them.
+SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop, deleted_at
 FROM products
 WHERE id = ANY($1::text[]);
+
+-- name: CreateProduct :one
+INSERT INTO products (name, price, category, img_thumb, img_mobile, img_tablet, img_desktop)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop, deleted_at;
+
+-- name: UpdateProduct :one
+-- Changes the given columns of a product that is not deleted; NULL keeps
+-- the current value.
+UPDATE products
+SET name = COALESCE(sqlc.narg(name), name),
+    price = COALESCE(sqlc.narg(price), price),
+    category = COALESCE(sqlc.narg(category), category),
+    img_thumb = COALESCE(sqlc.narg(img_thumb), img_thumb),
+    img_mobile = COALESCE(sqlc.narg(img_mobile), img_mobile),
+    img_tablet = COALESCE(sqlc.narg(img_tablet), img_tablet),
+    img_desktop = COALESCE(sqlc.narg(img_desktop), img_desktop)
+WHERE id = sqlc.arg(id) AND deleted_at IS NULL
+RETURNING id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop, deleted_at;
+
+-- name: DeleteProduct :execrows
+UPDATE products
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: ListCategories :many
+SELECT name
+FROM categories
+ORDER BY name;
@@ -0,0 +1,41 @@
+-- name: ClaimCouponUsage :one
+-- Counts one more redemption of a code. When the code is already at
+-- max_redemptions the row is left unchanged and no row is returned.
+INSERT INTO coupon_usage AS u (code, redemptions)
+VALUES (sqlc.arg('code'), 1)
+ON CONFLICT (code) DO UPDATE
+SET redemptions = u.redemptions + 1
+WHERE sqlc.narg('max_redemptions')::int IS NULL OR u.redemptions < sqlc.narg('max_redemptions')
+RETURNING redemptions;
+
+-- name: ClaimCouponCustomerUsage :one
+-- Per-customer counterpart of ClaimCouponUsage.
+INSERT INTO coupon_customer_usage AS u (code, customer_id, redemptions)
+VALUES (sqlc.arg('code'), sqlc.arg('customer_id'), 1)
+ON CONFLICT (code, customer_id) DO UPDATE
+SET redemptions = u.redemptions + 1
+WHERE sqlc.narg('max_redemptions')::int IS NULL OR u.redemptions < sqlc.narg('max_redemptions')
+RETURNING redemptions;
+
+-- name: CreateCouponRedemption :exec
+INSERT INTO coupon_redemptions (order_id, code, customer_id, discount)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetCouponUsage :one
+SELECT
+    COALESCE((SELECT redemptions FROM coupon_usage u WHERE u.code = sqlc.arg('code')), 0)::int AS redemptions,
+    COALESCE((SELECT redemptions FROM coupon_customer_usage c
+              WHERE c.code = sqlc.arg('code') AND c.customer_id = sqlc.arg('customer_id')), 0)::int AS customer_redemptions;
+
+-- name: CouponRedemptionsByDay :many
+SELECT
+    code,
+    (redeemed_at AT TIME ZONE 'UTC')::date AS day,
+    COUNT(*)::int AS redemptions,
+    SUM(discount)::numeric AS discounts
+FROM coupon_redemptions
+WHERE redeemed_at >= sqlc.arg('redeemed_from')
+  AND redeemed_at < sqlc.arg('redeemed_to')
+  AND (sqlc.narg('code')::text IS NULL OR code = sqlc.narg('code'))
+GROUP BY code, day
+ORDER BY day, code;
@@ -2,13 +2,41 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	Port        string
 	DatabaseURL string
 	APIKey      string
+	// AdminAPIKey guards the staff endpoints: /admin/*, menu changes and
+	// order status changes. They answer 503 while it is empty.
+	AdminAPIKey    string
+	IdempotencyTTL time.Duration
+	// CouponReloadInterval is how often the valid codes file is checked for
+	// changes. Zero disables polling; POST /admin/coupons/reload still works.
+	CouponReloadInterval time.Duration
+	// CouponStore selects where valid codes are read from: "file" for the
+	// file written by cmd/preprocess, "postgres" for the coupon_codes table.
+	CouponStore string
+	// CouponMaxFailures rejected coupon codes from one IP address within
+	// CouponFailureWindow lock it out of coupon lookups for CouponLockout,
+	// doubling on every repeat up to CouponMaxLockout. Zero disables
+	// lockouts.
+	CouponMaxFailures   int
+	CouponFailureWindow time.Duration
+	CouponLockout       time.Duration
+	CouponMaxLockout    time.Duration
+	// CouponLockoutAllowlist holds addresses that are never locked out,
+	// such as a shop's own tills.
+	CouponLockoutAllowlist []netip.Prefix
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header
+	// is believed when working out a client's IP address.
+	TrustedProxies []netip.Prefix
 }
 
 func Load() (*Config, error) {
@@ -17,6 +45,65 @@ func Load() (*Config, error) {
 		APIKey: getEnv("API_KEY", "apitest"),
 	}
 
+	ttl, err := time.ParseDuration(getEnv("IDEMPOTENCY_TTL", "24h"))
+	if err != nil || ttl <= 0 {
+		return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL %q: must be a positive duration", os.Getenv("IDEMPOTENCY_TTL"))
+	}
+	cfg.IdempotencyTTL = ttl
+	cfg.AdminAPIKey = os.Getenv("ADMIN_API_KEY")
+	if cfg.AdminAPIKey != "" && cfg.AdminAPIKey == cfg.APIKey {
+		return nil, fmt.Errorf("invalid ADMIN_API_KEY: must differ from API_KEY")
+	}
+
+	reload, err := time.ParseDuration(getEnv("COUPON_RELOAD_INTERVAL", "30s"))
+	if err != nil || reload < 0 {
+		return nil, fmt.Errorf("invalid COUPON_RELOAD_INTERVAL %q: must be a non-negative duration", os.Getenv("COUPON_RELOAD_INTERVAL"))
+	}
+	cfg.CouponReloadInterval = reload
+
+	cfg.CouponStore = getEnv("COUPON_STORE", "file")
+	if cfg.CouponStore != "file" && cfg.CouponStore != "postgres" {
+		return nil, fmt.Errorf("invalid COUPON_STORE %q: must be file or postgres", cfg.CouponStore)
+	}
+
+	maxFailures, err := strconv.Atoi(getEnv("COUPON_MAX_FAILURES", "50"))
+	if err != nil || maxFailures < 0 {
+		return nil, fmt.Errorf("invalid COUPON_MAX_FAILURES %q: must be a non-negative integer", os.Getenv("COUPON_MAX_FAILURES"))
+	}
+	cfg.CouponMaxFailures = maxFailures
+
+	for _, d := range []struct {
+		key, fallback string
+		dst           *time.Duration
+	}{
+		{"COUPON_FAILURE_WINDOW", "10m", &cfg.CouponFailureWindow},
+		{"COUPON_LOCKOUT", "1m", &cfg.CouponLockout},
+		{"COUPON_MAX_LOCKOUT", "1h", &cfg.CouponMaxLockout},
+	} {
+		v, err := time.ParseDuration(getEnv(d.key, d.fallback))
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid %s %q: must be a positive duration", d.key, os.Getenv(d.key))
+		}
+		*d.dst = v
+	}
+	if cfg.CouponMaxLockout < cfg.CouponLockout {
+		return nil, fmt.Errorf("invalid COUPON_MAX_LOCKOUT %q: must not be shorter than COUPON_LOCKOUT", os.Getenv("COUPON_MAX_LOCKOUT"))
+	}
+
+	for _, p := range []struct {
+		key string
+		dst *[]netip.Prefix
+	}{
+		{"COUPON_LOCKOUT_ALLOWLIST", &cfg.CouponLockoutAllowlist},
+		{"TRUSTED_PROXIES", &cfg.TrustedProxies},
+	} {
+		prefixes, err := parsePrefixes(os.Getenv(p.key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: must be a comma-separated list of IP addresses or CIDR ranges", p.key, os.Getenv(p.key))
+		}
+		*p.dst = prefixes
+	}
+
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL != "" {
 		cfg.DatabaseURL = dbURL
@@ -42,3 +129,30 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// parsePrefixes parses a comma-separated list of CIDR ranges. A bare
+// address stands for itself alone.
+func parsePrefixes(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, err
+			}
+			addr = addr.Unmap()
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, prefix.Masked())
+	}
+	return out, nil
+}
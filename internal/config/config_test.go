@@ -0,0 +1,48 @@
+package config
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: " , ", want: nil},
+		{in: "10.0.0.0/8", want: []string{"10.0.0.0/8"}},
+		{in: "10.1.2.3/8", want: []string{"10.0.0.0/8"}},
+		{in: "192.168.1.20", want: []string{"192.168.1.20/32"}},
+		{in: "::ffff:192.168.1.20", want: []string{"192.168.1.20/32"}},
+		{in: "2001:db8::1", want: []string{"2001:db8::1/128"}},
+		{in: "10.0.0.0/8, 192.168.1.20 ,2001:db8::/32", want: []string{"10.0.0.0/8", "192.168.1.20/32", "2001:db8::/32"}},
+		{in: "10.0.0.0/33", wantErr: true},
+		{in: "10.0.0", wantErr: true},
+		{in: "example.com", wantErr: true},
+		{in: "10.0.0.0/8,nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePrefixes(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parsePrefixes(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePrefixes(%q): %v", tt.in, err)
+			continue
+		}
+		var want []netip.Prefix
+		for _, p := range tt.want {
+			want = append(want, netip.MustParsePrefix(p))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("parsePrefixes(%q) = %v, want %v", tt.in, got, want)
+		}
+	}
+}
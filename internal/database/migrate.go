@@ -0,0 +1,19 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+
+	"github.com/Sanjaiy/foodieapp/db"
+)
+
+// Migrate brings the schema up to date. Both the API and the preprocessor's
+// postgres target run it, so either can start first.
+func Migrate(dbConn *sql.DB) error {
+	goose.SetBaseFS(db.MigrationsFS)
+	if err := goose.SetDialect("postgres"); err != nil {
+		return err
+	}
+	return goose.Up(dbConn, "migrations")
+}
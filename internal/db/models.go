@@ -6,33 +6,118 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/sqlc-dev/pqtype"
 )
 
+type Category struct {
+	Name string `json:"name"`
+}
+
+type CouponCode struct {
+	Code       string                `json:"code"`
+	ExpiresAt  sql.NullTime          `json:"expires_at"`
+	CreatedAt  time.Time             `json:"created_at"`
+	StartsAt   sql.NullTime          `json:"starts_at"`
+	Source     string                `json:"source"`
+	DisabledAt sql.NullTime          `json:"disabled_at"`
+	Rule       pqtype.NullRawMessage `json:"rule"`
+}
+
+type CouponCodesStaging struct {
+	Code      string       `json:"code"`
+	StartsAt  sql.NullTime `json:"starts_at"`
+	ExpiresAt sql.NullTime `json:"expires_at"`
+}
+
+type CouponCustomerUsage struct {
+	Code        string `json:"code"`
+	CustomerID  string `json:"customer_id"`
+	Redemptions int32  `json:"redemptions"`
+}
+
+type CouponLockout struct {
+	ID          int64     `json:"id"`
+	Kind        string    `json:"kind"`
+	Subject     string    `json:"subject"`
+	Failures    int32     `json:"failures"`
+	Strike      int32     `json:"strike"`
+	LockedAt    time.Time `json:"locked_at"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+type CouponRedemption struct {
+	ID         int64          `json:"id"`
+	OrderID    uuid.UUID      `json:"order_id"`
+	Code       string         `json:"code"`
+	CustomerID sql.NullString `json:"customer_id"`
+	Discount   string         `json:"discount"`
+	RedeemedAt time.Time      `json:"redeemed_at"`
+}
+
+type CouponUsage struct {
+	Code        string `json:"code"`
+	Redemptions int32  `json:"redemptions"`
+}
+
+type IdempotencyKey struct {
+	Key         string          `json:"key"`
+	RequestHash string          `json:"request_hash"`
+	OrderID     uuid.UUID       `json:"order_id"`
+	Response    json.RawMessage `json:"response"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
+
 type Order struct {
-	ID         uuid.UUID      `json:"id"`
-	CouponCode sql.NullString `json:"coupon_code"`
-	Total      string         `json:"total"`
-	Discounts  string         `json:"discounts"`
-	CreatedAt  time.Time      `json:"created_at"`
+	ID              uuid.UUID             `json:"id"`
+	CouponCode      sql.NullString        `json:"coupon_code"`
+	Total           string                `json:"total"`
+	Discounts       string                `json:"discounts"`
+	CreatedAt       time.Time             `json:"created_at"`
+	Status          string                `json:"status"`
+	CouponRule      pqtype.NullRawMessage `json:"coupon_rule"`
+	CouponRejection sql.NullString        `json:"coupon_rejection"`
+}
+
+type OrderCoupon struct {
+	OrderID   uuid.UUID             `json:"order_id"`
+	Position  int32                 `json:"position"`
+	Code      string                `json:"code"`
+	Rule      pqtype.NullRawMessage `json:"rule"`
+	Rejection sql.NullString        `json:"rejection"`
+	Discount  string                `json:"discount"`
 }
 
 type OrderItem struct {
-	ID        int32     `json:"id"`
-	OrderID   uuid.UUID `json:"order_id"`
-	ProductID string    `json:"product_id"`
-	Quantity  int32     `json:"quantity"`
+	ID          int32     `json:"id"`
+	OrderID     uuid.UUID `json:"order_id"`
+	ProductID   string    `json:"product_id"`
+	Quantity    int32     `json:"quantity"`
+	ProductName string    `json:"product_name"`
+	UnitPrice   string    `json:"unit_price"`
+	LineTotal   string    `json:"line_total"`
+}
+
+type OrderStatusHistory struct {
+	ID         int64          `json:"id"`
+	OrderID    uuid.UUID      `json:"order_id"`
+	FromStatus sql.NullString `json:"from_status"`
+	ToStatus   string         `json:"to_status"`
+	ChangedAt  time.Time      `json:"changed_at"`
 }
 
 type Product struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	Price      string `json:"price"`
-	Category   string `json:"category"`
-	ImgThumb   string `json:"img_thumb"`
-	ImgMobile  string `json:"img_mobile"`
-	ImgTablet  string `json:"img_tablet"`
-	ImgDesktop string `json:"img_desktop"`
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Price      string       `json:"price"`
+	Category   string       `json:"category"`
+	ImgThumb   string       `json:"img_thumb"`
+	ImgMobile  string       `json:"img_mobile"`
+	ImgTablet  string       `json:"img_tablet"`
+	ImgDesktop string       `json:"img_desktop"`
+	DeletedAt  sql.NullTime `json:"deleted_at"`
 }
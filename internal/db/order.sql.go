@@ -8,24 +8,34 @@ package db
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/sqlc-dev/pqtype"
 )
 
 const createOrder = `-- name: CreateOrder :one
-INSERT INTO orders (coupon_code, total, discounts)
-VALUES ($1, $2, $3)
-RETURNING id, coupon_code, total, discounts, created_at
+INSERT INTO orders (coupon_code, total, discounts, coupon_rule, coupon_rejection)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, coupon_code, total, discounts, created_at, status, coupon_rule, coupon_rejection
 `
 
 type CreateOrderParams struct {
-	CouponCode sql.NullString `json:"coupon_code"`
-	Total      string         `json:"total"`
-	Discounts  string         `json:"discounts"`
+	CouponCode      sql.NullString        `json:"coupon_code"`
+	Total           string                `json:"total"`
+	Discounts       string                `json:"discounts"`
+	CouponRule      pqtype.NullRawMessage `json:"coupon_rule"`
+	CouponRejection sql.NullString        `json:"coupon_rejection"`
 }
 
 func (q *Queries) CreateOrder(ctx context.Context, arg CreateOrderParams) (Order, error) {
-	row := q.db.QueryRowContext(ctx, createOrder, arg.CouponCode, arg.Total, arg.Discounts)
+	row := q.db.QueryRowContext(ctx, createOrder,
+		arg.CouponCode,
+		arg.Total,
+		arg.Discounts,
+		arg.CouponRule,
+		arg.CouponRejection,
+	)
 	var i Order
 	err := row.Scan(
 		&i.ID,
@@ -33,28 +43,83 @@ func (q *Queries) CreateOrder(ctx context.Context, arg CreateOrderParams) (Order
 		&i.Total,
 		&i.Discounts,
 		&i.CreatedAt,
+		&i.Status,
+		&i.CouponRule,
+		&i.CouponRejection,
 	)
 	return i, err
 }
 
+const createOrderCoupon = `-- name: CreateOrderCoupon :exec
+INSERT INTO order_coupons (order_id, position, code, rule, rejection, discount)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type CreateOrderCouponParams struct {
+	OrderID   uuid.UUID             `json:"order_id"`
+	Position  int32                 `json:"position"`
+	Code      string                `json:"code"`
+	Rule      pqtype.NullRawMessage `json:"rule"`
+	Rejection sql.NullString        `json:"rejection"`
+	Discount  string                `json:"discount"`
+}
+
+func (q *Queries) CreateOrderCoupon(ctx context.Context, arg CreateOrderCouponParams) error {
+	_, err := q.db.ExecContext(ctx, createOrderCoupon,
+		arg.OrderID,
+		arg.Position,
+		arg.Code,
+		arg.Rule,
+		arg.Rejection,
+		arg.Discount,
+	)
+	return err
+}
+
 const createOrderItem = `-- name: CreateOrderItem :exec
-INSERT INTO order_items (order_id, product_id, quantity)
-VALUES ($1, $2, $3)
+INSERT INTO order_items (order_id, product_id, product_name, quantity, unit_price, line_total)
+VALUES ($1, $2, $3, $4, $5, $6)
 `
 
 type CreateOrderItemParams struct {
-	OrderID   uuid.UUID `json:"order_id"`
-	ProductID string    `json:"product_id"`
-	Quantity  int32     `json:"quantity"`
+	OrderID     uuid.UUID `json:"order_id"`
+	ProductID   string    `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	Quantity    int32     `json:"quantity"`
+	UnitPrice   string    `json:"unit_price"`
+	LineTotal   string    `json:"line_total"`
 }
 
 func (q *Queries) CreateOrderItem(ctx context.Context, arg CreateOrderItemParams) error {
-	_, err := q.db.ExecContext(ctx, createOrderItem, arg.OrderID, arg.ProductID, arg.Quantity)
+	_, err := q.db.ExecContext(ctx, createOrderItem,
+		arg.OrderID,
+		arg.ProductID,
+		arg.ProductName,
+		arg.Quantity,
+		arg.UnitPrice,
+		arg.LineTotal,
+	)
+	return err
+}
+
+const createOrderStatusHistory = `-- name: CreateOrderStatusHistory :exec
+INSERT INTO order_status_history (order_id, from_status, to_status)
+VALUES ($1, $2, $3)
+`
+
+type CreateOrderStatusHistoryParams struct {
+	OrderID    uuid.UUID      `json:"order_id"`
+	FromStatus sql.NullString `json:"from_status"`
+	ToStatus   string         `json:"to_status"`
+}
+
+func (q *Queries) CreateOrderStatusHistory(ctx context.Context, arg CreateOrderStatusHistoryParams) error {
+	_, err := q.db.ExecContext(ctx, createOrderStatusHistory, arg.OrderID, arg.FromStatus, arg.ToStatus)
 	return err
 }
 
 const getOrder = `-- name: GetOrder :one
-SELECT id, coupon_code, total, discounts, created_at
+SELECT id, coupon_code, total, discounts, created_at, status, coupon_rule, coupon_rejection
 FROM orders
 WHERE id = $1
 `
@@ -68,19 +133,63 @@ func (q *Queries) GetOrder(ctx context.Context, id uuid.UUID) (Order, error) {
 		&i.Total,
 		&i.Discounts,
 		&i.CreatedAt,
+		&i.Status,
+		&i.CouponRule,
+		&i.CouponRejection,
 	)
 	return i, err
 }
 
+const getOrderCoupons = `-- name: GetOrderCoupons :many
+SELECT order_id, position, code, rule, rejection, discount
+FROM order_coupons
+WHERE order_id = $1
+ORDER BY position
+`
+
+func (q *Queries) GetOrderCoupons(ctx context.Context, orderID uuid.UUID) ([]OrderCoupon, error) {
+	rows, err := q.db.QueryContext(ctx, getOrderCoupons, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OrderCoupon
+	for rows.Next() {
+		var i OrderCoupon
+		if err := rows.Scan(
+			&i.OrderID,
+			&i.Position,
+			&i.Code,
+			&i.Rule,
+			&i.Rejection,
+			&i.Discount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getOrderItems = `-- name: GetOrderItems :many
-SELECT product_id, quantity
+SELECT product_id, product_name, quantity, unit_price, line_total
 FROM order_items
 WHERE order_id = $1
+ORDER BY id
 `
 
 type GetOrderItemsRow struct {
-	ProductID string `json:"product_id"`
-	Quantity  int32  `json:"quantity"`
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int32  `json:"quantity"`
+	UnitPrice   string `json:"unit_price"`
+	LineTotal   string `json:"line_total"`
 }
 
 func (q *Queries) GetOrderItems(ctx context.Context, orderID uuid.UUID) ([]GetOrderItemsRow, error) {
@@ -92,7 +201,13 @@ func (q *Queries) GetOrderItems(ctx context.Context, orderID uuid.UUID) ([]GetOr
 	var items []GetOrderItemsRow
 	for rows.Next() {
 		var i GetOrderItemsRow
-		if err := rows.Scan(&i.ProductID, &i.Quantity); err != nil {
+		if err := rows.Scan(
+			&i.ProductID,
+			&i.ProductName,
+			&i.Quantity,
+			&i.UnitPrice,
+			&i.LineTotal,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -105,3 +220,139 @@ func (q *Queries) GetOrderItems(ctx context.Context, orderID uuid.UUID) ([]GetOr
 	}
 	return items, nil
 }
+
+const getOrderStatusHistory = `-- name: GetOrderStatusHistory :many
+SELECT from_status, to_status, changed_at
+FROM order_status_history
+WHERE order_id = $1
+ORDER BY changed_at, id
+`
+
+type GetOrderStatusHistoryRow struct {
+	FromStatus sql.NullString `json:"from_status"`
+	ToStatus   string         `json:"to_status"`
+	ChangedAt  time.Time      `json:"changed_at"`
+}
+
+func (q *Queries) GetOrderStatusHistory(ctx context.Context, orderID uuid.UUID) ([]GetOrderStatusHistoryRow, error) {
+	rows, err := q.db.QueryContext(ctx, getOrderStatusHistory, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOrderStatusHistoryRow
+	for rows.Next() {
+		var i GetOrderStatusHistoryRow
+		if err := rows.Scan(&i.FromStatus, &i.ToStatus, &i.ChangedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOrders = `-- name: ListOrders :many
+SELECT id, coupon_code, total, discounts, created_at, status, coupon_rule, coupon_rejection
+FROM orders
+WHERE ($1::timestamptz IS NULL OR created_at >= $1)
+  AND ($2::timestamptz IS NULL OR created_at < $2)
+  AND ($3::text IS NULL OR coupon_code = $3
+       OR EXISTS (SELECT 1 FROM order_coupons oc
+                  WHERE oc.order_id = orders.id AND oc.code = $3))
+  AND ($4::text IS NULL OR status = $4)
+  AND ($5::numeric IS NULL OR total >= $5)
+  AND ($6::numeric IS NULL OR total <= $6)
+  AND ($7::timestamptz IS NULL
+       OR (created_at, id) < ($7, $8::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $9
+`
+
+type ListOrdersParams struct {
+	CreatedFrom     sql.NullTime   `json:"created_from"`
+	CreatedTo       sql.NullTime   `json:"created_to"`
+	CouponCode      sql.NullString `json:"coupon_code"`
+	Status          sql.NullString `json:"status"`
+	MinTotal        sql.NullString `json:"min_total"`
+	MaxTotal        sql.NullString `json:"max_total"`
+	CursorCreatedAt sql.NullTime   `json:"cursor_created_at"`
+	CursorID        uuid.NullUUID  `json:"cursor_id"`
+	PageSize        int32          `json:"page_size"`
+}
+
+func (q *Queries) ListOrders(ctx context.Context, arg ListOrdersParams) ([]Order, error) {
+	rows, err := q.db.QueryContext(ctx, listOrders,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.CouponCode,
+		arg.Status,
+		arg.MinTotal,
+		arg.MaxTotal,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Order
+	for rows.Next() {
+		var i Order
+		if err := rows.Scan(
+			&i.ID,
+			&i.CouponCode,
+			&i.Total,
+			&i.Discounts,
+			&i.CreatedAt,
+			&i.Status,
+			&i.CouponRule,
+			&i.CouponRejection,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateOrderStatus = `-- name: UpdateOrderStatus :one
+UPDATE orders
+SET status = $1
+WHERE id = $2 AND status = $3
+RETURNING id, coupon_code, total, discounts, created_at, status, coupon_rule, coupon_rejection
+`
+
+type UpdateOrderStatusParams struct {
+	ToStatus   string    `json:"to_status"`
+	ID         uuid.UUID `json:"id"`
+	FromStatus string    `json:"from_status"`
+}
+
+func (q *Queries) UpdateOrderStatus(ctx context.Context, arg UpdateOrderStatusParams) (Order, error) {
+	row := q.db.QueryRowContext(ctx, updateOrderStatus, arg.ToStatus, arg.ID, arg.FromStatus)
+	var i Order
+	err := row.Scan(
+		&i.ID,
+		&i.CouponCode,
+		&i.Total,
+		&i.Discounts,
+		&i.CreatedAt,
+		&i.Status,
+		&i.CouponRule,
+		&i.CouponRejection,
+	)
+	return i, err
+}
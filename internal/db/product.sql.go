@@ -7,14 +7,70 @@ package db
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/lib/pq"
 )
 
+const createProduct = `-- name: CreateProduct :one
+INSERT INTO products (name, price, category, img_thumb, img_mobile, img_tablet, img_desktop)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop, deleted_at
+`
+
+type CreateProductParams struct {
+	Name       string `json:"name"`
+	Price      string `json:"price"`
+	Category   string `json:"category"`
+	ImgThumb   string `json:"img_thumb"`
+	ImgMobile  string `json:"img_mobile"`
+	ImgTablet  string `json:"img_tablet"`
+	ImgDesktop string `json:"img_desktop"`
+}
+
+func (q *Queries) CreateProduct(ctx context.Context, arg CreateProductParams) (Product, error) {
+	row := q.db.QueryRowContext(ctx, createProduct,
+		arg.Name,
+		arg.Price,
+		arg.Category,
+		arg.ImgThumb,
+		arg.ImgMobile,
+		arg.ImgTablet,
+		arg.ImgDesktop,
+	)
+	var i Product
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Price,
+		&i.Category,
+		&i.ImgThumb,
+		&i.ImgMobile,
+		&i.ImgTablet,
+		&i.ImgDesktop,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const deleteProduct = `-- name: DeleteProduct :execrows
+UPDATE products
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) DeleteProduct(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteProduct, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getProduct = `-- name: GetProduct :one
-SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop
+SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop, deleted_at
 FROM products
-WHERE id = $1
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetProduct(ctx context.Context, id string) (Product, error) {
@@ -29,16 +85,18 @@ func (q *Queries) GetProduct(ctx context.Context, id string) (Product, error) {
 		&i.ImgMobile,
 		&i.ImgTablet,
 		&i.ImgDesktop,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getProductsByIDs = `-- name: GetProductsByIDs :many
-SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop
+SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop, deleted_at
 FROM products
 WHERE id = ANY($1::text[])
 `
 
+// Deleted products are included: past orders still refer to them.
 func (q *Queries) GetProductsByIDs(ctx context.Context, dollar_1 []string) ([]Product, error) {
 	rows, err := q.db.QueryContext(ctx, getProductsByIDs, pq.Array(dollar_1))
 	if err != nil {
@@ -57,6 +115,7 @@ func (q *Queries) GetProductsByIDs(ctx context.Context, dollar_1 []string) ([]Pr
 			&i.ImgMobile,
 			&i.ImgTablet,
 			&i.ImgDesktop,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -71,14 +130,90 @@ func (q *Queries) GetProductsByIDs(ctx context.Context, dollar_1 []string) ([]Pr
 	return items, nil
 }
 
+const listCategories = `-- name: ListCategories :many
+SELECT name
+FROM categories
+ORDER BY name
+`
+
+func (q *Queries) ListCategories(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listCategories)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		items = append(items, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listProducts = `-- name: ListProducts :many
-SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop
+SELECT id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop, deleted_at
 FROM products
-ORDER BY id
+WHERE deleted_at IS NULL
+  AND ($1::text[] IS NULL OR category = ANY($1::text[]))
+  AND ($2::numeric IS NULL OR price >= $2)
+  AND ($3::numeric IS NULL OR price <= $3)
+  AND ($4::text IS NULL OR name ILIKE $4)
+  AND ($5::text IS NULL OR CASE $6::text
+        WHEN 'name' THEN (name, id) > ($7::text, $5)
+        WHEN '-name' THEN (name, id) < ($7::text, $5)
+        WHEN 'price' THEN (price, id) > ($8::numeric, $5)
+        WHEN '-price' THEN (price, id) < ($8::numeric, $5)
+        ELSE (LENGTH(id), id) > (LENGTH($5), $5)
+      END)
+ORDER BY
+  CASE WHEN $6 = 'name' THEN name END,
+  CASE WHEN $6 = '-name' THEN name END DESC,
+  CASE WHEN $6 = 'price' THEN price END,
+  CASE WHEN $6 = '-price' THEN price END DESC,
+  CASE WHEN $6 IN ('name', 'price') THEN id END,
+  CASE WHEN $6 IN ('-name', '-price') THEN id END DESC,
+  LENGTH(id), id
+LIMIT $9
 `
 
-func (q *Queries) ListProducts(ctx context.Context) ([]Product, error) {
-	rows, err := q.db.QueryContext(ctx, listProducts)
+type ListProductsParams struct {
+	Categories  []string       `json:"categories"`
+	MinPrice    sql.NullString `json:"min_price"`
+	MaxPrice    sql.NullString `json:"max_price"`
+	NamePattern sql.NullString `json:"name_pattern"`
+	CursorID    sql.NullString `json:"cursor_id"`
+	Sort        string         `json:"sort"`
+	CursorName  sql.NullString `json:"cursor_name"`
+	CursorPrice sql.NullString `json:"cursor_price"`
+	PageSize    sql.NullInt32  `json:"page_size"`
+}
+
+// Lists the catalog in the order sort names: 'name', 'price', either with a
+// leading '-' for descending, or empty for menu order, which puts numeric
+// ids in numeric order. Ties are broken by id. The cursor columns hold the
+// sort key and id of the last product of the previous page. A null
+// page_size lists every match.
+func (q *Queries) ListProducts(ctx context.Context, arg ListProductsParams) ([]Product, error) {
+	rows, err := q.db.QueryContext(ctx, listProducts,
+		pq.Array(arg.Categories),
+		arg.MinPrice,
+		arg.MaxPrice,
+		arg.NamePattern,
+		arg.CursorID,
+		arg.Sort,
+		arg.CursorName,
+		arg.CursorPrice,
+		arg.PageSize,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -95,6 +230,7 @@ func (q *Queries) ListProducts(ctx context.Context) ([]Product, error) {
 			&i.ImgMobile,
 			&i.ImgTablet,
 			&i.ImgDesktop,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -108,3 +244,55 @@ func (q *Queries) ListProducts(ctx context.Context) ([]Product, error) {
 	}
 	return items, nil
 }
+
+const updateProduct = `-- name: UpdateProduct :one
+UPDATE products
+SET name = COALESCE($1, name),
+    price = COALESCE($2, price),
+    category = COALESCE($3, category),
+    img_thumb = COALESCE($4, img_thumb),
+    img_mobile = COALESCE($5, img_mobile),
+    img_tablet = COALESCE($6, img_tablet),
+    img_desktop = COALESCE($7, img_desktop)
+WHERE id = $8 AND deleted_at IS NULL
+RETURNING id, name, price, category, img_thumb, img_mobile, img_tablet, img_desktop, deleted_at
+`
+
+type UpdateProductParams struct {
+	Name       sql.NullString `json:"name"`
+	Price      sql.NullString `json:"price"`
+	Category   sql.NullString `json:"category"`
+	ImgThumb   sql.NullString `json:"img_thumb"`
+	ImgMobile  sql.NullString `json:"img_mobile"`
+	ImgTablet  sql.NullString `json:"img_tablet"`
+	ImgDesktop sql.NullString `json:"img_desktop"`
+	ID         string         `json:"id"`
+}
+
+// Changes the given columns of a product that is not deleted; NULL keeps
+// the current value.
+func (q *Queries) UpdateProduct(ctx context.Context, arg UpdateProductParams) (Product, error) {
+	row := q.db.QueryRowContext(ctx, updateProduct,
+		arg.Name,
+		arg.Price,
+		arg.Category,
+		arg.ImgThumb,
+		arg.ImgMobile,
+		arg.ImgTablet,
+		arg.ImgDesktop,
+		arg.ID,
+	)
+	var i Product
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Price,
+		&i.Category,
+		&i.ImgThumb,
+		&i.ImgMobile,
+		&i.ImgTablet,
+		&i.ImgDesktop,
+		&i.DeletedAt,
+	)
+	return i, err
+}
@@ -11,13 +11,61 @@ import (
 )
 
 type Querier interface {
+	// Per-customer counterpart of ClaimCouponUsage.
+	ClaimCouponCustomerUsage(ctx context.Context, arg ClaimCouponCustomerUsageParams) (int32, error)
+	// Counts one more redemption of a code. When the code is already at
+	// max_redemptions the row is left unchanged and no row is returned.
+	ClaimCouponUsage(ctx context.Context, arg ClaimCouponUsageParams) (int32, error)
+	CouponRedemptionsByDay(ctx context.Context, arg CouponRedemptionsByDayParams) ([]CouponRedemptionsByDayRow, error)
+	// Adds a code through the admin API. An existing code is left unchanged and
+	// no row is returned.
+	CreateCouponCode(ctx context.Context, arg CreateCouponCodeParams) (CouponCode, error)
+	CreateCouponLockout(ctx context.Context, arg CreateCouponLockoutParams) error
+	CreateCouponRedemption(ctx context.Context, arg CreateCouponRedemptionParams) error
+	// Stores the response for a key. An expired row with the same key is
+	// replaced; a live one is left untouched and no row is returned.
+	CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (string, error)
 	CreateOrder(ctx context.Context, arg CreateOrderParams) (Order, error)
+	CreateOrderCoupon(ctx context.Context, arg CreateOrderCouponParams) error
 	CreateOrderItem(ctx context.Context, arg CreateOrderItemParams) error
+	CreateOrderStatusHistory(ctx context.Context, arg CreateOrderStatusHistoryParams) error
+	CreateProduct(ctx context.Context, arg CreateProductParams) (Product, error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+	DeleteProduct(ctx context.Context, id string) (int64, error)
+	// Removes codes loaded by cmd/preprocess that are missing from the freshly
+	// loaded staging table. Codes added through the admin API are kept.
+	DeleteUnstagedCouponCodes(ctx context.Context) (int64, error)
+	GetCouponCode(ctx context.Context, code string) (CouponCode, error)
+	GetCouponUsage(ctx context.Context, arg GetCouponUsageParams) (GetCouponUsageRow, error)
+	GetIdempotencyKey(ctx context.Context, key string) (IdempotencyKey, error)
 	GetOrder(ctx context.Context, id uuid.UUID) (Order, error)
+	GetOrderCoupons(ctx context.Context, orderID uuid.UUID) ([]OrderCoupon, error)
 	GetOrderItems(ctx context.Context, orderID uuid.UUID) ([]GetOrderItemsRow, error)
+	GetOrderStatusHistory(ctx context.Context, orderID uuid.UUID) ([]GetOrderStatusHistoryRow, error)
 	GetProduct(ctx context.Context, id string) (Product, error)
+	// Deleted products are included: past orders still refer to them.
 	GetProductsByIDs(ctx context.Context, dollar_1 []string) ([]Product, error)
-	ListProducts(ctx context.Context) ([]Product, error)
+	// Adds staged codes that are not known yet under the given source; existing
+	// codes keep their created_at, source and disabled_at.
+	InsertStagedCouponCodes(ctx context.Context, source string) (int64, error)
+	ListCategories(ctx context.Context) ([]string, error)
+	ListCouponCodes(ctx context.Context, arg ListCouponCodesParams) ([]CouponCode, error)
+	ListCouponLockouts(ctx context.Context, arg ListCouponLockoutsParams) ([]CouponLockout, error)
+	ListOrders(ctx context.Context, arg ListOrdersParams) ([]Order, error)
+	// Lists the catalog in the order sort names: 'name', 'price', either with a
+	// leading '-' for descending, or empty for menu order, which puts numeric
+	// ids in numeric order. Ties are broken by id. The cursor columns hold the
+	// sort key and id of the last product of the previous page.
+	ListProducts(ctx context.Context, arg ListProductsParams) ([]Product, error)
+	// Disabling keeps the time the code was first switched off.
+	SetCouponCodeDisabled(ctx context.Context, arg SetCouponCodeDisabledParams) (CouponCode, error)
+	TruncateCouponCodesStaging(ctx context.Context) error
+	UpdateOrderStatus(ctx context.Context, arg UpdateOrderStatusParams) (Order, error)
+	// Changes the given columns of a product that is not deleted; NULL keeps
+	// the current value.
+	UpdateProduct(ctx context.Context, arg UpdateProductParams) (Product, error)
+	// Applies the validity periods of staged codes that are already known.
+	UpdateStagedCouponCodes(ctx context.Context) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
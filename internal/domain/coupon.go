@@ -0,0 +1,366 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type CouponRuleType string
+
+const (
+	CouponRulePercentage CouponRuleType = "percentage"
+	CouponRuleFixed      CouponRuleType = "fixed_amount"
+	CouponRuleFreeItem   CouponRuleType = "free_item"
+	CouponRuleBuyXGetY   CouponRuleType = "buy_x_get_y"
+)
+
+// CouponRule describes what a coupon is worth. Which fields are used depends
+// on Type:
+//
+//   - percentage:  PercentOff of the eligible subtotal
+//   - fixed_amount: AmountOff, up to the eligible subtotal
+//   - free_item:   one unit of ProductID, which must be in the basket
+//   - buy_x_get_y: for every BuyQuantity+GetQuantity eligible units the
+//     GetQuantity cheapest are free; limited to ProductID when set
+//
+// MinBasket, MaxDiscount and Categories apply to every type. Zero values mean
+// "no minimum", "no cap" and "all categories".
+//
+// MaxRedemptions limits how many orders may redeem the code in total, and
+// MaxRedemptionsPerCustomer how many per customer ID. Zero means unlimited.
+// Customer IDs are not authenticated, so the per-customer limit only stops
+// customers who keep to their own ID.
+//
+// Hours restricts the code to recurring windows such as a weekday happy
+// hour, evaluated in TimeZone (UTC when empty). No Hours means any time.
+type CouponRule struct {
+	Type        CouponRuleType `json:"type"`
+	PercentOff  int64          `json:"percentOff,omitempty"`
+	AmountOff   Money          `json:"amountOff,omitempty"`
+	ProductID   string         `json:"productId,omitempty"`
+	BuyQuantity int            `json:"buyQuantity,omitempty"`
+	GetQuantity int            `json:"getQuantity,omitempty"`
+	MinBasket   Money          `json:"minBasket,omitempty"`
+	MaxDiscount Money          `json:"maxDiscount,omitempty"`
+	Categories  []string       `json:"categories,omitempty"`
+
+	MaxRedemptions            int `json:"maxRedemptions,omitempty"`
+	MaxRedemptionsPerCustomer int `json:"maxRedemptionsPerCustomer,omitempty"`
+
+	Hours    []CouponHours `json:"hours,omitempty"`
+	TimeZone string        `json:"timeZone,omitempty"`
+}
+
+// CouponHours is a daily window from From to To ("HH:MM", To exclusive) on
+// the listed Days ("mon" ... "sun", every day when empty). A window whose To
+// is not after From runs past midnight into the next day.
+type CouponHours struct {
+	Days []string `json:"days,omitempty"`
+	From string   `json:"from"`
+	To   string   `json:"to"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an HH:MM time", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (h CouponHours) Validate() error {
+	for _, d := range h.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("unknown day %q", d)
+		}
+	}
+	if _, err := parseClock(h.From); err != nil {
+		return err
+	}
+	_, err := parseClock(h.To)
+	return err
+}
+
+// onDay reports whether the window starts on d.
+func (h CouponHours) onDay(d time.Weekday) bool {
+	if len(h.Days) == 0 {
+		return true
+	}
+	for _, name := range h.Days {
+		if weekdays[strings.ToLower(name)] == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether t, already in the rule's time zone, falls in the
+// window. h must have passed Validate.
+func (h CouponHours) Contains(t time.Time) bool {
+	from, _ := parseClock(h.From)
+	to, _ := parseClock(h.To)
+	minute := t.Hour()*60 + t.Minute()
+
+	if from < to {
+		return h.onDay(t.Weekday()) && minute >= from && minute < to
+	}
+	// Past midnight: the evening part belongs to today's window, the early
+	// morning part to yesterday's.
+	return (h.onDay(t.Weekday()) && minute >= from) ||
+		(h.onDay(t.AddDate(0, 0, -1).Weekday()) && minute < to)
+}
+
+// Location returns the time zone the rule's Hours are evaluated in.
+func (r CouponRule) Location() (*time.Location, error) {
+	if r.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(r.TimeZone)
+}
+
+// InHours reports whether t falls in one of the rule's Hours, or true if it
+// has none. r must have passed Validate.
+func (r CouponRule) InHours(t time.Time) bool {
+	if len(r.Hours) == 0 {
+		return true
+	}
+	loc, err := r.Location()
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+	for _, h := range r.Hours {
+		if h.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r CouponRule) Validate() error {
+	switch r.Type {
+	case CouponRulePercentage:
+		if r.PercentOff <= 0 || r.PercentOff > 100 {
+			return errors.New("percentOff must be between 1 and 100")
+		}
+	case CouponRuleFixed:
+		if r.AmountOff <= 0 {
+			return errors.New("amountOff must be positive")
+		}
+	case CouponRuleFreeItem:
+		if r.ProductID == "" {
+			return errors.New("productId is required for free_item")
+		}
+	case CouponRuleBuyXGetY:
+		if r.BuyQuantity <= 0 || r.GetQuantity <= 0 {
+			return errors.New("buyQuantity and getQuantity must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown rule type %q", r.Type)
+	}
+
+	if r.MinBasket < 0 {
+		return errors.New("minBasket must not be negative")
+	}
+	if r.MaxDiscount < 0 {
+		return errors.New("maxDiscount must not be negative")
+	}
+	if r.MaxRedemptions < 0 || r.MaxRedemptionsPerCustomer < 0 {
+		return errors.New("redemption limits must not be negative")
+	}
+	for _, h := range r.Hours {
+		if err := h.Validate(); err != nil {
+			return fmt.Errorf("hours: %w", err)
+		}
+	}
+	if _, err := r.Location(); err != nil {
+		return fmt.Errorf("timeZone: %w", err)
+	}
+	return nil
+}
+
+type StackingPolicyType string
+
+const (
+	StackExclusive  StackingPolicyType = "exclusive"
+	StackBestSingle StackingPolicyType = "best_single"
+	StackUpTo       StackingPolicyType = "stack"
+	StackByCategory StackingPolicyType = "by_category"
+)
+
+// StackingPolicy decides which of several coupons submitted with one order
+// apply together:
+//
+//   - exclusive:   only the first applicable code, in request order
+//   - best_single: only the applicable code with the largest discount
+//   - stack:       the MaxCoupons applicable codes with the largest discounts
+//   - by_category: codes with the largest discounts first, skipping any
+//     code that discounts a product category already discounted by another;
+//     at most MaxCoupons codes when it is set
+//
+// The zero value is exclusive.
+type StackingPolicy struct {
+	Type       StackingPolicyType `json:"policy"`
+	MaxCoupons int                `json:"maxCoupons,omitempty"`
+}
+
+func (p StackingPolicy) Validate() error {
+	switch p.Type {
+	case "", StackExclusive, StackBestSingle, StackByCategory:
+	case StackUpTo:
+		if p.MaxCoupons < 1 {
+			return errors.New("maxCoupons must be positive for stack")
+		}
+	default:
+		return fmt.Errorf("unknown stacking policy %q", p.Type)
+	}
+	if p.MaxCoupons < 0 {
+		return errors.New("maxCoupons must not be negative")
+	}
+	return nil
+}
+
+// CouponValidity is the period a code is valid in: from StartsAt up to, but
+// not including, EndsAt. A zero bound is open.
+type CouponValidity struct {
+	StartsAt time.Time
+	EndsAt   time.Time
+}
+
+// IsZero reports whether the code is valid forever.
+func (v CouponValidity) IsZero() bool {
+	return v.StartsAt.IsZero() && v.EndsAt.IsZero()
+}
+
+// Equal reports whether v and o describe the same period.
+func (v CouponValidity) Equal(o CouponValidity) bool {
+	return v.StartsAt.Equal(o.StartsAt) && v.EndsAt.Equal(o.EndsAt)
+}
+
+// Check reports why the code is not valid at t, or "" if it is.
+func (v CouponValidity) Check(t time.Time) CouponRejection {
+	switch {
+	case !v.StartsAt.IsZero() && t.Before(v.StartsAt):
+		return CouponNotYetValid
+	case !v.EndsAt.IsZero() && !t.Before(v.EndsAt):
+		return CouponExpired
+	}
+	return ""
+}
+
+// CouponSource says how a stored code was added: by a cmd/preprocess load or
+// through the admin API.
+type CouponSource string
+
+const (
+	CouponSourcePreprocess CouponSource = "preprocess"
+	CouponSourceAdmin      CouponSource = "admin"
+)
+
+func (s CouponSource) Valid() bool {
+	return s == CouponSourcePreprocess || s == CouponSourceAdmin
+}
+
+// CouponCode is a code as kept by a store that can be administered. A code
+// with DisabledAt set is rejected until it is enabled again. Rule, when set,
+// was stored with the code and takes precedence over the rules file.
+type CouponCode struct {
+	Code       string
+	Source     CouponSource
+	Validity   CouponValidity
+	Rule       *CouponRule
+	DisabledAt *time.Time
+	CreatedAt  time.Time
+}
+
+// CouponActive is the Status of a code that can be redeemed.
+const CouponActive = "active"
+
+// Status describes the code at t: CouponActive, or the rejection an order
+// would get for it.
+func (c CouponCode) Status(t time.Time) string {
+	if c.DisabledAt != nil {
+		return string(CouponDisabled)
+	}
+	if reason := c.Validity.Check(t); reason != "" {
+		return string(reason)
+	}
+	return CouponActive
+}
+
+type Coupon struct {
+	Code string
+	Rule CouponRule
+}
+
+// CouponRejection says why a submitted coupon was not applied.
+type CouponRejection string
+
+const (
+	CouponUnknownCode    CouponRejection = "unknown_code"
+	CouponWrongLength    CouponRejection = "wrong_length"
+	CouponExpired        CouponRejection = "expired"
+	CouponDisabled       CouponRejection = "disabled"
+	CouponNotYetValid    CouponRejection = "not_yet_valid"
+	CouponOutsideHours   CouponRejection = "outside_hours"
+	CouponUsageExhausted CouponRejection = "usage_exhausted"
+	CouponBasketTooSmall CouponRejection = "basket_too_small"
+	CouponNotApplicable  CouponRejection = "not_applicable"
+
+	// CouponCustomerExhausted means the customer has used up their share of
+	// the code; CouponCustomerRequired that the code has a per-customer
+	// limit and the order names no customer.
+	CouponCustomerExhausted CouponRejection = "customer_usage_exhausted"
+	CouponCustomerRequired  CouponRejection = "customer_required"
+
+	// CouponNotStackable means the code applies on its own but the stacking
+	// policy chose other codes of the order; CouponDuplicate that it was
+	// submitted more than once.
+	CouponNotStackable CouponRejection = "not_stackable"
+	CouponDuplicate    CouponRejection = "duplicate"
+)
+
+// OrderCoupon records the outcome of one coupon submitted with an order:
+// either the applied rule and the discount it contributed, or the reason it
+// was rejected.
+type OrderCoupon struct {
+	Code     string          `json:"code"`
+	Applied  bool            `json:"applied"`
+	Reason   CouponRejection `json:"reason,omitempty"`
+	Rule     *CouponRule     `json:"rule,omitempty"`
+	Discount Money           `json:"discount"`
+}
+
+// CouponRedemptionDay is the number of orders that redeemed a code on one
+// UTC day and the discount they were given.
+type CouponRedemptionDay struct {
+	Code        string `json:"code"`
+	Day         string `json:"day"`
+	Redemptions int    `json:"redemptions"`
+	Discounts   Money  `json:"discounts"`
+}
+
+// LockoutKind says whom a coupon lockout applies to.
+type LockoutKind string
+
+const LockoutIP LockoutKind = "ip"
+
+// CouponLockout records a client that was refused coupon lookups after
+// submitting too many rejected codes. Subject is the IP address. Strike counts
+// the consecutive lockouts of the subject, each twice as long as the last.
+type CouponLockout struct {
+	Kind        LockoutKind `json:"kind"`
+	Subject     string      `json:"subject"`
+	Failures    int         `json:"failures"`
+	Strike      int         `json:"strike"`
+	LockedAt    time.Time   `json:"lockedAt"`
+	LockedUntil time.Time   `json:"lockedUntil"`
+}
@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in minor currency units (cents). It is carried
+// as-is from the NUMERIC(10,2) columns and encodes to JSON as a plain number
+// with two decimal places at most, e.g. 6.5 or 21.
+type Money int64
+
+// ParseMoney parses a decimal string such as "6.50", "6.5" or "21". More
+// than two significant fractional digits are rejected rather than rounded.
+func ParseMoney(s string) (Money, error) {
+	str := s
+	neg := false
+	if strings.HasPrefix(str, "-") {
+		neg = true
+		str = str[1:]
+	} else if strings.HasPrefix(str, "+") {
+		str = str[1:]
+	}
+
+	whole, frac, _ := strings.Cut(str, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("amount %q has more than two decimal places", s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	cents, _ := strconv.ParseInt(frac, 10, 64)
+	units := int64(0)
+	if whole != "" {
+		var err error
+		units, err = strconv.ParseInt(whole, 10, 64)
+		// units*100 + cents must not wrap around.
+		if err != nil || units > (math.MaxInt64-cents)/100 {
+			return 0, fmt.Errorf("amount %q out of range", s)
+		}
+	}
+
+	m := Money(units*100 + cents)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Mul returns m multiplied by a whole quantity, or an error if the product
+// does not fit in a Money.
+func (m Money) Mul(n int) (Money, error) {
+	p := int64(m) * int64(n)
+	if n != 0 && (p/int64(n) != int64(m) || (m == math.MinInt64 && n == -1)) {
+		return 0, fmt.Errorf("amount %s times %d out of range", m, n)
+	}
+	return Money(p), nil
+}
+
+// Percent returns pct percent of m, rounded half away from zero to the
+// nearest cent.
+func (m Money) Percent(pct int64) Money {
+	return Money(divRound(int64(m)*pct, 100))
+}
+
+func divRound(n, d int64) int64 {
+	if (n < 0) != (d < 0) {
+		return (n - d/2) / d
+	}
+	return (n + d/2) / d
+}
+
+// String formats m with exactly two decimal places, as stored in Postgres.
+func (m Money) String() string {
+	sign, units, cents := m.parts()
+	return fmt.Sprintf("%s%d.%02d", sign, units, cents)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	sign, units, cents := m.parts()
+	switch {
+	case cents == 0:
+		return fmt.Appendf(nil, "%s%d", sign, units), nil
+	case cents%10 == 0:
+		return fmt.Appendf(nil, "%s%d.%d", sign, units, cents/10), nil
+	default:
+		return fmt.Appendf(nil, "%s%d.%02d", sign, units, cents), nil
+	}
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	parsed, err := ParseMoney(strings.Trim(string(b), `"`))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) parts() (sign string, units, cents int64) {
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return sign, v / 100, v % 100
+}
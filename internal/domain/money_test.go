@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "6.50", want: 650},
+		{in: "6.5", want: 650},
+		{in: "21", want: 2100},
+		{in: "0.05", want: 5},
+		{in: "-1.30", want: -130},
+		{in: "1.230", want: 123},
+		{in: "1.234", wantErr: true},
+		{in: "1e2", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "92233720368547758.07", want: math.MaxInt64},
+		{in: "92233720368547758.08", wantErr: true},
+		{in: "92233720368547758.99", wantErr: true},
+		{in: "-92233720368547758.99", wantErr: true},
+		{in: "99999999999999999999", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q): expected error, got %d", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{in: 2100, want: "21"},
+		{in: 650, want: "6.5"},
+		{in: 1170, want: "11.7"},
+		{in: 1999, want: "19.99"},
+		{in: 5, want: "0.05"},
+		{in: -130, want: "-1.3"},
+	}
+
+	for _, tt := range tests {
+		b, err := json.Marshal(tt.in)
+		if err != nil {
+			t.Fatalf("marshal %d: %v", tt.in, err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("marshal %d = %s, want %s", tt.in, b, tt.want)
+		}
+
+		var back Money
+		if err := json.Unmarshal(b, &back); err != nil {
+			t.Fatalf("unmarshal %s: %v", b, err)
+		}
+		if back != tt.in {
+			t.Errorf("round trip %d = %d", tt.in, back)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		in   Money
+		pct  int64
+		want Money
+	}{
+		{in: 1300, pct: 10, want: 130},
+		{in: 1305, pct: 10, want: 131},
+		{in: 1304, pct: 10, want: 130},
+		{in: 5, pct: 10, want: 1},
+		{in: 333333, pct: 15, want: 50000},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.Percent(tt.pct); got != tt.want {
+			t.Errorf("%s.Percent(%d) = %s, want %s", tt.in, tt.pct, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyMul(t *testing.T) {
+	tests := []struct {
+		m       Money
+		n       int
+		want    Money
+		wantErr bool
+	}{
+		{m: 650, n: 3, want: 1950},
+		{m: 650, n: 0, want: 0},
+		{m: -130, n: 2, want: -260},
+		{m: math.MaxInt64, n: 1, want: math.MaxInt64},
+		{m: math.MaxInt64 / 2, n: 2, want: math.MaxInt64 - 1},
+		{m: math.MaxInt64/2 + 1, n: 2, wantErr: true},
+		{m: 999999999999, n: math.MaxInt32, wantErr: true},
+		{m: math.MinInt64, n: -1, wantErr: true},
+		{m: -1, n: math.MinInt64, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.m.Mul(tt.n)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%d.Mul(%d): expected error, got %d", tt.m, tt.n, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d.Mul(%d): unexpected error: %v", tt.m, tt.n, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%d.Mul(%d) = %d, want %d", tt.m, tt.n, got, tt.want)
+		}
+	}
+}
@@ -1,14 +1,79 @@
 package domain
 
+import "time"
+
+// Order.CouponCode and Coupon describe the first coupon submitted with the
+// order; Coupons breaks down every submitted coupon in request order.
 type Order struct {
-	ID        string      `json:"id"`
-	Items     []OrderItem `json:"items"`
-	Total     float64     `json:"total"`
-	Discounts float64     `json:"discounts"`
-	Products  []Product   `json:"products"`
+	ID            string              `json:"id"`
+	Items         []OrderLine         `json:"items"`
+	CouponCode    string              `json:"couponCode,omitempty"`
+	Coupon        *OrderCoupon        `json:"coupon,omitempty"`
+	Coupons       []OrderCoupon       `json:"coupons,omitempty"`
+	Total         Money               `json:"total"`
+	Discounts     Money               `json:"discounts"`
+	Products      []Product           `json:"products"`
+	Status        OrderStatus         `json:"status"`
+	StatusHistory []OrderStatusChange `json:"statusHistory,omitempty"`
+	CreatedAt     time.Time           `json:"createdAt"`
 }
 
 type OrderItem struct {
 	ProductID string `json:"productId"`
 	Quantity  int    `json:"quantity"`
 }
+
+// OrderLine is an ordered item together with the product name and price
+// captured at checkout, so the order stays reproducible after the menu
+// changes.
+type OrderLine struct {
+	ProductID   string `json:"productId"`
+	ProductName string `json:"productName"`
+	Quantity    int    `json:"quantity"`
+	UnitPrice   Money  `json:"unitPrice"`
+	LineTotal   Money  `json:"lineTotal"`
+}
+
+type OrderStatus string
+
+const (
+	OrderStatusPlaced    OrderStatus = "placed"
+	OrderStatusAccepted  OrderStatus = "accepted"
+	OrderStatusPreparing OrderStatus = "preparing"
+	OrderStatusReady     OrderStatus = "ready"
+	OrderStatusCompleted OrderStatus = "completed"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRejected  OrderStatus = "rejected"
+)
+
+// orderStatusTransitions lists, for every status, the statuses an order may
+// move to next. Statuses with no entry are terminal.
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPlaced:    {OrderStatusAccepted, OrderStatusRejected, OrderStatusCancelled},
+	OrderStatusAccepted:  {OrderStatusPreparing, OrderStatusCancelled},
+	OrderStatusPreparing: {OrderStatusReady, OrderStatusCancelled},
+	OrderStatusReady:     {OrderStatusCompleted},
+	OrderStatusCompleted: nil,
+	OrderStatusCancelled: nil,
+	OrderStatusRejected:  nil,
+}
+
+func (s OrderStatus) Valid() bool {
+	_, ok := orderStatusTransitions[s]
+	return ok
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+type OrderStatusChange struct {
+	From      OrderStatus `json:"from,omitempty"`
+	To        OrderStatus `json:"to"`
+	ChangedAt time.Time   `json:"changedAt"`
+}
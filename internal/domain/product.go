@@ -3,7 +3,7 @@ package domain
 type Product struct {
 	ID       string        `json:"id"`
 	Name     string        `json:"name"`
-	Price    float64       `json:"price"`
+	Price    Money         `json:"price"`
 	Category string        `json:"category"`
 	Image    *ProductImage `json:"image,omitempty"`
 }
@@ -14,3 +14,23 @@ type ProductImage struct {
 	Tablet    string `json:"tablet"`
 	Desktop   string `json:"desktop"`
 }
+
+// ProductSort is the order products are listed in. The empty sort is menu
+// order: by id, with numeric ids in numeric order.
+type ProductSort string
+
+const (
+	ProductSortMenu      ProductSort = ""
+	ProductSortName      ProductSort = "name"
+	ProductSortNameDesc  ProductSort = "-name"
+	ProductSortPrice     ProductSort = "price"
+	ProductSortPriceDesc ProductSort = "-price"
+)
+
+func (s ProductSort) Valid() bool {
+	switch s {
+	case ProductSortMenu, ProductSortName, ProductSortNameDesc, ProductSortPrice, ProductSortPriceDesc:
+		return true
+	}
+	return false
+}
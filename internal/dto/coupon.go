@@ -0,0 +1,62 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+)
+
+type CreateCouponRequest struct {
+	Code string `json:"code"`
+	// StartsAt and EndsAt bound the validity period; either may be omitted.
+	StartsAt *time.Time `json:"startsAt,omitempty"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"`
+	// Rule is stored with the code and takes precedence over the rules
+	// file. Without it the code uses the rules file.
+	Rule *domain.CouponRule `json:"rule,omitempty"`
+}
+
+type CouponResponse struct {
+	Code   string              `json:"code"`
+	Source domain.CouponSource `json:"source"`
+	// Status is "active", "disabled", "not_yet_valid" or "expired".
+	Status     string            `json:"status"`
+	StartsAt   *time.Time        `json:"startsAt,omitempty"`
+	EndsAt     *time.Time        `json:"endsAt,omitempty"`
+	DisabledAt *time.Time        `json:"disabledAt,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	Rule       domain.CouponRule `json:"rule"`
+	// Redemptions is only reported when a single coupon is inspected.
+	Redemptions *int `json:"redemptions,omitempty"`
+}
+
+type CouponListResponse struct {
+	Coupons    []CouponResponse `json:"coupons"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+type CouponUploadResponse struct {
+	Codes   int   `json:"codes"`
+	Added   int64 `json:"added"`
+	Updated int64 `json:"updated"`
+}
+
+func FromCouponCode(c domain.CouponCode, status string, rule domain.CouponRule) CouponResponse {
+	return CouponResponse{
+		Code:       c.Code,
+		Source:     c.Source,
+		Status:     status,
+		StartsAt:   timeOrNil(c.Validity.StartsAt),
+		EndsAt:     timeOrNil(c.Validity.EndsAt),
+		DisabledAt: c.DisabledAt,
+		CreatedAt:  c.CreatedAt,
+		Rule:       rule,
+	}
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -1,18 +1,76 @@
 package dto
 
-import "github.com/Sanjaiy/foodieapp/internal/domain"
+import (
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+)
 
 type OrderRequest struct {
-	CouponCode string             `json:"couponCode,omitempty"`
-	Items      []domain.OrderItem `json:"items"`
+	// CustomerID is only needed for coupons with a per-customer limit. It is
+	// taken on trust: the API key identifies the app, not the customer, so
+	// a caller can claim any ID.
+	CustomerID string `json:"customerId,omitempty"`
+	CouponCode string `json:"couponCode,omitempty"`
+	// CouponCodes submits several coupons instead of CouponCode.
+	CouponCodes []string           `json:"couponCodes,omitempty"`
+	Items       []domain.OrderItem `json:"items"`
+	// StrictCoupon rejects the order with 422 instead of placing it when
+	// any submitted coupon does not apply.
+	StrictCoupon bool `json:"strictCoupon,omitempty"`
 }
 
 type OrderResponse struct {
-	ID        string             `json:"id"`
-	Items     []domain.OrderItem `json:"items"`
-	Total     float64            `json:"total"`
-	Discounts float64            `json:"discounts"`
-	Products  []domain.Product   `json:"products"`
+	ID            string                     `json:"id"`
+	Items         []domain.OrderLine         `json:"items"`
+	CouponCode    string                     `json:"couponCode,omitempty"`
+	Coupon        *domain.OrderCoupon        `json:"coupon,omitempty"`
+	Coupons       []domain.OrderCoupon       `json:"coupons,omitempty"`
+	Total         domain.Money               `json:"total"`
+	Discounts     domain.Money               `json:"discounts"`
+	Products      []domain.Product           `json:"products"`
+	Status        domain.OrderStatus         `json:"status"`
+	StatusHistory []domain.OrderStatusChange `json:"statusHistory,omitempty"`
+	CreatedAt     time.Time                  `json:"createdAt"`
+}
+
+type QuoteResponse struct {
+	Items     []domain.OrderLine   `json:"items"`
+	Coupon    *domain.OrderCoupon  `json:"coupon,omitempty"`
+	Coupons   []domain.OrderCoupon `json:"coupons,omitempty"`
+	Subtotal  domain.Money         `json:"subtotal"`
+	Discounts domain.Money         `json:"discounts"`
+	Total     domain.Money         `json:"total"`
+}
+
+type OrderSummary struct {
+	ID         string             `json:"id"`
+	CouponCode string             `json:"couponCode,omitempty"`
+	Total      domain.Money       `json:"total"`
+	Discounts  domain.Money       `json:"discounts"`
+	Status     domain.OrderStatus `json:"status"`
+	CreatedAt  time.Time          `json:"createdAt"`
+}
+
+type RedemptionReport struct {
+	From time.Time                    `json:"from"`
+	To   time.Time                    `json:"to"`
+	Days []domain.CouponRedemptionDay `json:"days"`
+}
+
+type LockoutReport struct {
+	From     time.Time              `json:"from"`
+	To       time.Time              `json:"to"`
+	Lockouts []domain.CouponLockout `json:"lockouts"`
+}
+
+type OrderStatusRequest struct {
+	Status domain.OrderStatus `json:"status"`
+}
+
+type OrderListResponse struct {
+	Orders     []OrderSummary `json:"orders"`
+	NextCursor string         `json:"nextCursor,omitempty"`
 }
 
 func FromDomainOrder(o *domain.Order) *OrderResponse {
@@ -20,11 +78,48 @@ func FromDomainOrder(o *domain.Order) *OrderResponse {
 		return nil
 	}
 	return &OrderResponse{
-		ID:        o.ID,
-		Items:     o.Items,
-		Total:     o.Total,
-		Discounts: o.Discounts,
-		Products:  o.Products,
+		ID:            o.ID,
+		Items:         o.Items,
+		CouponCode:    o.CouponCode,
+		Coupon:        o.Coupon,
+		Coupons:       o.Coupons,
+		Total:         o.Total,
+		Discounts:     o.Discounts,
+		Products:      o.Products,
+		Status:        o.Status,
+		StatusHistory: o.StatusHistory,
+		CreatedAt:     o.CreatedAt,
+	}
+}
+
+// FromQuote reports coupon, the first evaluated code, beside the full
+// coupons breakdown.
+func FromQuote(items []domain.OrderLine, coupon *domain.OrderCoupon, coupons []domain.OrderCoupon, subtotal, discounts, total domain.Money) *QuoteResponse {
+	return &QuoteResponse{
+		Items:     items,
+		Coupon:    coupon,
+		Coupons:   coupons,
+		Subtotal:  subtotal,
+		Discounts: discounts,
+		Total:     total,
+	}
+}
+
+func FromDomainOrders(orders []domain.Order, nextCursor string) *OrderListResponse {
+	summaries := make([]OrderSummary, len(orders))
+	for i, o := range orders {
+		summaries[i] = OrderSummary{
+			ID:         o.ID,
+			CouponCode: o.CouponCode,
+			Total:      o.Total,
+			Discounts:  o.Discounts,
+			Status:     o.Status,
+			CreatedAt:  o.CreatedAt,
+		}
+	}
+	return &OrderListResponse{
+		Orders:     summaries,
+		NextCursor: nextCursor,
 	}
 }
 
@@ -0,0 +1,28 @@
+package dto
+
+import "github.com/Sanjaiy/foodieapp/internal/domain"
+
+// ProductRequest is the body of POST and PUT /api/product. Image may be
+// omitted; so may any of its URLs.
+type ProductRequest struct {
+	Name     string               `json:"name"`
+	Price    domain.Money         `json:"price"`
+	Category string               `json:"category"`
+	Image    *domain.ProductImage `json:"image,omitempty"`
+}
+
+// ProductPatchRequest is the body of PATCH /api/product/{productId}. Only
+// the fields present are changed.
+type ProductPatchRequest struct {
+	Name     *string            `json:"name,omitempty"`
+	Price    *domain.Money      `json:"price,omitempty"`
+	Category *string            `json:"category,omitempty"`
+	Image    *ProductImagePatch `json:"image,omitempty"`
+}
+
+type ProductImagePatch struct {
+	Thumbnail *string `json:"thumbnail,omitempty"`
+	Mobile    *string `json:"mobile,omitempty"`
+	Tablet    *string `json:"tablet,omitempty"`
+	Desktop   *string `json:"desktop,omitempty"`
+}
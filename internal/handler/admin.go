@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/dto"
+	"github.com/Sanjaiy/foodieapp/internal/service"
+)
+
+// maxCouponUploadBytes bounds the body of a bulk coupon upload.
+const maxCouponUploadBytes = 64 << 20
+
+type AdminHandler struct {
+	promo  *service.PromoService
+	orders *service.OrderService
+}
+
+func NewAdminHandler(promo *service.PromoService, orders *service.OrderService) *AdminHandler {
+	return &AdminHandler{promo: promo, orders: orders}
+}
+
+func (h *AdminHandler) ReloadCoupons(w http.ResponseWriter, r *http.Request) {
+	if err := h.promo.ReloadCodes(); err != nil {
+		if errors.Is(err, service.ErrReloadUnsupported) {
+			writeError(w, http.StatusConflict, "conflict", err.Error())
+			return
+		}
+		log.Printf("ERROR: reloading promo codes: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal", "failed to reload coupon codes")
+		return
+	}
+
+	h.CouponStatus(w, r)
+}
+
+func (h *AdminHandler) CouponStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.promo.CodesStatus()
+	if err != nil {
+		writeError(w, http.StatusConflict, "conflict", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// CouponRedemptions reports redemptions per code per day. from and to take
+// the same formats as the order list filters; code limits it to one code.
+func (h *AdminHandler) CouponRedemptions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params := service.RedemptionReportParams{CouponCode: q.Get("code")}
+
+	var err error
+	if params.From, err = parseTimeParam(q, "from"); err != nil {
+		writeError(w, http.StatusBadRequest, "validation", err.Error())
+		return
+	}
+	if params.To, err = parseTimeParam(q, "to"); err != nil {
+		writeError(w, http.StatusBadRequest, "validation", err.Error())
+		return
+	}
+	if params.From != nil && params.To != nil && !params.From.Before(*params.To) {
+		writeError(w, http.StatusBadRequest, "validation", "from must be before to")
+		return
+	}
+
+	report, err := h.orders.RedemptionReport(r.Context(), params)
+	if err != nil {
+		log.Printf("ERROR: reporting coupon redemptions: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal", "failed to report coupon redemptions")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dto.RedemptionReport{From: report.From, To: report.To, Days: report.Days})
+}
+
+// CouponLockouts lists the clients locked out of coupon lookups, newest
+// first. from and to take the same formats as CouponRedemptions; subject
+// limits it to one IP address.
+func (h *AdminHandler) CouponLockouts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params := service.LockoutReportParams{Subject: q.Get("subject")}
+
+	var err error
+	if params.From, err = parseTimeParam(q, "from"); err != nil {
+		writeError(w, http.StatusBadRequest, "validation", err.Error())
+		return
+	}
+	if params.To, err = parseTimeParam(q, "to"); err != nil {
+		writeError(w, http.StatusBadRequest, "validation", err.Error())
+		return
+	}
+	if params.From != nil && params.To != nil && !params.From.Before(*params.To) {
+		writeError(w, http.StatusBadRequest, "validation", "from must be before to")
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > service.MaxLockoutPageSize {
+			writeError(w, http.StatusBadRequest, "validation", "limit must be between 1 and "+strconv.Itoa(service.MaxLockoutPageSize))
+			return
+		}
+		params.Limit = limit
+	}
+
+	report, err := h.promo.LockoutReport(r.Context(), params)
+	if err != nil {
+		if errors.Is(err, service.ErrLockoutsUnsupported) {
+			writeError(w, http.StatusConflict, "conflict", err.Error())
+			return
+		}
+		log.Printf("ERROR: reporting coupon lockouts: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal", "failed to report coupon lockouts")
+		return
+	}
+
+	resp := dto.LockoutReport{From: report.From, To: report.To, Lockouts: report.Lockouts}
+	if resp.Lockouts == nil {
+		resp.Lockouts = []domain.CouponLockout{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *AdminHandler) ListCoupons(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListCouponsParams(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "validation", err.Error())
+		return
+	}
+
+	page, err := h.promo.ListCoupons(r.Context(), params)
+	if err != nil {
+		writeCouponError(w, err, "failed to list coupons")
+		return
+	}
+
+	resp := dto.CouponListResponse{
+		Coupons:    make([]dto.CouponResponse, len(page.Coupons)),
+		NextCursor: page.NextCursor,
+	}
+	for i, c := range page.Coupons {
+		resp.Coupons[i] = dto.FromCouponCode(c.CouponCode, c.Status, c.Rule)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseListCouponsParams(q url.Values) (service.ListCouponsParams, error) {
+	params := service.ListCouponsParams{
+		Source: domain.CouponSource(q.Get("source")),
+		Cursor: q.Get("cursor"),
+	}
+	if params.Source != "" && !params.Source.Valid() {
+		return params, errors.New("source must be preprocess or admin")
+	}
+
+	if v := q.Get("disabled"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return params, errors.New("disabled must be true or false")
+		}
+		params.Disabled = &disabled
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > service.MaxCouponPageSize {
+			return params, errors.New("limit must be between 1 and " + strconv.Itoa(service.MaxCouponPageSize))
+		}
+		params.Limit = limit
+	}
+
+	return params, nil
+}
+
+// GetCoupon reports a stored code with its rule and redemption count.
+func (h *AdminHandler) GetCoupon(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+
+	coupon, err := h.promo.GetCoupon(r.Context(), code)
+	if err != nil {
+		writeCouponError(w, err, "failed to get coupon")
+		return
+	}
+
+	redemptions, err := h.orders.CouponRedemptions(r.Context(), code)
+	if err != nil {
+		log.Printf("ERROR: counting redemptions of %s: %v", code, err)
+		writeError(w, http.StatusInternalServerError, "internal", "failed to get coupon")
+		return
+	}
+
+	resp := dto.FromCouponCode(coupon.CouponCode, coupon.Status, coupon.Rule)
+	resp.Redemptions = &redemptions
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *AdminHandler) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req dto.CreateCouponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "validation", "invalid JSON body")
+		return
+	}
+
+	coupon, err := h.promo.CreateCoupon(r.Context(), service.CreateCouponInput{
+		Code:     req.Code,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+		Rule:     req.Rule,
+	})
+	if err != nil {
+		writeCouponError(w, err, "failed to create coupon")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, dto.FromCouponCode(coupon.CouponCode, coupon.Status, coupon.Rule))
+}
+
+func (h *AdminHandler) DisableCoupon(w http.ResponseWriter, r *http.Request) {
+	h.setCouponDisabled(w, r, true)
+}
+
+func (h *AdminHandler) EnableCoupon(w http.ResponseWriter, r *http.Request) {
+	h.setCouponDisabled(w, r, false)
+}
+
+func (h *AdminHandler) setCouponDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	coupon, err := h.promo.SetCouponDisabled(r.Context(), r.PathValue("code"), disabled)
+	if err != nil {
+		writeCouponError(w, err, "failed to update coupon")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dto.FromCouponCode(coupon.CouponCode, coupon.Status, coupon.Rule))
+}
+
+// UploadCoupons merges a plain-text code list into the stored codes. The
+// body uses the preprocessor's input format.
+func (h *AdminHandler) UploadCoupons(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxCouponUploadBytes)
+
+	upload, err := h.promo.UploadCoupons(r.Context(), body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "validation", "upload must not exceed "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+			return
+		}
+		writeCouponError(w, err, "failed to upload coupons")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dto.CouponUploadResponse{
+		Codes:   upload.Codes,
+		Added:   upload.Added,
+		Updated: upload.Updated,
+	})
+}
+
+func writeCouponError(w http.ResponseWriter, err error, internalMsg string) {
+	switch {
+	case errors.Is(err, service.ErrCouponAdminUnsupported), errors.Is(err, service.ErrCouponExists):
+		writeError(w, http.StatusConflict, "conflict", err.Error())
+	case errors.Is(err, service.ErrCouponNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Coupon not found")
+	case errors.Is(err, service.ErrInvalidCoupon), errors.Is(err, service.ErrInvalidCursor):
+		writeError(w, http.StatusBadRequest, "validation", err.Error())
+	default:
+		log.Printf("ERROR: %s: %v", internalMsg, err)
+		writeError(w, http.StatusInternalServerError, "internal", internalMsg)
+	}
+}
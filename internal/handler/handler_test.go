@@ -3,9 +3,16 @@ package handler_test
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Sanjaiy/foodieapp/internal/domain"
 	"github.com/Sanjaiy/foodieapp/internal/dto"
@@ -14,6 +21,8 @@ import (
 var (
 	baseURL = getEnv("TEST_BASE_URL", "http://localhost:8080")
 	apiKey  = getEnv("TEST_API_KEY", "apitest")
+	// adminKey is the server's ADMIN_API_KEY, needed by the staff endpoints.
+	adminKey = getEnv("TEST_ADMIN_API_KEY", "admintest")
 )
 
 func getEnv(key, fallback string) string {
@@ -50,6 +59,104 @@ func TestListProducts(t *testing.T) {
 	}
 }
 
+func listProducts(t *testing.T, query string) *http.Response {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/api/product?" + query)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestListProductsFilters(t *testing.T) {
+	resp := listProducts(t, "category=Cake&category=Pie&minPrice=4&maxPrice=6&sort=-price")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var products []domain.Product
+	json.NewDecoder(resp.Body).Decode(&products)
+	if len(products) == 0 {
+		t.Fatal("expected seeded cakes and pies, got none")
+	}
+	for i, p := range products {
+		if (p.Category != "Cake" && p.Category != "Pie") || p.Price < 400 || p.Price > 600 {
+			t.Errorf("product does not match the filters: %+v", p)
+		}
+		if i > 0 && p.Price > products[i-1].Price {
+			t.Errorf("expected descending prices, got %s after %s", p.Price, products[i-1].Price)
+		}
+	}
+
+	search := listProducts(t, "q=vanilla")
+	defer search.Body.Close()
+	json.NewDecoder(search.Body).Decode(&products)
+	if len(products) == 0 {
+		t.Fatal("expected vanilla desserts, got none")
+	}
+	for _, p := range products {
+		if !strings.Contains(strings.ToLower(p.Name), "vanilla") {
+			t.Errorf("product does not match the search: %+v", p)
+		}
+	}
+}
+
+func TestListProductsPagination(t *testing.T) {
+	seen := map[string]bool{}
+	query := "sort=name&limit=2"
+	for page := 0; ; page++ {
+		if page > 100 {
+			t.Fatal("pagination did not terminate")
+		}
+		resp := listProducts(t, query)
+		var products []domain.Product
+		json.NewDecoder(resp.Body).Decode(&products)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || len(products) > 2 {
+			t.Fatalf("unexpected page: %d with %d products", resp.StatusCode, len(products))
+		}
+		for _, p := range products {
+			if seen[p.ID] {
+				t.Errorf("product %s listed twice", p.ID)
+			}
+			seen[p.ID] = true
+		}
+
+		cursor := resp.Header.Get("Next-Cursor")
+		if cursor == "" {
+			break
+		}
+		query = "sort=name&limit=2&cursor=" + url.QueryEscape(cursor)
+	}
+	if len(seen) < 9 {
+		t.Errorf("expected every seeded product, got %d", len(seen))
+	}
+
+	// Without limit or cursor the whole catalog comes back at once.
+	resp := listProducts(t, "sort=name")
+	defer resp.Body.Close()
+	var all []domain.Product
+	json.NewDecoder(resp.Body).Decode(&all)
+	if len(all) != len(seen) || resp.Header.Get("Next-Cursor") != "" {
+		t.Errorf("expected all %d products in one response, got %d (Next-Cursor %q)", len(seen), len(all), resp.Header.Get("Next-Cursor"))
+	}
+}
+
+func TestListProductsBadParams(t *testing.T) {
+	for _, query := range []string{
+		"limit=0", "limit=abc", "sort=rating", "minPrice=-1", "minPrice=5&maxPrice=1",
+		"category=Soup", "cursor=!!!", "q=" + strings.Repeat("a", 101),
+	} {
+		resp := listProducts(t, query)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
 func TestGetProductFound(t *testing.T) {
 	resp, err := http.Get(baseURL + "/api/product/1")
 	if err != nil {
@@ -120,11 +227,11 @@ func TestPlaceOrderWithoutCoupon(t *testing.T) {
 		t.Error("expected order ID, got empty")
 	}
 	// 6.50*2 + 8.00*1 = 21.00
-	if order.Total != 21.0 {
-		t.Errorf("expected total 21.00, got %.2f", order.Total)
+	if order.Total != 2100 {
+		t.Errorf("expected total 21.00, got %s", order.Total)
 	}
 	if order.Discounts != 0 {
-		t.Errorf("expected 0 discounts, got %.2f", order.Discounts)
+		t.Errorf("expected 0 discounts, got %s", order.Discounts)
 	}
 }
 
@@ -145,11 +252,15 @@ func TestPlaceOrderWithValidCoupon(t *testing.T) {
 	json.NewDecoder(resp.Body).Decode(&order)
 
 	// 6.50*2 = 13.00, 10% discount = 1.30, total = 11.70
-	if order.Discounts != 1.3 {
-		t.Errorf("expected discount 1.30, got %.2f", order.Discounts)
+	if order.Discounts != 130 {
+		t.Errorf("expected discount 1.30, got %s", order.Discounts)
 	}
-	if order.Total != 11.7 {
-		t.Errorf("expected total 11.70, got %.2f", order.Total)
+	if order.Total != 1170 {
+		t.Errorf("expected total 11.70, got %s", order.Total)
+	}
+	if order.Coupon == nil || !order.Coupon.Applied || order.Coupon.Discount != 130 ||
+		order.Coupon.Rule == nil || order.Coupon.Rule.Type != domain.CouponRulePercentage {
+		t.Errorf("expected applied percentage coupon, got %+v", order.Coupon)
 	}
 }
 
@@ -169,11 +280,908 @@ func TestPlaceOrderWithInvalidCoupon(t *testing.T) {
 	var order dto.OrderResponse
 	json.NewDecoder(resp.Body).Decode(&order)
 
-	// Invalid coupon → no discount
-	if order.Total != 13.0 {
-		t.Errorf("expected total 13.00, got %.2f", order.Total)
+	// Invalid coupon → no discount, with the reason reported
+	if order.Total != 1300 {
+		t.Errorf("expected total 13.00, got %s", order.Total)
 	}
 	if order.Discounts != 0 {
-		t.Errorf("expected 0 discounts, got %.2f", order.Discounts)
+		t.Errorf("expected 0 discounts, got %s", order.Discounts)
+	}
+	if order.Coupon == nil || order.Coupon.Applied || order.Coupon.Reason != domain.CouponUnknownCode {
+		t.Errorf("expected coupon rejected as unknown_code, got %+v", order.Coupon)
+	}
+}
+
+func TestPlaceOrderWithWrongLengthCoupon(t *testing.T) {
+	resp := postOrder(t, dto.OrderRequest{
+		Items:      []domain.OrderItem{{ProductID: "1", Quantity: 1}},
+		CouponCode: "SHORT",
+	})
+	defer resp.Body.Close()
+
+	var order dto.OrderResponse
+	json.NewDecoder(resp.Body).Decode(&order)
+
+	if order.Coupon == nil || order.Coupon.Applied || order.Coupon.Reason != domain.CouponWrongLength {
+		t.Errorf("expected coupon rejected as wrong_length, got %+v", order.Coupon)
+	}
+}
+
+func TestPlaceOrderStrictCoupon(t *testing.T) {
+	resp := postOrder(t, dto.OrderRequest{
+		Items:        []domain.OrderItem{{ProductID: "1", Quantity: 2}},
+		CouponCode:   "FAKECODE1",
+		StrictCoupon: true,
+	})
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", resp.StatusCode)
+	}
+
+	var errResp dto.ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	if errResp.Code != "coupon_rejected" {
+		t.Errorf("expected code coupon_rejected, got %q", errResp.Code)
+	}
+}
+
+func getOrder(t *testing.T, id string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, baseURL+"/api/order/"+id, nil)
+	req.Header.Set("api_key", apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestGetOrderFound(t *testing.T) {
+	resp := postOrder(t, dto.OrderRequest{
+		Items: []domain.OrderItem{
+			{ProductID: "1", Quantity: 2},
+			{ProductID: "3", Quantity: 1},
+		},
+		CouponCode: "OVER9000",
+	})
+	defer resp.Body.Close()
+
+	var placed dto.OrderResponse
+	json.NewDecoder(resp.Body).Decode(&placed)
+	if placed.ID == "" {
+		t.Fatal("expected order ID, got empty")
+	}
+
+	getResp := getOrder(t, placed.ID)
+	defer getResp.Body.Close()
+
+	if getResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", getResp.StatusCode)
+	}
+
+	var order dto.OrderResponse
+	if err := json.NewDecoder(getResp.Body).Decode(&order); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if order.ID != placed.ID {
+		t.Errorf("expected id %q, got %q", placed.ID, order.ID)
+	}
+	if order.Total != placed.Total || order.Discounts != placed.Discounts {
+		t.Errorf("expected total/discounts %s/%s, got %s/%s",
+			placed.Total, placed.Discounts, order.Total, order.Discounts)
+	}
+	if len(order.Items) != 2 {
+		t.Errorf("expected 2 items, got %d", len(order.Items))
+	}
+	if len(order.Products) != 2 {
+		t.Errorf("expected 2 products, got %d", len(order.Products))
+	}
+}
+
+func TestGetOrderNotFound(t *testing.T) {
+	for _, id := range []string{"00000000-0000-0000-0000-000000000000", "not-a-uuid"} {
+		resp := getOrder(t, id)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", id, resp.StatusCode)
+		}
+	}
+}
+
+func TestGetOrderUnauthorized(t *testing.T) {
+	resp, err := http.Get(baseURL + "/api/order/00000000-0000-0000-0000-000000000000")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+}
+
+func listOrders(t *testing.T, query string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, baseURL+"/api/order?"+query, nil)
+	req.Header.Set("api_key", apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestListOrdersPagination(t *testing.T) {
+	for range 2 {
+		resp := postOrder(t, dto.OrderRequest{
+			Items: []domain.OrderItem{{ProductID: "2", Quantity: 1}},
+		})
+		resp.Body.Close()
+	}
+
+	resp := listOrders(t, "limit=1")
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var first dto.OrderListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&first); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(first.Orders) != 1 {
+		t.Fatalf("expected 1 order, got %d", len(first.Orders))
+	}
+	if first.NextCursor == "" {
+		t.Fatal("expected nextCursor, got empty")
+	}
+
+	resp2 := listOrders(t, "limit=1&cursor="+first.NextCursor)
+	defer resp2.Body.Close()
+
+	var second dto.OrderListResponse
+	if err := json.NewDecoder(resp2.Body).Decode(&second); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(second.Orders) != 1 {
+		t.Fatalf("expected 1 order, got %d", len(second.Orders))
+	}
+	if second.Orders[0].ID == first.Orders[0].ID {
+		t.Error("expected a different order on the second page")
+	}
+	if second.Orders[0].CreatedAt.After(first.Orders[0].CreatedAt) {
+		t.Error("expected orders in descending created_at order")
+	}
+}
+
+func TestListOrdersFilters(t *testing.T) {
+	resp := listOrders(t, "couponCode=OVER9000&minTotal=1&maxTotal=1000")
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var page dto.OrderListResponse
+	json.NewDecoder(resp.Body).Decode(&page)
+
+	for _, o := range page.Orders {
+		if o.CouponCode != "OVER9000" {
+			t.Errorf("expected coupon OVER9000, got %q", o.CouponCode)
+		}
+		if o.Total < 100 || o.Total > 100000 {
+			t.Errorf("total %s outside filter range", o.Total)
+		}
+	}
+}
+
+func TestListOrdersBadParams(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=abc", "from=yesterday", "minTotal=-1", "minTotal=5&maxTotal=1", "cursor=!!!"} {
+		resp := listOrders(t, query)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func patchOrderStatus(t *testing.T, id string, status domain.OrderStatus) *http.Response {
+	t.Helper()
+	b, _ := json.Marshal(dto.OrderStatusRequest{Status: status})
+	req, _ := http.NewRequest(http.MethodPatch, baseURL+"/api/order/"+id+"/status", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api_key", adminKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func placeTestOrder(t *testing.T) dto.OrderResponse {
+	t.Helper()
+	resp := postOrder(t, dto.OrderRequest{
+		Items: []domain.OrderItem{{ProductID: "1", Quantity: 1}},
+	})
+	defer resp.Body.Close()
+
+	var order dto.OrderResponse
+	json.NewDecoder(resp.Body).Decode(&order)
+	if order.ID == "" {
+		t.Fatal("expected order ID, got empty")
+	}
+	return order
+}
+
+func TestOrderStatusLifecycle(t *testing.T) {
+	order := placeTestOrder(t)
+	if order.Status != domain.OrderStatusPlaced {
+		t.Fatalf("expected status placed, got %q", order.Status)
+	}
+
+	steps := []domain.OrderStatus{
+		domain.OrderStatusAccepted,
+		domain.OrderStatusPreparing,
+		domain.OrderStatusReady,
+		domain.OrderStatusCompleted,
+	}
+	for _, status := range steps {
+		resp := patchOrderStatus(t, order.ID, status)
+		var updated dto.OrderResponse
+		json.NewDecoder(resp.Body).Decode(&updated)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", status, resp.StatusCode)
+		}
+		if updated.Status != status {
+			t.Fatalf("expected status %q, got %q", status, updated.Status)
+		}
+	}
+
+	getResp := getOrder(t, order.ID)
+	defer getResp.Body.Close()
+
+	var final dto.OrderResponse
+	json.NewDecoder(getResp.Body).Decode(&final)
+
+	// placed + four transitions
+	if len(final.StatusHistory) != 5 {
+		t.Fatalf("expected 5 status history entries, got %d", len(final.StatusHistory))
+	}
+	if final.StatusHistory[0].To != domain.OrderStatusPlaced || final.StatusHistory[4].To != domain.OrderStatusCompleted {
+		t.Errorf("unexpected status history: %+v", final.StatusHistory)
+	}
+}
+
+func TestOrderStatusIllegalTransition(t *testing.T) {
+	order := placeTestOrder(t)
+
+	resp := patchOrderStatus(t, order.ID, domain.OrderStatusCompleted)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("placed -> completed: expected 409, got %d", resp.StatusCode)
+	}
+
+	resp = patchOrderStatus(t, order.ID, domain.OrderStatusCancelled)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("placed -> cancelled: expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = patchOrderStatus(t, order.ID, domain.OrderStatusAccepted)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("cancelled -> accepted: expected 409, got %d", resp.StatusCode)
+	}
+}
+
+func TestOrderStatusValidation(t *testing.T) {
+	order := placeTestOrder(t)
+
+	resp := patchOrderStatus(t, order.ID, "shipped")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("unknown status: expected 422, got %d", resp.StatusCode)
+	}
+
+	resp = patchOrderStatus(t, "00000000-0000-0000-0000-000000000000", domain.OrderStatusAccepted)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown order: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func postOrderWithKey(t *testing.T, key string, body dto.OrderRequest) *http.Response {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/order", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api_key", apiKey)
+	req.Header.Set("Idempotency-Key", key)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestPlaceOrderIdempotencyReplay(t *testing.T) {
+	key := "test-replay-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	body := dto.OrderRequest{
+		Items: []domain.OrderItem{{ProductID: "4", Quantity: 2}},
+	}
+
+	resp := postOrderWithKey(t, key, body)
+	var first dto.OrderResponse
+	json.NewDecoder(resp.Body).Decode(&first)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = postOrderWithKey(t, key, body)
+	var second dto.OrderResponse
+	json.NewDecoder(resp.Body).Decode(&second)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("replay: expected 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Error("expected Idempotent-Replayed header on replay")
+	}
+	if second.ID != first.ID {
+		t.Errorf("expected replayed order %q, got %q", first.ID, second.ID)
+	}
+}
+
+func TestPlaceOrderIdempotencyMismatch(t *testing.T) {
+	key := "test-mismatch-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	resp := postOrderWithKey(t, key, dto.OrderRequest{
+		Items: []domain.OrderItem{{ProductID: "4", Quantity: 1}},
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = postOrderWithKey(t, key, dto.OrderRequest{
+		Items: []domain.OrderItem{{ProductID: "4", Quantity: 3}},
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", resp.StatusCode)
+	}
+}
+
+func TestOrderLinePriceSnapshot(t *testing.T) {
+	resp := postOrder(t, dto.OrderRequest{
+		Items: []domain.OrderItem{
+			{ProductID: "1", Quantity: 2},
+			{ProductID: "3", Quantity: 1},
+		},
+	})
+	defer resp.Body.Close()
+
+	var placed dto.OrderResponse
+	json.NewDecoder(resp.Body).Decode(&placed)
+
+	getResp := getOrder(t, placed.ID)
+	defer getResp.Body.Close()
+
+	var order dto.OrderResponse
+	json.NewDecoder(getResp.Body).Decode(&order)
+
+	if len(order.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(order.Items))
+	}
+
+	// 6.50*2 = 13.00
+	line := order.Items[0]
+	if line.ProductID != "1" || line.ProductName != "Waffle with Berries" {
+		t.Errorf("unexpected line product: %+v", line)
+	}
+	if line.UnitPrice != 650 || line.LineTotal != 1300 {
+		t.Errorf("expected unit price 6.50 and line total 13.00, got %s and %s", line.UnitPrice, line.LineTotal)
+	}
+
+	var sum domain.Money
+	for _, l := range order.Items {
+		sum += l.LineTotal
+	}
+	if sum-order.Discounts != order.Total {
+		t.Errorf("line totals %s minus discounts %s do not add up to total %s", sum, order.Discounts, order.Total)
+	}
+}
+
+func TestPlaceOrderWithFixedAmountCoupon(t *testing.T) {
+	// GNULINUX is configured in testdata/coupon_rules.json as 5.00 off baskets of 20.00 or more.
+	resp := postOrder(t, dto.OrderRequest{
+		Items: []domain.OrderItem{
+			{ProductID: "1", Quantity: 2},
+			{ProductID: "3", Quantity: 1},
+		},
+		CouponCode: "GNULINUX",
+	})
+	defer resp.Body.Close()
+
+	var order dto.OrderResponse
+	json.NewDecoder(resp.Body).Decode(&order)
+
+	// 6.50*2 + 8.00*1 = 21.00, minus 5.00 = 16.00
+	if order.Discounts != 500 || order.Total != 1600 {
+		t.Errorf("expected discount 5.00 and total 16.00, got %s and %s", order.Discounts, order.Total)
+	}
+	if order.Coupon == nil || !order.Coupon.Applied || order.Coupon.Rule == nil || order.Coupon.Rule.Type != domain.CouponRuleFixed {
+		t.Errorf("expected applied fixed_amount coupon, got %+v", order.Coupon)
+	}
+
+	resp2 := postOrder(t, dto.OrderRequest{
+		Items:      []domain.OrderItem{{ProductID: "1", Quantity: 1}},
+		CouponCode: "GNULINUX",
+	})
+	defer resp2.Body.Close()
+
+	var small dto.OrderResponse
+	json.NewDecoder(resp2.Body).Decode(&small)
+
+	if small.Discounts != 0 || small.Coupon == nil || small.Coupon.Reason != domain.CouponBasketTooSmall {
+		t.Errorf("expected basket_too_small rejection, got %s (%+v)", small.Discounts, small.Coupon)
+	}
+}
+
+func postJSON(t *testing.T, path string, body any) *http.Response {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, baseURL+path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api_key", apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestQuoteOrder(t *testing.T) {
+	before := listOrders(t, "limit=1")
+	var beforePage dto.OrderListResponse
+	json.NewDecoder(before.Body).Decode(&beforePage)
+	before.Body.Close()
+
+	for _, path := range []string{"/api/order/quote", "/api/coupon/validate"} {
+		resp := postJSON(t, path, dto.OrderRequest{
+			Items:      []domain.OrderItem{{ProductID: "1", Quantity: 2}},
+			CouponCode: "OVER9000",
+		})
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, resp.StatusCode)
+		}
+
+		var quote dto.QuoteResponse
+		json.NewDecoder(resp.Body).Decode(&quote)
+
+		// 6.50*2 = 13.00, 10% discount = 1.30, total = 11.70
+		if quote.Subtotal != 1300 || quote.Discounts != 130 || quote.Total != 1170 {
+			t.Errorf("%s: expected 13.00/1.30/11.70, got %s/%s/%s", path, quote.Subtotal, quote.Discounts, quote.Total)
+		}
+		if quote.Coupon == nil || !quote.Coupon.Applied {
+			t.Errorf("%s: expected applied coupon, got %+v", path, quote.Coupon)
+		}
+	}
+
+	after := listOrders(t, "limit=1")
+	var afterPage dto.OrderListResponse
+	json.NewDecoder(after.Body).Decode(&afterPage)
+	after.Body.Close()
+
+	if len(beforePage.Orders) != len(afterPage.Orders) ||
+		(len(afterPage.Orders) > 0 && afterPage.Orders[0].ID != beforePage.Orders[0].ID) {
+		t.Error("expected quote not to create an order")
+	}
+}
+
+func TestQuoteOrderRejectedCoupon(t *testing.T) {
+	resp := postJSON(t, "/api/coupon/validate", dto.OrderRequest{
+		Items:      []domain.OrderItem{{ProductID: "1", Quantity: 1}},
+		CouponCode: "NOTAREALCODE",
+	})
+	defer resp.Body.Close()
+
+	var quote dto.QuoteResponse
+	json.NewDecoder(resp.Body).Decode(&quote)
+
+	if quote.Discounts != 0 || quote.Total != 650 || quote.Coupon == nil || quote.Coupon.Applied {
+		t.Errorf("expected unapplied coupon and total 6.50, got %s (%+v)", quote.Total, quote.Coupon)
+	}
+
+	strict := postJSON(t, "/api/coupon/validate", dto.OrderRequest{
+		Items:        []domain.OrderItem{{ProductID: "1", Quantity: 1}},
+		CouponCode:   "NOTAREALCODE",
+		StrictCoupon: true,
+	})
+	defer strict.Body.Close()
+
+	if strict.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for strict quote, got %d", strict.StatusCode)
+	}
+}
+
+func TestQuoteOrderStackedCoupons(t *testing.T) {
+	// testdata/coupon_rules.json stacks by category: ZY6K3HZ5 discounts waffles
+	// and N1ZAWFID baklava, so both apply.
+	resp := postJSON(t, "/api/order/quote", dto.OrderRequest{
+		Items:       []domain.OrderItem{{ProductID: "1", Quantity: 3}, {ProductID: "5", Quantity: 1}},
+		CouponCodes: []string{"ZY6K3HZ5", "N1ZAWFID", "ZY6K3HZ5"},
+	})
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var quote dto.QuoteResponse
+	json.NewDecoder(resp.Body).Decode(&quote)
+
+	// 6.50*3 + 4.00 = 23.50, one free waffle and one free baklava = 10.50
+	if quote.Subtotal != 2350 || quote.Discounts != 1050 || quote.Total != 1300 {
+		t.Errorf("expected 23.50/10.50/13.00, got %s/%s/%s", quote.Subtotal, quote.Discounts, quote.Total)
+	}
+	if len(quote.Coupons) != 3 || !quote.Coupons[0].Applied || !quote.Coupons[1].Applied ||
+		quote.Coupons[2].Reason != domain.CouponDuplicate {
+		t.Errorf("expected two applied coupons and a duplicate, got %+v", quote.Coupons)
+	}
+
+	// 3XLZZX59 discounts the whole basket, so it overlaps N1ZAWFID and the
+	// larger discount wins.
+	resp = postJSON(t, "/api/order/quote", dto.OrderRequest{
+		Items:       []domain.OrderItem{{ProductID: "1", Quantity: 1}, {ProductID: "3", Quantity: 1}, {ProductID: "5", Quantity: 1}},
+		CouponCodes: []string{"N1ZAWFID", "3XLZZX59"},
+	})
+	defer resp.Body.Close()
+
+	quote = dto.QuoteResponse{}
+	json.NewDecoder(resp.Body).Decode(&quote)
+
+	if len(quote.Coupons) != 2 || quote.Coupons[0].Reason != domain.CouponNotStackable || !quote.Coupons[1].Applied {
+		t.Errorf("expected N1ZAWFID not stackable and 3XLZZX59 applied, got %+v", quote.Coupons)
+	}
+	if quote.Discounts != quote.Coupons[1].Discount {
+		t.Errorf("expected discounts %s, got %s", quote.Coupons[1].Discount, quote.Discounts)
+	}
+
+	both := postJSON(t, "/api/order/quote", dto.OrderRequest{
+		Items:       []domain.OrderItem{{ProductID: "1", Quantity: 1}},
+		CouponCode:  "OVER9000",
+		CouponCodes: []string{"N1ZAWFID"},
+	})
+	defer both.Body.Close()
+
+	if both.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for couponCode with couponCodes, got %d", both.StatusCode)
+	}
+}
+
+func TestCouponPerCustomerLimitConcurrent(t *testing.T) {
+	// 7LRIIAP8 is configured in testdata/coupon_rules.json with one redemption per customer.
+	customer := "test-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	const attempts = 5
+	orders := make([]dto.OrderResponse, attempts)
+	var wg sync.WaitGroup
+	for i := range orders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := postOrder(t, dto.OrderRequest{
+				Items:      []domain.OrderItem{{ProductID: "1", Quantity: 1}},
+				CustomerID: customer,
+				CouponCode: "7LRIIAP8",
+			})
+			defer resp.Body.Close()
+			json.NewDecoder(resp.Body).Decode(&orders[i])
+		}()
+	}
+	wg.Wait()
+
+	applied := 0
+	for _, order := range orders {
+		switch {
+		case order.Coupon == nil:
+			t.Errorf("expected coupon outcome, got %+v", order)
+		case order.Coupon.Applied:
+			applied++
+		case order.Coupon.Reason != domain.CouponCustomerExhausted || order.Discounts != 0:
+			t.Errorf("expected customer_usage_exhausted at full price, got %s (%+v)", order.Discounts, order.Coupon)
+		}
+	}
+	if applied != 1 {
+		t.Errorf("expected exactly 1 applied redemption, got %d", applied)
+	}
+
+	anonymous := postOrder(t, dto.OrderRequest{
+		Items:      []domain.OrderItem{{ProductID: "1", Quantity: 1}},
+		CouponCode: "7LRIIAP8",
+	})
+	defer anonymous.Body.Close()
+
+	var order dto.OrderResponse
+	json.NewDecoder(anonymous.Body).Decode(&order)
+	if order.Coupon == nil || order.Coupon.Reason != domain.CouponCustomerRequired {
+		t.Errorf("expected customer_required without customerId, got %+v", order.Coupon)
+	}
+}
+
+func TestCouponRedemptionReport(t *testing.T) {
+	resp := postOrder(t, dto.OrderRequest{
+		Items:      []domain.OrderItem{{ProductID: "1", Quantity: 1}},
+		CouponCode: "OVER9000",
+	})
+	resp.Body.Close()
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	req, _ := http.NewRequest(http.MethodGet, baseURL+"/admin/coupons/redemptions?code=OVER9000&from="+today, nil)
+	req.Header.Set("api_key", apiKey)
+	report, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer report.Body.Close()
+
+	if report.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", report.StatusCode)
+	}
+
+	var body dto.RedemptionReport
+	json.NewDecoder(report.Body).Decode(&body)
+	if len(body.Days) != 1 || body.Days[0].Code != "OVER9000" || body.Days[0].Day != today || body.Days[0].Redemptions < 1 {
+		t.Errorf("expected today's OVER9000 redemptions, got %+v", body.Days)
+	}
+
+	bad, _ := http.NewRequest(http.MethodGet, baseURL+"/admin/coupons/redemptions?from=yesterday", nil)
+	bad.Header.Set("api_key", apiKey)
+	badResp, err := http.DefaultClient.Do(bad)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer badResp.Body.Close()
+	if badResp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad from, got %d", badResp.StatusCode)
+	}
+}
+
+func adminRequest(t *testing.T, method, path string, body io.Reader) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, baseURL+path, body)
+	req.Header.Set("api_key", adminKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func quoteCoupon(t *testing.T, code string) *domain.OrderCoupon {
+	t.Helper()
+	resp := postJSON(t, "/api/coupon/validate", dto.OrderRequest{
+		Items:      []domain.OrderItem{{ProductID: "1", Quantity: 1}},
+		CouponCode: code,
+	})
+	defer resp.Body.Close()
+
+	var quote dto.QuoteResponse
+	json.NewDecoder(resp.Body).Decode(&quote)
+	return quote.Coupon
+}
+
+func TestAdminCouponLifecycle(t *testing.T) {
+	code := fmt.Sprintf("ADM%07d", time.Now().UnixNano()%1e7)
+	rule := domain.CouponRule{Type: domain.CouponRuleFixed, AmountOff: 100}
+	b, _ := json.Marshal(dto.CreateCouponRequest{Code: code, Rule: &rule})
+
+	created := adminRequest(t, http.MethodPost, "/admin/coupons", bytes.NewReader(b))
+	defer created.Body.Close()
+	if created.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", created.StatusCode)
+	}
+	var coupon dto.CouponResponse
+	json.NewDecoder(created.Body).Decode(&coupon)
+	if coupon.Code != code || coupon.Source != domain.CouponSourceAdmin || coupon.Status != domain.CouponActive {
+		t.Errorf("unexpected created coupon %+v", coupon)
+	}
+	if coupon.Rule.Type != rule.Type || coupon.Rule.AmountOff != rule.AmountOff {
+		t.Errorf("expected the stored rule, got %+v", coupon.Rule)
+	}
+
+	again := adminRequest(t, http.MethodPost, "/admin/coupons", bytes.NewReader(b))
+	again.Body.Close()
+	if again.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for duplicate code, got %d", again.StatusCode)
+	}
+
+	if c := quoteCoupon(t, code); c == nil || !c.Applied || c.Discount != 100 {
+		t.Fatalf("expected new coupon to apply its own rule, got %+v", c)
+	}
+
+	disabled := adminRequest(t, http.MethodPost, "/admin/coupons/"+code+"/disable", nil)
+	json.NewDecoder(disabled.Body).Decode(&coupon)
+	disabled.Body.Close()
+	if coupon.Status != string(domain.CouponDisabled) || coupon.DisabledAt == nil {
+		t.Errorf("expected disabled coupon, got %+v", coupon)
+	}
+	if c := quoteCoupon(t, code); c == nil || c.Applied || c.Reason != domain.CouponDisabled {
+		t.Errorf("expected disabled rejection, got %+v", c)
+	}
+
+	inspect := adminRequest(t, http.MethodGet, "/admin/coupons/"+code, nil)
+	json.NewDecoder(inspect.Body).Decode(&coupon)
+	inspect.Body.Close()
+	if coupon.Redemptions == nil || *coupon.Redemptions != 0 || coupon.Status != string(domain.CouponDisabled) {
+		t.Errorf("unexpected inspected coupon %+v", coupon)
+	}
+
+	enabled := adminRequest(t, http.MethodPost, "/admin/coupons/"+code+"/enable", nil)
+	enabled.Body.Close()
+	if c := quoteCoupon(t, code); c == nil || !c.Applied {
+		t.Errorf("expected re-enabled coupon to apply, got %+v", c)
+	}
+
+	missing := adminRequest(t, http.MethodGet, "/admin/coupons/NOSUCHCODE", nil)
+	missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown code, got %d", missing.StatusCode)
+	}
+}
+
+func TestAdminCouponBulkUpload(t *testing.T) {
+	prefix := fmt.Sprintf("BLK%06d", time.Now().UnixNano()%1e6)
+	list := prefix + "A\n" + prefix + "B,2020-01-01,2020-02-01\n\n" + prefix + "A\n"
+
+	first := adminRequest(t, http.MethodPost, "/admin/coupons/bulk", strings.NewReader(list))
+	defer first.Body.Close()
+	var upload dto.CouponUploadResponse
+	json.NewDecoder(first.Body).Decode(&upload)
+	if first.StatusCode != http.StatusOK || upload.Codes != 2 || upload.Added != 2 {
+		t.Fatalf("unexpected upload result %d %+v", first.StatusCode, upload)
+	}
+
+	second := adminRequest(t, http.MethodPost, "/admin/coupons/bulk", strings.NewReader(prefix+"B\n"))
+	json.NewDecoder(second.Body).Decode(&upload)
+	second.Body.Close()
+	if upload.Added != 0 || upload.Updated != 1 {
+		t.Errorf("expected the existing code's validity to be updated, got %+v", upload)
+	}
+	if c := quoteCoupon(t, prefix+"B"); c == nil || !c.Applied {
+		t.Errorf("expected %sB to apply after its period was cleared, got %+v", prefix, c)
+	}
+
+	bad := adminRequest(t, http.MethodPost, "/admin/coupons/bulk", strings.NewReader(prefix+"C\n"+prefix+"D,soon\n"))
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for malformed line, got %d", bad.StatusCode)
+	}
+
+	list2 := adminRequest(t, http.MethodGet, "/admin/coupons?source=admin&limit=1", nil)
+	var page dto.CouponListResponse
+	json.NewDecoder(list2.Body).Decode(&page)
+	list2.Body.Close()
+	if len(page.Coupons) != 1 || page.NextCursor == "" {
+		t.Errorf("expected one admin coupon and a cursor, got %+v", page)
+	}
+}
+
+func TestAdminProductLifecycle(t *testing.T) {
+	productJSON := func(req any) io.Reader {
+		b, _ := json.Marshal(req)
+		return bytes.NewReader(b)
+	}
+	image := &domain.ProductImage{Thumbnail: "https://example.com/thumb.jpg"}
+
+	for _, req := range []dto.ProductRequest{
+		{Name: " ", Price: 500, Category: "Cake"},
+		{Name: "Carrot Cake", Price: 0, Category: "Cake"},
+		{Name: "Carrot Cake", Price: 500, Category: "Soup"},
+		{Name: "Carrot Cake", Price: 500, Category: "Cake", Image: &domain.ProductImage{Mobile: "not a url"}},
+	} {
+		resp := adminRequest(t, http.MethodPost, "/api/product", productJSON(req))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %+v, got %d", req, resp.StatusCode)
+		}
+	}
+
+	created := adminRequest(t, http.MethodPost, "/api/product", productJSON(dto.ProductRequest{
+		Name: "Carrot Cake", Price: 550, Category: "Cake", Image: image,
+	}))
+	defer created.Body.Close()
+	if created.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", created.StatusCode)
+	}
+	var product domain.Product
+	json.NewDecoder(created.Body).Decode(&product)
+	if product.ID == "" || product.Name != "Carrot Cake" || product.Price != 550 || product.Image.Thumbnail != image.Thumbnail {
+		t.Fatalf("unexpected created product %+v", product)
+	}
+	path := "/api/product/" + product.ID
+
+	name := "Spiced Carrot Cake"
+	patched := adminRequest(t, http.MethodPatch, path, productJSON(dto.ProductPatchRequest{Name: &name}))
+	json.NewDecoder(patched.Body).Decode(&product)
+	patched.Body.Close()
+	if patched.StatusCode != http.StatusOK || product.Name != name || product.Price != 550 || product.Image.Thumbnail != image.Thumbnail {
+		t.Errorf("unexpected patched product %d %+v", patched.StatusCode, product)
+	}
+
+	replaced := adminRequest(t, http.MethodPut, path, productJSON(dto.ProductRequest{Name: name, Price: 600, Category: "Cake"}))
+	json.NewDecoder(replaced.Body).Decode(&product)
+	replaced.Body.Close()
+	if replaced.StatusCode != http.StatusOK || product.Price != 600 || product.Image.Thumbnail != "" {
+		t.Errorf("unexpected replaced product %d %+v", replaced.StatusCode, product)
+	}
+
+	unauthorized, _ := http.NewRequest(http.MethodDelete, baseURL+path, nil)
+	resp, err := http.DefaultClient.Do(unauthorized)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without an API key, got %d", resp.StatusCode)
+	}
+
+	deleted := adminRequest(t, http.MethodDelete, path, nil)
+	deleted.Body.Close()
+	if deleted.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", deleted.StatusCode)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		resp := adminRequest(t, method, path, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected 404 for %s of a deleted product, got %d", method, resp.StatusCode)
+		}
+	}
+
+	order := postJSON(t, "/api/order", dto.OrderRequest{Items: []domain.OrderItem{{ProductID: product.ID, Quantity: 1}}})
+	order.Body.Close()
+	if order.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 when ordering a deleted product, got %d", order.StatusCode)
+	}
+}
+
+func TestStaffEndpointsRejectClientKey(t *testing.T) {
+	for _, ep := range []struct{ method, path string }{
+		{http.MethodGet, "/admin/coupons/status"},
+		{http.MethodPost, "/admin/coupons/reload"},
+		{http.MethodPost, "/api/product"},
+		{http.MethodDelete, "/api/product/1"},
+		{http.MethodPatch, "/api/order/00000000-0000-0000-0000-000000000000/status"},
+	} {
+		req, _ := http.NewRequest(ep.method, baseURL+ep.path, nil)
+		req.Header.Set("api_key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s with the client key: expected 403, got %d", ep.method, ep.path, resp.StatusCode)
+		}
 	}
 }
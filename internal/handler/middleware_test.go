@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		xff     []string
+		trusted []netip.Prefix
+		want    string
+	}{
+		{"no proxies", "203.0.113.7:5000", nil, nil, "203.0.113.7"},
+		{"header ignored without trusted proxies", "203.0.113.7:5000", []string{"198.51.100.1"}, nil, "203.0.113.7"},
+		{"spoofed header from untrusted peer", "203.0.113.7:5000", []string{"198.51.100.1"}, proxies, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:5000", []string{"203.0.113.7"}, proxies, "203.0.113.7"},
+		{"chained trusted proxies", "10.0.0.1:5000", []string{"203.0.113.7, 10.0.0.2, 10.0.0.3"}, proxies, "203.0.113.7"},
+		{"spoofed hop left of the client", "10.0.0.1:5000", []string{"198.51.100.1, 203.0.113.7"}, proxies, "203.0.113.7"},
+		{"untrusted hop in the chain", "10.0.0.1:5000", []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"}, proxies, "203.0.113.7"},
+		{"hops across headers", "10.0.0.1:5000", []string{"198.51.100.1", "203.0.113.7, 10.0.0.2"}, proxies, "203.0.113.7"},
+		{"every hop trusted", "10.0.0.1:5000", []string{"10.0.0.3, 10.0.0.2"}, proxies, "10.0.0.3"},
+		{"garbage hop", "10.0.0.1:5000", []string{"203.0.113.7, not-an-ip"}, proxies, "10.0.0.1"},
+		{"empty header", "10.0.0.1:5000", []string{""}, proxies, "10.0.0.1"},
+		{"ipv6 proxy", "[2001:db8::1]:5000", []string{"2001:db8:ffff::1, 2001:db8::2"}, proxies, "2001:db8:ffff::1"},
+		{"ipv4-mapped peer", "[::ffff:10.0.0.1]:5000", []string{"203.0.113.7"}, proxies, "203.0.113.7"},
+		{"ipv4-mapped client", "10.0.0.1:5000", []string{"::ffff:203.0.113.7"}, proxies, "203.0.113.7"},
+		{"no port", "203.0.113.7", nil, proxies, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r, tt.trusted); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaffMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name     string
+		adminKey string
+		sent     string
+		want     int
+	}{
+		{"no admin key configured", "", "", http.StatusServiceUnavailable},
+		{"no admin key configured, key sent", "", "anything", http.StatusServiceUnavailable},
+		{"no key sent", "admin", "", http.StatusUnauthorized},
+		{"wrong key", "admin", "client", http.StatusForbidden},
+		{"admin key", "admin", "admin", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PATCH", "/api/order/1/status", nil)
+			if tt.sent != "" {
+				r.Header.Set("api_key", tt.sent)
+			}
+			w := httptest.NewRecorder()
+			StaffMiddleware(tt.adminKey, ok).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -2,19 +2,30 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/Sanjaiy/foodieapp/internal/domain"
 	"github.com/Sanjaiy/foodieapp/internal/dto"
 	"github.com/Sanjaiy/foodieapp/internal/service"
 )
 
 type OrderHandler struct {
-	svc *service.OrderService
+	svc            *service.OrderService
+	trustedProxies []netip.Prefix
 }
 
-func NewOrderHandler(svc *service.OrderService) *OrderHandler {
+// NewOrderHandler believes X-Forwarded-For only from trustedProxies.
+func NewOrderHandler(svc *service.OrderService, trustedProxies []netip.Prefix) *OrderHandler {
 	return &OrderHandler{
-		svc: svc,
+		svc:            svc,
+		trustedProxies: trustedProxies,
 	}
 }
 
@@ -25,18 +36,233 @@ func (h *OrderHandler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := h.svc.PlaceOrder(r.Context(), req.ToDomainItems(), req.CouponCode)
+	order, replayed, err := h.svc.PlaceOrder(r.Context(), service.PlaceOrderInput{
+		Items:          req.ToDomainItems(),
+		CustomerID:     req.CustomerID,
+		CouponCode:     req.CouponCode,
+		CouponCodes:    req.CouponCodes,
+		StrictCoupon:   req.StrictCoupon,
+		IdempotencyKey: r.Header.Get("Idempotency-Key"),
+		Client:         h.couponClient(r),
+	})
 	if err != nil {
-		if err.Error() == "at least one item is required" ||
-			err.Error() == "productId is required for each item" ||
-			err.Error() == "quantity must be greater than 0" ||
-			err.Error() == "invalid product specified" {
-			writeError(w, http.StatusUnprocessableEntity, "validation", err.Error())
+		if errors.Is(err, service.ErrInvalidIdempotencyKey) {
+			writeError(w, http.StatusBadRequest, "validation", err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrIdempotencyMismatch) {
+			writeError(w, http.StatusUnprocessableEntity, "idempotency_mismatch", err.Error())
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "internal", "failed to place order")
+		writeBasketError(w, err, "failed to place order")
+		return
+	}
+
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	writeJSON(w, http.StatusOK, dto.FromDomainOrder(order))
+}
+
+// QuoteOrder prices an order request, coupon included, without placing it.
+func (h *OrderHandler) QuoteOrder(w http.ResponseWriter, r *http.Request) {
+	var req dto.OrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "validation", "invalid JSON body")
+		return
+	}
+
+	quote, err := h.svc.Quote(r.Context(), service.PlaceOrderInput{
+		Items:        req.ToDomainItems(),
+		CustomerID:   req.CustomerID,
+		CouponCode:   req.CouponCode,
+		CouponCodes:  req.CouponCodes,
+		StrictCoupon: req.StrictCoupon,
+		Client:       h.couponClient(r),
+	})
+	if err != nil {
+		writeBasketError(w, err, "failed to quote order")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dto.FromQuote(quote.Items, quote.Coupon, quote.Coupons, quote.Subtotal, quote.Discounts, quote.Total))
+}
+
+// couponClient identifies the caller of r, by IP address, for coupon
+// brute-force protection.
+func (h *OrderHandler) couponClient(r *http.Request) service.CouponClient {
+	return service.CouponClient{IP: clientIP(r, h.trustedProxies)}
+}
+
+// writeBasketError maps the errors shared by PlaceOrder and Quote to a response.
+func writeBasketError(w http.ResponseWriter, err error, internalMsg string) {
+	var locked *service.CouponLockedError
+	if errors.As(err, &locked) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, "too_many_coupon_attempts", err.Error())
+		return
+	}
+	var rejected *service.CouponRejectedError
+	if errors.As(err, &rejected) {
+		writeError(w, http.StatusUnprocessableEntity, "coupon_rejected", err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrCouponCodesConflict) || errors.Is(err, service.ErrTooManyCoupons) ||
+		errors.Is(err, service.ErrQuantityTooLarge) {
+		writeError(w, http.StatusUnprocessableEntity, "validation", err.Error())
+		return
+	}
+	if err.Error() == "at least one item is required" ||
+		err.Error() == "productId is required for each item" ||
+		err.Error() == "quantity must be greater than 0" ||
+		err.Error() == "invalid product specified" {
+		writeError(w, http.StatusUnprocessableEntity, "validation", err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "internal", internalMsg)
+}
+
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	orderID := r.PathValue("orderId")
+	if orderID == "" {
+		writeError(w, http.StatusBadRequest, "validation", "order ID is required")
+		return
+	}
+
+	order, err := h.svc.GetOrder(r.Context(), orderID)
+	if err != nil {
+		log.Printf("ERROR: getting order %s: %v", orderID, err)
+		writeError(w, http.StatusInternalServerError, "internal", "failed to get order")
+		return
+	}
+
+	if order == nil {
+		writeError(w, http.StatusNotFound, "not_found", "Order not found")
 		return
 	}
 
 	writeJSON(w, http.StatusOK, dto.FromDomainOrder(order))
 }
+
+func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderID := r.PathValue("orderId")
+	if orderID == "" {
+		writeError(w, http.StatusBadRequest, "validation", "order ID is required")
+		return
+	}
+
+	var req dto.OrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "validation", "invalid JSON body")
+		return
+	}
+
+	order, err := h.svc.UpdateOrderStatus(r.Context(), orderID, req.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidStatus):
+			writeError(w, http.StatusUnprocessableEntity, "validation", err.Error())
+		case errors.Is(err, service.ErrOrderNotFound):
+			writeError(w, http.StatusNotFound, "not_found", "Order not found")
+		case errors.Is(err, service.ErrInvalidTransition):
+			writeError(w, http.StatusConflict, "conflict", err.Error())
+		default:
+			log.Printf("ERROR: updating order %s status: %v", orderID, err)
+			writeError(w, http.StatusInternalServerError, "internal", "failed to update order status")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dto.FromDomainOrder(order))
+}
+
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListOrdersParams(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "validation", err.Error())
+		return
+	}
+
+	page, err := h.svc.ListOrders(r.Context(), params)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "validation", err.Error())
+			return
+		}
+		log.Printf("ERROR: listing orders: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal", "failed to list orders")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dto.FromDomainOrders(page.Orders, page.NextCursor))
+}
+
+func parseListOrdersParams(q url.Values) (service.ListOrdersParams, error) {
+	params := service.ListOrdersParams{
+		CouponCode: q.Get("couponCode"),
+		Status:     domain.OrderStatus(q.Get("status")),
+		Cursor:     q.Get("cursor"),
+	}
+	if params.Status != "" && !params.Status.Valid() {
+		return params, errors.New("unknown status")
+	}
+
+	var err error
+	if params.CreatedFrom, err = parseTimeParam(q, "from"); err != nil {
+		return params, err
+	}
+	if params.CreatedTo, err = parseTimeParam(q, "to"); err != nil {
+		return params, err
+	}
+	if params.CreatedFrom != nil && params.CreatedTo != nil && !params.CreatedFrom.Before(*params.CreatedTo) {
+		return params, errors.New("from must be before to")
+	}
+
+	if params.MinTotal, err = parseAmountParam(q, "minTotal"); err != nil {
+		return params, err
+	}
+	if params.MaxTotal, err = parseAmountParam(q, "maxTotal"); err != nil {
+		return params, err
+	}
+	if params.MinTotal != nil && params.MaxTotal != nil && *params.MinTotal > *params.MaxTotal {
+		return params, errors.New("minTotal must not exceed maxTotal")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > service.MaxOrderPageSize {
+			return params, errors.New("limit must be between 1 and " + strconv.Itoa(service.MaxOrderPageSize))
+		}
+		params.Limit = limit
+	}
+
+	return params, nil
+}
+
+// parseTimeParam accepts either an RFC 3339 timestamp or a plain date,
+// which is interpreted as midnight UTC.
+func parseTimeParam(q url.Values, key string) (*time.Time, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return &t, nil
+	}
+	return nil, errors.New(key + " must be an RFC 3339 timestamp or YYYY-MM-DD date")
+}
+
+func parseAmountParam(q url.Values, key string) (*domain.Money, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	amount, err := domain.ParseMoney(v)
+	if err != nil || amount < 0 {
+		return nil, errors.New(key + " must be a non-negative number")
+	}
+	return &amount, nil
+}
@@ -1,9 +1,17 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/dto"
 	"github.com/Sanjaiy/foodieapp/internal/service"
 )
 
@@ -15,17 +23,79 @@ func NewProductHandler(svc *service.ProductService) *ProductHandler {
 	return &ProductHandler{svc: svc}
 }
 
+// ListProducts lists the catalog as a JSON array. When more products match
+// than fit on the page, the Next-Cursor header carries the cursor of the
+// next one.
 func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.svc.ListProducts(r.Context())
+	params, err := parseListProductsParams(r.URL.Query())
 	if err != nil {
+		writeError(w, http.StatusBadRequest, "validation", err.Error())
+		return
+	}
+
+	page, err := h.svc.ListProducts(r.Context(), params)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) || errors.Is(err, service.ErrUnknownCategory) {
+			writeError(w, http.StatusBadRequest, "validation", err.Error())
+			return
+		}
 		log.Printf("ERROR: listing products: %v", err)
 		writeError(w, http.StatusInternalServerError, "internal", "failed to list products")
 		return
 	}
 
+	if page.NextCursor != "" {
+		w.Header().Set("Next-Cursor", page.NextCursor)
+	}
+	products := page.Products
+	if products == nil {
+		products = []domain.Product{}
+	}
 	writeJSON(w, http.StatusOK, products)
 }
 
+func parseListProductsParams(q url.Values) (service.ListProductsParams, error) {
+	params := service.ListProductsParams{
+		Search: strings.TrimSpace(q.Get("q")),
+		Sort:   domain.ProductSort(q.Get("sort")),
+		Cursor: q.Get("cursor"),
+	}
+	if !params.Sort.Valid() {
+		return params, errors.New("sort must be one of name, -name, price, -price")
+	}
+	if utf8.RuneCountInString(params.Search) > service.MaxProductSearchLength {
+		return params, errors.New("q must be at most " + strconv.Itoa(service.MaxProductSearchLength) + " characters")
+	}
+
+	for _, c := range q["category"] {
+		if c = strings.TrimSpace(c); c == "" {
+			return params, errors.New("category must not be empty")
+		}
+		params.Categories = append(params.Categories, c)
+	}
+
+	var err error
+	if params.MinPrice, err = parseAmountParam(q, "minPrice"); err != nil {
+		return params, err
+	}
+	if params.MaxPrice, err = parseAmountParam(q, "maxPrice"); err != nil {
+		return params, err
+	}
+	if params.MinPrice != nil && params.MaxPrice != nil && *params.MinPrice > *params.MaxPrice {
+		return params, errors.New("minPrice must not exceed maxPrice")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > service.MaxProductPageSize {
+			return params, errors.New("limit must be between 1 and " + strconv.Itoa(service.MaxProductPageSize))
+		}
+		params.Limit = limit
+	}
+
+	return params, nil
+}
+
 func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	productID := r.PathValue("productId")
 	if productID == "" {
@@ -47,3 +117,95 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, *product)
 }
+
+func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	var req dto.ProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "validation", "invalid JSON body")
+		return
+	}
+
+	product, err := h.svc.CreateProduct(r.Context(), productInput(req))
+	if err != nil {
+		writeProductError(w, err, "failed to create product")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, *product)
+}
+
+// ReplaceProduct overwrites every field of a product; image URLs missing
+// from the body are cleared.
+func (h *ProductHandler) ReplaceProduct(w http.ResponseWriter, r *http.Request) {
+	var req dto.ProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "validation", "invalid JSON body")
+		return
+	}
+
+	product, err := h.svc.ReplaceProduct(r.Context(), r.PathValue("productId"), productInput(req))
+	if err != nil {
+		writeProductError(w, err, "failed to update product")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, *product)
+}
+
+// PatchProduct changes the fields present in the body.
+func (h *ProductHandler) PatchProduct(w http.ResponseWriter, r *http.Request) {
+	var req dto.ProductPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "validation", "invalid JSON body")
+		return
+	}
+
+	patch := service.ProductPatch{Name: req.Name, Price: req.Price, Category: req.Category}
+	if req.Image != nil {
+		patch.Image = service.ProductImagePatch{
+			Thumbnail: req.Image.Thumbnail,
+			Mobile:    req.Image.Mobile,
+			Tablet:    req.Image.Tablet,
+			Desktop:   req.Image.Desktop,
+		}
+	}
+
+	product, err := h.svc.PatchProduct(r.Context(), r.PathValue("productId"), patch)
+	if err != nil {
+		writeProductError(w, err, "failed to update product")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, *product)
+}
+
+// DeleteProduct removes a product from the menu. Past orders keep showing
+// it.
+func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeleteProduct(r.Context(), r.PathValue("productId")); err != nil {
+		writeProductError(w, err, "failed to delete product")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func productInput(req dto.ProductRequest) service.ProductInput {
+	in := service.ProductInput{Name: req.Name, Price: req.Price, Category: req.Category}
+	if req.Image != nil {
+		in.Image = *req.Image
+	}
+	return in
+}
+
+func writeProductError(w http.ResponseWriter, err error, internalMsg string) {
+	switch {
+	case errors.Is(err, service.ErrProductNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Product not found")
+	case errors.Is(err, service.ErrInvalidProduct):
+		writeError(w, http.StatusBadRequest, "validation", err.Error())
+	default:
+		log.Printf("ERROR: %s: %v", internalMsg, err)
+		writeError(w, http.StatusInternalServerError, "internal", internalMsg)
+	}
+}
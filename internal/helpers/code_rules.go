@@ -0,0 +1,67 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// CodeRules is the shape a coupon code must have. cmd/preprocess drops codes
+// that do not match, and CouponLookup rejects them without searching, so both
+// must be built from the same settings; CodeRulesFromEnv is that source.
+type CodeRules struct {
+	MinLength int
+	MaxLength int
+	// Pattern, if set, must match the whole code.
+	Pattern *regexp.Regexp
+}
+
+var DefaultCodeRules = CodeRules{MinLength: 8, MaxLength: 10}
+
+// CodeRulesFromEnv reads COUPON_MIN_LENGTH, COUPON_MAX_LENGTH and
+// COUPON_PATTERN, falling back to DefaultCodeRules.
+func CodeRulesFromEnv() (CodeRules, error) {
+	rules := DefaultCodeRules
+
+	var err error
+	if rules.MinLength, err = envInt("COUPON_MIN_LENGTH", rules.MinLength); err != nil {
+		return rules, err
+	}
+	if rules.MaxLength, err = envInt("COUPON_MAX_LENGTH", rules.MaxLength); err != nil {
+		return rules, err
+	}
+	if rules.MinLength < 1 || rules.MaxLength < rules.MinLength || rules.MaxLength > MaxCouponIndexWidth {
+		return rules, fmt.Errorf("coupon length must satisfy 1 <= COUPON_MIN_LENGTH <= COUPON_MAX_LENGTH <= %d", MaxCouponIndexWidth)
+	}
+
+	if p := os.Getenv("COUPON_PATTERN"); p != "" {
+		rules.Pattern, err = regexp.Compile(`^(?:` + p + `)$`)
+		if err != nil {
+			return rules, fmt.Errorf("invalid COUPON_PATTERN: %w", err)
+		}
+	}
+
+	return rules, nil
+}
+
+func envInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be an integer", key, v)
+	}
+	return n, nil
+}
+
+func (r CodeRules) ValidLength(code string) bool {
+	return len(code) >= r.MinLength && len(code) <= r.MaxLength
+}
+
+// Accept reports whether code has a valid length and matches Pattern.
+func (r CodeRules) Accept(code string) bool {
+	return r.ValidLength(code) && (r.Pattern == nil || r.Pattern.MatchString(code))
+}
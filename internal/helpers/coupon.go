@@ -1,23 +1,111 @@
 package helpers
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
 )
 
+// CouponLookup answers membership queries against the sorted file written by
+// cmd/preprocess, either the newline separated text format or the binary
+// index (see coupon_index.go). Either may carry a validity period per code
+// (see coupon_validity.go); Lookup returns it for the caller to check
+// against its own clock. The file is mmapped once per load; text files
+// additionally get a line offset index, binary files are searched in place.
+// A Bloom filter built for the file (see coupon_filter.go) is checked first,
+// so most unlisted codes are rejected without searching the file.
+// Reload builds a fresh index beside the live one and swaps it in, so lookups
+// never block on a reload.
 type CouponLookup struct {
+	path    string
+	rules   CodeRules
+	current atomic.Pointer[couponIndex]
+
+	reloadMu sync.Mutex // serialises Reload
+	reloads  atomic.Int64
+	lastErr  atomic.Pointer[string]
+}
+
+// CouponLookupStatus describes the currently loaded codes file.
+type CouponLookupStatus struct {
+	Path      string    `json:"path"`
+	Codes     int       `json:"codes"`
+	Reloads   int64     `json:"reloads"`
+	LoadedAt  time.Time `json:"loadedAt"`
+	LastError string    `json:"lastError,omitempty"`
+	// Filter is nil when no filter matches the loaded file.
+	Filter *CouponFilterStatus `json:"filter,omitempty"`
+}
+
+// couponIndex is one loaded generation of the codes file. refs starts at 1
+// for the owning CouponLookup; every Check holds an extra reference, and the
+// mapping is released when the count drops to zero.
+type couponIndex struct {
 	data    []byte
-	offsets []int
+	offsets []int // text format only
+	// binary format only; width is zero for text files
+	records  []byte
+	width    int
+	size     int
+	count    int
+	info     os.FileInfo
+	loadedAt time.Time
+	refs     atomic.Int32
+
+	filter     *couponFilter
+	filterInfo os.FileInfo // nil when there is no filter file
 }
 
-func NewCouponLookup(path string) (*CouponLookup, error) {
-	f, err := os.Open(path)
+func NewCouponLookup(path string, rules CodeRules) (*CouponLookup, error) {
+	idx, err := loadCouponCodes(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return &CouponLookup{}, nil
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
 		}
+		idx = emptyCouponIndex(nil)
+	}
+
+	p := &CouponLookup{path: path, rules: rules}
+	p.current.Store(idx)
+	return p, nil
+}
+
+// loadCouponCodes loads the codes file at path together with its filter. A
+// filter that cannot be read is logged and skipped: lookups stay correct
+// without it, only slower.
+func loadCouponCodes(path string) (*couponIndex, error) {
+	idx, err := loadCouponIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	if idx.data == nil {
+		return idx, nil
+	}
+
+	filterPath := CouponFilterPath(path)
+	idx.filter, idx.filterInfo, err = loadCouponFilter(filterPath, idx.data)
+	switch {
+	case err != nil:
+		log.Printf("ERROR: promo lookup %s: %v", filterPath, err)
+	case idx.filter == nil && idx.filterInfo != nil:
+		log.Printf("Ignoring %s: it was built for a different codes file", filterPath)
+	}
+	return idx, nil
+}
+
+func loadCouponIndex(path string) (*couponIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
 		return nil, fmt.Errorf("promo lookup open: %w", err)
 	}
 	defer f.Close()
@@ -29,7 +117,7 @@ func NewCouponLookup(path string) (*CouponLookup, error) {
 
 	size := int(info.Size())
 	if size == 0 {
-		return &CouponLookup{}, nil
+		return emptyCouponIndex(info), nil
 	}
 
 	data, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_PRIVATE)
@@ -37,43 +125,280 @@ func NewCouponLookup(path string) (*CouponLookup, error) {
 		return nil, fmt.Errorf("promo lookup mmap: %w", err)
 	}
 
-	offsets := []int{0}
+	idx := emptyCouponIndex(info)
+	idx.data = data
+
+	if isCouponIndex(data) {
+		idx.records, idx.width, idx.size, idx.count, err = parseCouponIndex(data)
+		if err != nil {
+			syscall.Munmap(data)
+			return nil, fmt.Errorf("promo lookup %s: %w", path, err)
+		}
+		return idx, nil
+	}
+
+	idx.offsets = []int{0}
+	hasValidity := false
 	for i := 0; i < size; i++ {
-		if data[i] == '\n' && i+1 < size {
-			offsets = append(offsets, i+1)
+		switch {
+		case data[i] == '\n' && i+1 < size:
+			idx.offsets = append(idx.offsets, i+1)
+		case data[i] == ',':
+			hasValidity = true
+		}
+	}
+
+	// Validity fields are parsed on every lookup; reject a malformed file now
+	// rather than a code later.
+	if hasValidity {
+		for i := range idx.offsets {
+			if _, rest := splitCouponLine(idx.line(i)); rest != nil {
+				if _, err := parseLineValidity(rest); err != nil {
+					syscall.Munmap(data)
+					return nil, fmt.Errorf("promo lookup %s line %d: %w", path, i+1, err)
+				}
+			}
 		}
 	}
+	return idx, nil
+}
+
+func emptyCouponIndex(info os.FileInfo) *couponIndex {
+	idx := &couponIndex{info: info, loadedAt: time.Now()}
+	idx.refs.Store(1)
+	return idx
+}
 
-	return &CouponLookup{data: data, offsets: offsets}, nil
+// acquire returns the live index with a reference held. An index whose count
+// has already reached zero is being unmapped and must not be revived, so the
+// increment is a compare-and-swap from a non-zero value.
+func (p *CouponLookup) acquire() *couponIndex {
+	for {
+		idx := p.current.Load()
+		n := idx.refs.Load()
+		if n > 0 && idx.refs.CompareAndSwap(n, n+1) {
+			return idx
+		}
+	}
 }
 
-func (p *CouponLookup) lineAt(idx int) string {
-	start := p.offsets[idx]
+func (idx *couponIndex) release() {
+	if idx.refs.Add(-1) != 0 {
+		return
+	}
+	if idx.data != nil {
+		if err := syscall.Munmap(idx.data); err != nil {
+			log.Printf("ERROR: promo lookup munmap: %v", err)
+		}
+	}
+	if idx.filter != nil {
+		if err := syscall.Munmap(idx.filter.data); err != nil {
+			log.Printf("ERROR: promo lookup munmap: %v", err)
+		}
+	}
+}
+
+func (idx *couponIndex) len() int {
+	if idx.width > 0 {
+		return idx.count
+	}
+	return len(idx.offsets)
+}
+
+// line returns the i-th line of a text file as a view into the mapping.
+func (idx *couponIndex) line(i int) []byte {
+	start := idx.offsets[i]
 	end := start
-	for end < len(p.data) && p.data[end] != '\n' {
+	for end < len(idx.data) && idx.data[end] != '\n' {
 		end++
 	}
-	return string(p.data[start:end])
+	return idx.data[start:end]
 }
 
+// at returns the i-th code as a view into the mapping.
+func (idx *couponIndex) at(i int) []byte {
+	if idx.width > 0 {
+		rec := idx.records[i*idx.size : i*idx.size+idx.width]
+		if n := bytes.IndexByte(rec, 0); n >= 0 {
+			rec = rec[:n]
+		}
+		return rec
+	}
+
+	code, _ := splitCouponLine(idx.line(i))
+	return code
+}
+
+// validity returns the validity period of the i-th code.
+func (idx *couponIndex) validity(i int) domain.CouponValidity {
+	if idx.width > 0 {
+		if idx.size == idx.width {
+			return domain.CouponValidity{}
+		}
+		return decodeValidity(idx.records[i*idx.size+idx.width : (i+1)*idx.size])
+	}
+
+	_, rest := splitCouponLine(idx.line(i))
+	if rest == nil {
+		return domain.CouponValidity{}
+	}
+	// Checked when the file was loaded.
+	v, _ := parseLineValidity(rest)
+	return v
+}
+
+// IsValid reports whether code is listed, regardless of its validity period.
 func (p *CouponLookup) IsValid(code string) bool {
-	if len(code) < 8 || len(code) > 10 {
-		return false
+	return p.Check(code) == ""
+}
+
+// Check reports why code is not listed, or "" if it is. It does not look at
+// the validity period; see Lookup.
+func (p *CouponLookup) Check(code string) domain.CouponRejection {
+	_, reason := p.Lookup(code)
+	return reason
+}
+
+// Lookup returns the validity period of code, or the reason it is not
+// listed.
+func (p *CouponLookup) Lookup(code string) (domain.CouponValidity, domain.CouponRejection) {
+	if !p.rules.ValidLength(code) {
+		return domain.CouponValidity{}, domain.CouponWrongLength
 	}
-	if len(p.offsets) == 0 {
-		return false
+	if !p.rules.Accept(code) {
+		return domain.CouponValidity{}, domain.CouponUnknownCode
 	}
 
-	i := sort.Search(len(p.offsets), func(i int) bool {
-		return p.lineAt(i) >= code
+	idx := p.acquire()
+	defer idx.release()
+
+	if f := idx.filter; f != nil {
+		if !f.mayContain(code) {
+			f.rejected.Add(1)
+			return domain.CouponValidity{}, domain.CouponUnknownCode
+		}
+		f.passed.Add(1)
+	}
+
+	n := idx.len()
+	i := sort.Search(n, func(i int) bool {
+		return string(idx.at(i)) >= code
 	})
 
-	return i < len(p.offsets) && p.lineAt(i) == code
+	if i < n && string(idx.at(i)) == code {
+		return idx.validity(i), ""
+	}
+	if idx.filter != nil {
+		idx.filter.falsePositives.Add(1)
+	}
+	return domain.CouponValidity{}, domain.CouponUnknownCode
+}
+
+// Reload maps the codes file again and swaps it in. On failure the current
+// codes stay live; a missing file is an error here rather than an empty list,
+// so a file removed by mistake does not reject every coupon.
+func (p *CouponLookup) Reload() error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	idx, err := loadCouponCodes(p.path)
+	if err != nil {
+		msg := err.Error()
+		p.lastErr.Store(&msg)
+		return err
+	}
+
+	old := p.current.Swap(idx)
+	old.release()
+	p.reloads.Add(1)
+	p.lastErr.Store(nil)
+	return nil
+}
+
+// changed reports whether the file at path or its filter differs from the
+// loaded one. A replaced file (new inode) counts as changed even with the
+// same size and modification time.
+func (p *CouponLookup) changed() (bool, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, err
+	}
+	filterInfo, err := os.Stat(CouponFilterPath(p.path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	idx := p.acquire()
+	defer idx.release()
+
+	if idx.info == nil {
+		return true, nil
+	}
+	if (filterInfo == nil) != (idx.filterInfo == nil) {
+		return true, nil
+	}
+	return fileChanged(idx.info, info) ||
+		(filterInfo != nil && fileChanged(idx.filterInfo, filterInfo)), nil
+}
+
+func fileChanged(old, cur os.FileInfo) bool {
+	return !os.SameFile(old, cur) ||
+		!cur.ModTime().Equal(old.ModTime()) ||
+		cur.Size() != old.Size()
+}
+
+// Watch polls the codes file every interval and reloads it when it changes,
+// until ctx is cancelled.
+func (p *CouponLookup) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := p.changed()
+			if err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					log.Printf("ERROR: promo lookup stat: %v", err)
+				}
+				continue
+			}
+			if !changed {
+				continue
+			}
+			if err := p.Reload(); err != nil {
+				log.Printf("ERROR: reloading promo codes: %v", err)
+				continue
+			}
+			log.Printf("Reloaded promo codes from %s", p.path)
+		}
+	}
+}
+
+func (p *CouponLookup) Status() CouponLookupStatus {
+	idx := p.acquire()
+	defer idx.release()
+
+	status := CouponLookupStatus{
+		Path:     p.path,
+		Codes:    idx.len(),
+		Reloads:  p.reloads.Load(),
+		LoadedAt: idx.loadedAt,
+	}
+	if msg := p.lastErr.Load(); msg != nil {
+		status.LastError = *msg
+	}
+	if idx.filter != nil {
+		status.Filter = idx.filter.status()
+	}
+	return status
 }
 
 func (p *CouponLookup) Close() error {
-	if p.data != nil {
-		return syscall.Munmap(p.data)
+	if idx := p.current.Swap(emptyCouponIndex(nil)); idx != nil {
+		idx.release()
 	}
 	return nil
 }
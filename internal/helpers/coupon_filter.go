@@ -0,0 +1,266 @@
+package helpers
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+)
+
+// Bloom filter file layout, little-endian:
+//
+//	[0:8]   magic "FDCPNFLT"
+//	[8:10]  format version
+//	[10:12] number of hash functions
+//	[12:16] CRC-32C of the bit array
+//	[16:24] number of bits
+//	[24:32] number of codes added
+//	[32:36] CRC-32C of the whole codes file the filter was built from
+//	[36:40] reserved, zero
+//	[40:48] target false-positive rate, float64
+//
+// The header is followed by the bit array, bit i being bit i%8 of byte i/8.
+// A filter only answers for the codes file whose checksum it carries; any
+// other file is looked up without it, so a filter that lags behind its codes
+// file can never reject a listed code.
+const (
+	couponFilterMagic      = "FDCPNFLT"
+	couponFilterVersion    = 1
+	couponFilterHeaderSize = 48
+	// DefaultCouponFilterFPR is the false-positive rate cmd/preprocess
+	// builds filters for unless configured otherwise.
+	DefaultCouponFilterFPR = 0.01
+)
+
+var ErrCouponFilterFormat = errors.New("coupon filter: malformed file")
+
+// CouponFilterPath is where the filter for the codes file at codesPath is
+// expected.
+func CouponFilterPath(codesPath string) string {
+	return codesPath + ".filter"
+}
+
+// CouponFilterInfo describes a built filter.
+type CouponFilterInfo struct {
+	Path        string  `json:"path"`
+	Codes       int     `json:"codes"`
+	Bits        uint64  `json:"bits"`
+	Hashes      int     `json:"hashes"`
+	TargetFPR   float64 `json:"targetFpr"`
+	ExpectedFPR float64 `json:"expectedFpr"`
+}
+
+// CouponFilterStatus describes the filter of the loaded codes file. Passed
+// counts codes the filter let through to the file search; FalsePositives
+// are the ones of those the file did not list, and ObservedFPR is their
+// share of all unlisted codes looked up.
+type CouponFilterStatus struct {
+	CouponFilterInfo
+	Rejected       int64   `json:"rejected"`
+	Passed         int64   `json:"passed"`
+	FalsePositives int64   `json:"falsePositives"`
+	ObservedFPR    float64 `json:"observedFpr"`
+}
+
+// couponFilter is a loaded filter file. Its mapping belongs to the
+// couponIndex it was loaded with and is released together with it.
+type couponFilter struct {
+	info CouponFilterInfo
+	data []byte
+	bits []byte
+
+	rejected       atomic.Int64
+	passed         atomic.Int64
+	falsePositives atomic.Int64
+}
+
+// filterHashes derives the two hashes combined into the k bit positions of
+// code (Kirsch–Mitzenmacher double hashing). The result must not change
+// between releases: filters are built by one binary and read by another.
+func filterHashes(code []byte) (h1, h2 uint64) {
+	h := uint64(14695981039346656037) // FNV-1a
+	for _, c := range code {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return mix64(h), mix64(h^0x9e3779b97f4a7c15) | 1
+}
+
+// mix64 is the splitmix64 finaliser.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// filterSize returns the bit and hash counts of a filter for n codes at the
+// false-positive rate fpr.
+func filterSize(n int, fpr float64) (bits uint64, hashes int) {
+	bits = uint64(math.Ceil(-float64(max(n, 1)) * math.Log(fpr) / (math.Ln2 * math.Ln2)))
+	bits = max(bits, 64)
+	hashes = int(math.Round(float64(bits) / float64(max(n, 1)) * math.Ln2))
+	return bits, min(max(hashes, 1), 32)
+}
+
+// expectedFPR is the false-positive rate of a filter with the given
+// dimensions once n codes are added.
+func expectedFPR(bits uint64, hashes, n int) float64 {
+	return math.Pow(1-math.Exp(-float64(hashes)*float64(n)/float64(bits)), float64(hashes))
+}
+
+func (f *couponFilter) mayContain(code string) bool {
+	h1, h2 := filterHashes([]byte(code))
+	for i := 0; i < f.info.Hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % f.info.Bits
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *couponFilter) status() *CouponFilterStatus {
+	s := &CouponFilterStatus{
+		CouponFilterInfo: f.info,
+		Rejected:         f.rejected.Load(),
+		Passed:           f.passed.Load(),
+		FalsePositives:   f.falsePositives.Load(),
+	}
+	if unlisted := s.Rejected + s.FalsePositives; unlisted > 0 {
+		s.ObservedFPR = float64(s.FalsePositives) / float64(unlisted)
+	}
+	return s
+}
+
+// loadCouponFilter maps the filter at path if it was built from codes, the
+// contents of the loaded codes file. It returns nil without an error when
+// there is no filter or it belongs to another version of the file.
+func loadCouponFilter(path string, codes []byte) (*couponFilter, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("coupon filter open: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("coupon filter stat: %w", err)
+	}
+	if info.Size() < couponFilterHeaderSize {
+		return nil, info, ErrCouponFilterFormat
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, info, fmt.Errorf("coupon filter mmap: %w", err)
+	}
+
+	filter, err := parseCouponFilter(data)
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, info, err
+	}
+	if binary.LittleEndian.Uint32(data[32:36]) != crc32.Checksum(codes, castagnoli) {
+		syscall.Munmap(data)
+		return nil, info, nil
+	}
+	filter.info.Path = path
+	return filter, info, nil
+}
+
+func parseCouponFilter(data []byte) (*couponFilter, error) {
+	if len(data) < couponFilterHeaderSize || string(data[:len(couponFilterMagic)]) != couponFilterMagic {
+		return nil, ErrCouponFilterFormat
+	}
+	if v := binary.LittleEndian.Uint16(data[8:10]); v != couponFilterVersion {
+		return nil, fmt.Errorf("coupon filter: unsupported version %d", v)
+	}
+
+	filter := &couponFilter{data: data, bits: data[couponFilterHeaderSize:]}
+	filter.info.Hashes = int(binary.LittleEndian.Uint16(data[10:12]))
+	filter.info.Bits = binary.LittleEndian.Uint64(data[16:24])
+	filter.info.Codes = int(binary.LittleEndian.Uint64(data[24:32]))
+	filter.info.TargetFPR = math.Float64frombits(binary.LittleEndian.Uint64(data[40:48]))
+
+	if filter.info.Hashes == 0 || filter.info.Bits == 0 || uint64(len(filter.bits)) != (filter.info.Bits+7)/8 {
+		return nil, ErrCouponFilterFormat
+	}
+	if crc32.Checksum(filter.bits, castagnoli) != binary.LittleEndian.Uint32(data[12:16]) {
+		return nil, fmt.Errorf("coupon filter: checksum mismatch")
+	}
+	filter.info.ExpectedFPR = expectedFPR(filter.info.Bits, filter.info.Hashes, filter.info.Codes)
+	return filter, nil
+}
+
+// BuildCouponFilter writes a Bloom filter for the codes file at codesPath
+// to filterPath, sized for the false-positive rate fpr. Like the codes file
+// it is written to a temporary file and renamed into place.
+func BuildCouponFilter(codesPath, filterPath string, fpr float64) (CouponFilterInfo, error) {
+	if fpr <= 0 || fpr >= 1 {
+		return CouponFilterInfo{}, fmt.Errorf("coupon filter: false-positive rate %v must be in (0, 1)", fpr)
+	}
+
+	idx, err := loadCouponIndex(codesPath)
+	if err != nil {
+		return CouponFilterInfo{}, err
+	}
+	defer idx.release()
+
+	n := idx.len()
+	info := CouponFilterInfo{Path: filterPath, Codes: n, TargetFPR: fpr}
+	info.Bits, info.Hashes = filterSize(n, fpr)
+	info.ExpectedFPR = expectedFPR(info.Bits, info.Hashes, n)
+
+	bits := make([]byte, (info.Bits+7)/8)
+	for i := 0; i < n; i++ {
+		h1, h2 := filterHashes(idx.at(i))
+		for j := 0; j < info.Hashes; j++ {
+			bit := (h1 + uint64(j)*h2) % info.Bits
+			bits[bit/8] |= 1 << (bit % 8)
+		}
+	}
+
+	var header [couponFilterHeaderSize]byte
+	copy(header[:], couponFilterMagic)
+	binary.LittleEndian.PutUint16(header[8:10], couponFilterVersion)
+	binary.LittleEndian.PutUint16(header[10:12], uint16(info.Hashes))
+	binary.LittleEndian.PutUint32(header[12:16], crc32.Checksum(bits, castagnoli))
+	binary.LittleEndian.PutUint64(header[16:24], info.Bits)
+	binary.LittleEndian.PutUint64(header[24:32], uint64(n))
+	binary.LittleEndian.PutUint32(header[32:36], crc32.Checksum(idx.data, castagnoli))
+	binary.LittleEndian.PutUint64(header[40:48], math.Float64bits(fpr))
+
+	out, err := os.CreateTemp(filepath.Dir(filterPath), filepath.Base(filterPath)+".tmp*")
+	if err != nil {
+		return CouponFilterInfo{}, err
+	}
+	defer os.Remove(out.Name())
+
+	w := bufio.NewWriter(out)
+	w.Write(header[:])
+	w.Write(bits)
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return CouponFilterInfo{}, err
+	}
+	if err := out.Chmod(0o644); err != nil {
+		out.Close()
+		return CouponFilterInfo{}, err
+	}
+	if err := out.Close(); err != nil {
+		return CouponFilterInfo{}, err
+	}
+	return info, os.Rename(out.Name(), filterPath)
+}
@@ -0,0 +1,205 @@
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+)
+
+// Binary coupon index layout, little-endian:
+//
+//	[0:8]   magic "FDCPNIDX"
+//	[8:10]  format version
+//	[10:12] code width in bytes
+//	[12:16] CRC-32C of the record section
+//	[16:24] record count
+//	[24:32] reserved, zero
+//
+// The header is followed by count sorted records of exactly width bytes,
+// each holding one code padded with NUL bytes. Padding sorts before every
+// printable character, so records compare in the same order as the codes.
+//
+// Version 2 appends the code's validity to every record: two int64 Unix
+// times (seconds) for the start and end, zero meaning open. The width in the
+// header still counts only the code bytes.
+const (
+	couponIndexMagic      = "FDCPNIDX"
+	couponIndexVersion    = 1
+	couponIndexVersion2   = 2
+	couponIndexHeaderSize = 32
+	couponValiditySize    = 16
+	// MaxCouponIndexWidth bounds the record width of the binary format.
+	MaxCouponIndexWidth = 255
+)
+
+var (
+	ErrCouponIndexFormat   = errors.New("coupon index: malformed file")
+	ErrCouponIndexChecksum = errors.New("coupon index: checksum mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// isCouponIndex reports whether data starts with the binary index magic.
+func isCouponIndex(data []byte) bool {
+	return len(data) >= len(couponIndexMagic) && string(data[:len(couponIndexMagic)]) == couponIndexMagic
+}
+
+// parseCouponIndex validates the header and checksum of a binary index and
+// returns the record section, the code width, the record size and the
+// record count.
+func parseCouponIndex(data []byte) (records []byte, width, size, count int, err error) {
+	if len(data) < couponIndexHeaderSize || !isCouponIndex(data) {
+		return nil, 0, 0, 0, ErrCouponIndexFormat
+	}
+
+	width = int(binary.LittleEndian.Uint16(data[10:12]))
+	switch v := binary.LittleEndian.Uint16(data[8:10]); v {
+	case couponIndexVersion:
+		size = width
+	case couponIndexVersion2:
+		size = width + couponValiditySize
+	default:
+		return nil, 0, 0, 0, fmt.Errorf("coupon index: unsupported version %d", v)
+	}
+
+	sum := binary.LittleEndian.Uint32(data[12:16])
+	n := binary.LittleEndian.Uint64(data[16:24])
+	records = data[couponIndexHeaderSize:]
+
+	if width == 0 || width > MaxCouponIndexWidth || n != uint64(len(records)/size) || len(records)%size != 0 {
+		return nil, 0, 0, 0, ErrCouponIndexFormat
+	}
+	if crc32.Checksum(records, castagnoli) != sum {
+		return nil, 0, 0, 0, ErrCouponIndexChecksum
+	}
+	return records, width, size, int(n), nil
+}
+
+// decodeValidity reads the validity stored after the code in a version 2
+// record.
+func decodeValidity(b []byte) domain.CouponValidity {
+	var v domain.CouponValidity
+	if s := int64(binary.LittleEndian.Uint64(b[0:8])); s != 0 {
+		v.StartsAt = time.Unix(s, 0).UTC()
+	}
+	if e := int64(binary.LittleEndian.Uint64(b[8:16])); e != 0 {
+		v.EndsAt = time.Unix(e, 0).UTC()
+	}
+	return v
+}
+
+func unixOrZero(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix())
+}
+
+// CouponIndexWriter streams sorted codes into the binary index format. The
+// header is written last, once the count and checksum are known, so the
+// destination must be seekable.
+type CouponIndexWriter struct {
+	dst     io.WriteSeeker
+	buf     *bufio.Writer
+	crc     uint32
+	version uint16
+	width   int
+	count   uint64
+	rec     []byte
+	last    []byte
+}
+
+// NewCouponIndexWriter writes a version 1 index, which cannot hold
+// validity periods.
+func NewCouponIndexWriter(dst io.WriteSeeker, width int) (*CouponIndexWriter, error) {
+	return newCouponIndexWriter(dst, width, couponIndexVersion)
+}
+
+// NewCouponIndexWriterWithValidity writes a version 2 index, which stores a
+// validity period with every code.
+func NewCouponIndexWriterWithValidity(dst io.WriteSeeker, width int) (*CouponIndexWriter, error) {
+	return newCouponIndexWriter(dst, width, couponIndexVersion2)
+}
+
+func newCouponIndexWriter(dst io.WriteSeeker, width int, version uint16) (*CouponIndexWriter, error) {
+	if width < 1 || width > MaxCouponIndexWidth {
+		return nil, fmt.Errorf("coupon index: width %d out of range", width)
+	}
+	if _, err := dst.Seek(couponIndexHeaderSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	size := width
+	if version == couponIndexVersion2 {
+		size += couponValiditySize
+	}
+	return &CouponIndexWriter{
+		dst:     dst,
+		buf:     bufio.NewWriter(dst),
+		version: version,
+		width:   width,
+		rec:     make([]byte, size),
+	}, nil
+}
+
+// Write appends code, which must sort strictly after the previous one.
+func (w *CouponIndexWriter) Write(code string) error {
+	return w.WriteValidity(code, domain.CouponValidity{})
+}
+
+// WriteValidity appends code with its validity period. A version 1 index
+// only accepts codes that are valid forever.
+func (w *CouponIndexWriter) WriteValidity(code string, v domain.CouponValidity) error {
+	if len(code) == 0 || len(code) > w.width {
+		return fmt.Errorf("coupon index: code %q does not fit width %d", code, w.width)
+	}
+	if w.count > 0 && code <= string(w.last) {
+		return fmt.Errorf("coupon index: code %q out of order", code)
+	}
+
+	clear(w.rec)
+	copy(w.rec, code)
+	if bytes.IndexByte(w.rec[:len(code)], 0) >= 0 {
+		return fmt.Errorf("coupon index: code %q contains NUL", code)
+	}
+	if w.version == couponIndexVersion2 {
+		binary.LittleEndian.PutUint64(w.rec[w.width:], unixOrZero(v.StartsAt))
+		binary.LittleEndian.PutUint64(w.rec[w.width+8:], unixOrZero(v.EndsAt))
+	} else if !v.IsZero() {
+		return fmt.Errorf("coupon index: version 1 cannot store the validity of %q", code)
+	}
+	if _, err := w.buf.Write(w.rec); err != nil {
+		return err
+	}
+
+	w.crc = crc32.Update(w.crc, castagnoli, w.rec)
+	w.last = append(w.last[:0], code...)
+	w.count++
+	return nil
+}
+
+// Close flushes the records and writes the header. It does not close dst.
+func (w *CouponIndexWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+
+	var header [couponIndexHeaderSize]byte
+	copy(header[:], couponIndexMagic)
+	binary.LittleEndian.PutUint16(header[8:10], w.version)
+	binary.LittleEndian.PutUint16(header[10:12], uint16(w.width))
+	binary.LittleEndian.PutUint32(header[12:16], w.crc)
+	binary.LittleEndian.PutUint64(header[16:24], w.count)
+
+	if _, err := w.dst.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := w.dst.Write(header[:])
+	return err
+}
@@ -0,0 +1,69 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+)
+
+// DefaultCouponRule is applied to valid codes that have no rule of their own.
+var DefaultCouponRule = domain.CouponRule{
+	Type:       domain.CouponRulePercentage,
+	PercentOff: 10,
+}
+
+// CouponRules maps coupon codes to their discount rule. It is loaded from a
+// JSON file of the form:
+//
+//	{
+//	  "default": {"type": "percentage", "percentOff": 10},
+//	  "coupons": {
+//	    "GNULINUX": {"type": "fixed_amount", "amountOff": 5, "minBasket": 20}
+//	  },
+//	  "stacking": {"policy": "by_category"}
+//	}
+type CouponRules struct {
+	Default  domain.CouponRule            `json:"default"`
+	Coupons  map[string]domain.CouponRule `json:"coupons"`
+	Stacking domain.StackingPolicy        `json:"stacking"`
+}
+
+func LoadCouponRules(path string) (*CouponRules, error) {
+	rules := &CouponRules{Default: DefaultCouponRule}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rules, nil
+		}
+		return nil, fmt.Errorf("coupon rules read: %w", err)
+	}
+
+	if err := json.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("coupon rules decode: %w", err)
+	}
+
+	if err := rules.Default.Validate(); err != nil {
+		return nil, fmt.Errorf("coupon rules default: %w", err)
+	}
+	for code, rule := range rules.Coupons {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("coupon rules %s: %w", code, err)
+		}
+	}
+	if err := rules.Stacking.Validate(); err != nil {
+		return nil, fmt.Errorf("coupon rules stacking: %w", err)
+	}
+
+	return rules, nil
+}
+
+// Rule returns the rule for code, falling back to the default rule.
+func (r *CouponRules) Rule(code string) domain.CouponRule {
+	if rule, ok := r.Coupons[code]; ok {
+		return rule
+	}
+	return r.Default
+}
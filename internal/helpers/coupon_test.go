@@ -0,0 +1,423 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+)
+
+func writeCodesFile(t *testing.T, path, contents string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCouponLookupReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valid_codes.txt")
+	writeCodesFile(t, path, "AAAAAAAA\nBBBBBBBB\n")
+
+	lookup, err := NewCouponLookup(path, DefaultCodeRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Close()
+
+	if !lookup.IsValid("AAAAAAAA") || lookup.IsValid("CCCCCCCC") {
+		t.Fatal("unexpected initial lookup result")
+	}
+
+	writeCodesFile(t, path, "BBBBBBBB\nCCCCCCCC\n")
+	changed, err := lookup.changed()
+	if err != nil || !changed {
+		t.Fatalf("expected file change to be detected, got %v (%v)", changed, err)
+	}
+	if err := lookup.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if lookup.IsValid("AAAAAAAA") || !lookup.IsValid("CCCCCCCC") {
+		t.Error("expected reloaded codes to be live")
+	}
+	if got := lookup.Check("SHORT"); got != domain.CouponWrongLength {
+		t.Errorf("expected wrong_length, got %q", got)
+	}
+
+	status := lookup.Status()
+	if status.Reloads != 1 || status.Codes != 2 || status.LastError != "" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestCouponLookupReloadMissingFileKeepsCodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valid_codes.txt")
+	writeCodesFile(t, path, "AAAAAAAA\n")
+
+	lookup, err := NewCouponLookup(path, DefaultCodeRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Close()
+
+	os.Remove(path)
+	if err := lookup.Reload(); err == nil {
+		t.Fatal("expected error reloading a missing file")
+	}
+	if !lookup.IsValid("AAAAAAAA") {
+		t.Error("expected previous codes to stay live")
+	}
+	if lookup.Status().LastError == "" {
+		t.Error("expected status to report the reload error")
+	}
+}
+
+func TestCouponLookupConcurrentReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valid_codes.txt")
+	writeCodesFile(t, path, "AAAAAAAA\nBBBBBBBB\n")
+
+	lookup, err := NewCouponLookup(path, DefaultCodeRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Close()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if !lookup.IsValid("BBBBBBBB") {
+					t.Error("BBBBBBBB is present in every generation")
+					return
+				}
+			}
+		}()
+	}
+
+	for i := range 200 {
+		if i%2 == 0 {
+			writeCodesFile(t, path, "BBBBBBBB\nCCCCCCCC\n")
+		} else {
+			writeCodesFile(t, path, "AAAAAAAA\nBBBBBBBB\n")
+		}
+		if err := lookup.Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func writeIndexFile(t *testing.T, path string, width int, codes ...string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := NewCouponIndexWriter(f, width)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range codes {
+		if err := w.Write(code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCouponLookupBinaryIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valid_codes.idx")
+	writeIndexFile(t, path, 10, "AAAAAAAA", "AAAAAAAAA", "BBBBBBBBBB", "CCCCCCCC")
+
+	lookup, err := NewCouponLookup(path, DefaultCodeRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Close()
+
+	for _, code := range []string{"AAAAAAAA", "AAAAAAAAA", "BBBBBBBBBB", "CCCCCCCC"} {
+		if !lookup.IsValid(code) {
+			t.Errorf("expected %q to be valid", code)
+		}
+	}
+	for _, code := range []string{"AAAAAAAAAA", "BBBBBBBB", "DDDDDDDD"} {
+		if lookup.IsValid(code) {
+			t.Errorf("expected %q to be unknown", code)
+		}
+	}
+	if got := lookup.Status().Codes; got != 4 {
+		t.Errorf("expected 4 codes, got %d", got)
+	}
+}
+
+func TestCouponIndexWriterRejectsUnsorted(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "valid_codes.idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, _ := NewCouponIndexWriter(f, 10)
+	w.Write("BBBBBBBB")
+	if err := w.Write("AAAAAAAA"); err == nil {
+		t.Error("expected out of order error")
+	}
+	if err := w.Write("BBBBBBBB"); err == nil {
+		t.Error("expected duplicate to be rejected")
+	}
+	if err := w.Write("CCCCCCCCCCC"); err == nil {
+		t.Error("expected code wider than the record to be rejected")
+	}
+}
+
+func TestCouponLookupBinaryIndexChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valid_codes.idx")
+	writeIndexFile(t, path, 10, "AAAAAAAA", "BBBBBBBB")
+
+	data, _ := os.ReadFile(path)
+	data[couponIndexHeaderSize] = 'Z'
+	os.WriteFile(path, data, 0o644)
+
+	if _, err := NewCouponLookup(path, DefaultCodeRules); !errors.Is(err, ErrCouponIndexChecksum) {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+}
+
+func TestCouponLookupValidity(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 2, 1, 12, 30, 0, 0, time.UTC)
+
+	text := filepath.Join(dir, "valid_codes.txt")
+	writeCodesFile(t, text, "AAAAAAAA,2026-01-01,2026-02-01T12:30:00Z\nBBBBBBBB\nCCCCCCCC,,2026-02-01T12:30:00Z\n")
+
+	f, err := os.Create(filepath.Join(dir, "valid_codes.idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := NewCouponIndexWriterWithValidity(f, 10)
+	w.WriteValidity("AAAAAAAA", domain.CouponValidity{StartsAt: start, EndsAt: end})
+	w.Write("BBBBBBBB")
+	w.WriteValidity("CCCCCCCC", domain.CouponValidity{EndsAt: end})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	for _, path := range []string{text, f.Name()} {
+		lookup, err := NewCouponLookup(path, DefaultCodeRules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, r := lookup.Lookup("AAAAAAAA"); r != "" || !v.StartsAt.Equal(start) || !v.EndsAt.Equal(end) {
+			t.Errorf("%s: unexpected AAAAAAAA validity %+v (%q)", path, v, r)
+		}
+		if v, r := lookup.Lookup("BBBBBBBB"); r != "" || !v.IsZero() {
+			t.Errorf("%s: expected BBBBBBBB valid forever, got %+v (%q)", path, v, r)
+		}
+		if v, r := lookup.Lookup("CCCCCCCC"); r != "" || !v.StartsAt.IsZero() || !v.EndsAt.Equal(end) {
+			t.Errorf("%s: unexpected CCCCCCCC validity %+v (%q)", path, v, r)
+		}
+		if _, r := lookup.Lookup("DDDDDDDD"); r != domain.CouponUnknownCode {
+			t.Errorf("%s: expected DDDDDDDD unknown, got %q", path, r)
+		}
+		lookup.Close()
+	}
+}
+
+func TestCouponLookupRejectsMalformedValidity(t *testing.T) {
+	dir := t.TempDir()
+	for i, contents := range []string{
+		"AAAAAAAA,2026-01-01\n",
+		"AAAAAAAA,tomorrow,\n",
+		"AAAAAAAA,2026-02-01,2026-01-01\n",
+	} {
+		path := filepath.Join(dir, strconv.Itoa(i)+".txt")
+		writeCodesFile(t, path, contents)
+		if _, err := NewCouponLookup(path, DefaultCodeRules); err == nil {
+			t.Errorf("expected %q to fail to load", contents)
+		}
+	}
+
+	f, _ := os.Create(filepath.Join(dir, "v1.idx"))
+	defer f.Close()
+	w, _ := NewCouponIndexWriter(f, 10)
+	if err := w.WriteValidity("AAAAAAAA", domain.CouponValidity{EndsAt: time.Now()}); err == nil {
+		t.Error("expected version 1 index to reject a validity period")
+	}
+}
+
+func TestCouponLookupCheckDoesNotAllocate(t *testing.T) {
+	dir := t.TempDir()
+	text := filepath.Join(dir, "valid_codes.txt")
+	writeCodesFile(t, text, "AAAAAAAA\nBBBBBBBB\nCCCCCCCC\n")
+	bin := filepath.Join(dir, "valid_codes.idx")
+	writeIndexFile(t, bin, 10, "AAAAAAAA", "BBBBBBBB", "CCCCCCCC")
+
+	for _, path := range []string{text, bin} {
+		lookup, err := NewCouponLookup(path, DefaultCodeRules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		allocs := testing.AllocsPerRun(100, func() {
+			lookup.Check("BBBBBBBB")
+			lookup.Check("BBBBBBBZ")
+		})
+		if allocs != 0 {
+			t.Errorf("%s: expected no allocations, got %v", filepath.Base(path), allocs)
+		}
+		lookup.Close()
+	}
+}
+
+func TestCouponLookupCodeRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valid_codes.txt")
+	writeCodesFile(t, path, "ABC123\nabcdef\n")
+
+	rules := CodeRules{MinLength: 6, MaxLength: 6, Pattern: regexp.MustCompile(`^(?:[A-Z0-9]+)$`)}
+	lookup, err := NewCouponLookup(path, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Close()
+
+	if got := lookup.Check("ABC123"); got != "" {
+		t.Errorf("expected ABC123 to be valid, got %q", got)
+	}
+	if got := lookup.Check("abcdef"); got != domain.CouponUnknownCode {
+		t.Errorf("expected pattern mismatch to be unknown_code, got %q", got)
+	}
+	if got := lookup.Check("ABC1234"); got != domain.CouponWrongLength {
+		t.Errorf("expected wrong_length, got %q", got)
+	}
+}
+
+func TestCodeRulesFromEnv(t *testing.T) {
+	t.Setenv("COUPON_MIN_LENGTH", "4")
+	t.Setenv("COUPON_MAX_LENGTH", "6")
+	t.Setenv("COUPON_PATTERN", "[A-Z]+")
+
+	rules, err := CodeRulesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rules.Accept("ABCD") || rules.Accept("ABC") || rules.Accept("ABCD1") || rules.Accept("XABCDEF") {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+
+	t.Setenv("COUPON_MAX_LENGTH", "3")
+	if _, err := CodeRulesFromEnv(); err == nil {
+		t.Error("expected error when max length is below min length")
+	}
+}
+
+func TestCouponFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valid_codes.txt")
+	var codes []string
+	var contents []byte
+	for i := range 2000 {
+		codes = append(codes, fmt.Sprintf("C%07d", i*2))
+	}
+	slices.Sort(codes)
+	for _, c := range codes {
+		contents = append(contents, c+"\n"...)
+	}
+	writeCodesFile(t, path, string(contents))
+
+	info, err := BuildCouponFilter(path, CouponFilterPath(path), 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Codes != len(codes) || info.ExpectedFPR > 0.011 {
+		t.Fatalf("unexpected filter %+v", info)
+	}
+
+	lookup, err := NewCouponLookup(path, DefaultCodeRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Close()
+
+	for _, c := range codes {
+		if !lookup.IsValid(c) {
+			t.Fatalf("expected %s to be valid", c)
+		}
+	}
+	const unlisted = 10000
+	for i := range unlisted {
+		if lookup.IsValid(fmt.Sprintf("C%07d", i*2+1)) {
+			t.Fatalf("expected C%07d to be unknown", i*2+1)
+		}
+	}
+
+	status := lookup.Status().Filter
+	if status == nil {
+		t.Fatal("expected filter to be loaded")
+	}
+	if status.Rejected+status.FalsePositives != unlisted || status.Passed != int64(len(codes))+status.FalsePositives {
+		t.Errorf("inconsistent counters %+v", status)
+	}
+	if status.ObservedFPR > 0.03 {
+		t.Errorf("observed false-positive rate %.4f too far above target", status.ObservedFPR)
+	}
+}
+
+func TestCouponFilterForOtherFileIgnored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valid_codes.txt")
+	writeCodesFile(t, path, "AAAAAAAA\n")
+	if _, err := BuildCouponFilter(path, CouponFilterPath(path), 0.01); err != nil {
+		t.Fatal(err)
+	}
+	writeCodesFile(t, path, "AAAAAAAA\nBBBBBBBB\n")
+
+	lookup, err := NewCouponLookup(path, DefaultCodeRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Close()
+
+	if lookup.Status().Filter != nil {
+		t.Error("expected stale filter to be ignored")
+	}
+	if !lookup.IsValid("BBBBBBBB") {
+		t.Error("expected code missing from the stale filter to be valid")
+	}
+
+	if _, err := BuildCouponFilter(path, CouponFilterPath(path), 0.01); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := lookup.changed(); err != nil || !changed {
+		t.Fatalf("expected new filter to be detected, got %v (%v)", changed, err)
+	}
+	if err := lookup.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if lookup.Status().Filter == nil || !lookup.IsValid("BBBBBBBB") {
+		t.Error("expected rebuilt filter to be loaded")
+	}
+}
@@ -0,0 +1,93 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+)
+
+// Codes with a validity period are written to text files as
+// "code,start,end", either bound possibly empty; plain codes stay on a line
+// of their own. A comma sorts before every character a code may contain, so
+// lines still sort by code.
+
+// ParseValidityBound parses one bound of a validity period: an RFC 3339
+// timestamp, a plain date (midnight UTC) or "" for an open bound. Bounds are
+// truncated to whole seconds, the precision of every output format.
+func ParseValidityBound(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC().Truncate(time.Second), nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q must be an RFC 3339 timestamp or YYYY-MM-DD date", s)
+}
+
+// ParseValidity parses the start and end of a validity period.
+func ParseValidity(start, end string) (domain.CouponValidity, error) {
+	var v domain.CouponValidity
+	var err error
+	if v.StartsAt, err = ParseValidityBound(start); err != nil {
+		return v, fmt.Errorf("start: %w", err)
+	}
+	if v.EndsAt, err = ParseValidityBound(end); err != nil {
+		return v, fmt.Errorf("end: %w", err)
+	}
+	if !v.StartsAt.IsZero() && !v.EndsAt.IsZero() && !v.StartsAt.Before(v.EndsAt) {
+		return v, errors.New("start must be before end")
+	}
+	return v, nil
+}
+
+// FormatCouponLine renders code and its validity as a line of the text
+// format, without the newline.
+func FormatCouponLine(code string, v domain.CouponValidity) string {
+	if v.IsZero() {
+		return code
+	}
+	return code + "," + formatBound(v.StartsAt) + "," + formatBound(v.EndsAt)
+}
+
+func formatBound(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// ParseCouponLine parses one line of the text format: a code, optionally
+// followed by its validity period.
+func ParseCouponLine(line string) (string, domain.CouponValidity, error) {
+	code, rest := splitCouponLine([]byte(line))
+	if rest == nil {
+		return line, domain.CouponValidity{}, nil
+	}
+	v, err := parseLineValidity(rest)
+	return string(code), v, err
+}
+
+// splitCouponLine returns the code of a text format line and the validity
+// fields that follow it, if any.
+func splitCouponLine(line []byte) (code, rest []byte) {
+	if i := bytes.IndexByte(line, ','); i >= 0 {
+		return line[:i], line[i+1:]
+	}
+	return line, nil
+}
+
+func parseLineValidity(rest []byte) (domain.CouponValidity, error) {
+	start, end, ok := strings.Cut(string(rest), ",")
+	if !ok {
+		return domain.CouponValidity{}, errors.New("expected code,start,end")
+	}
+	return ParseValidity(start, end)
+}
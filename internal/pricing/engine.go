@@ -0,0 +1,119 @@
+package pricing
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+)
+
+var (
+	ErrBelowMinimumBasket = errors.New("basket is below the coupon minimum")
+	ErrNoEligibleItems    = errors.New("no items in the basket are eligible for the coupon")
+	ErrNotEnoughItems     = errors.New("not enough eligible items for the coupon")
+)
+
+// Engine evaluates coupon rules against a priced basket.
+type Engine struct{}
+
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// Evaluate returns the discount rule grants on lines. products must contain
+// every product referenced by lines; it supplies the categories used for
+// eligibility. The discount never exceeds the basket subtotal.
+func (e *Engine) Evaluate(rule domain.CouponRule, lines []domain.OrderLine, products []domain.Product) (domain.Money, error) {
+	var subtotal domain.Money
+	for _, l := range lines {
+		subtotal += l.LineTotal
+	}
+	if subtotal < rule.MinBasket {
+		return 0, ErrBelowMinimumBasket
+	}
+
+	eligible := eligibleLines(rule, lines, products)
+	if len(eligible) == 0 {
+		return 0, ErrNoEligibleItems
+	}
+
+	var eligibleSubtotal domain.Money
+	for _, l := range eligible {
+		eligibleSubtotal += l.LineTotal
+	}
+
+	var discount domain.Money
+	switch rule.Type {
+	case domain.CouponRulePercentage:
+		discount = eligibleSubtotal.Percent(rule.PercentOff)
+	case domain.CouponRuleFixed:
+		discount = min(rule.AmountOff, eligibleSubtotal)
+	case domain.CouponRuleFreeItem:
+		discount = eligible[0].UnitPrice
+	case domain.CouponRuleBuyXGetY:
+		var err error
+		discount, err = buyXGetYDiscount(rule, eligible)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if rule.MaxDiscount > 0 {
+		discount = min(discount, rule.MaxDiscount)
+	}
+	return min(discount, subtotal), nil
+}
+
+func eligibleLines(rule domain.CouponRule, lines []domain.OrderLine, products []domain.Product) []domain.OrderLine {
+	categories := make(map[string]string, len(products))
+	for _, p := range products {
+		categories[p.ID] = p.Category
+	}
+
+	var eligible []domain.OrderLine
+	for _, l := range lines {
+		if rule.ProductID != "" && l.ProductID != rule.ProductID {
+			continue
+		}
+		if len(rule.Categories) > 0 && !slices.Contains(rule.Categories, categories[l.ProductID]) {
+			continue
+		}
+		eligible = append(eligible, l)
+	}
+	return eligible
+}
+
+// buyXGetYDiscount makes the cheapest units free: for every
+// BuyQuantity+GetQuantity eligible units, GetQuantity of them cost nothing.
+func buyXGetYDiscount(rule domain.CouponRule, eligible []domain.OrderLine) (domain.Money, error) {
+	units := 0
+	for _, l := range eligible {
+		units += l.Quantity
+	}
+
+	free := units / (rule.BuyQuantity + rule.GetQuantity) * rule.GetQuantity
+	if free == 0 {
+		return 0, ErrNotEnoughItems
+	}
+
+	byPrice := slices.Clone(eligible)
+	slices.SortStableFunc(byPrice, func(a, b domain.OrderLine) int {
+		return cmp.Compare(a.UnitPrice, b.UnitPrice)
+	})
+
+	var discount domain.Money
+	for _, l := range byPrice {
+		n := min(l.Quantity, free)
+		d, err := l.UnitPrice.Mul(n)
+		if err != nil {
+			return 0, err
+		}
+		discount += d
+		free -= n
+		if free == 0 {
+			break
+		}
+	}
+	return discount, nil
+}
@@ -0,0 +1,171 @@
+package pricing
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+)
+
+var testProducts = []domain.Product{
+	{ID: "1", Name: "Waffle with Berries", Price: 650, Category: "Waffle"},
+	{ID: "3", Name: "Macaron Mix of Five", Price: 800, Category: "Macaron"},
+	{ID: "5", Name: "Pistachio Baklava", Price: 400, Category: "Baklava"},
+}
+
+func line(productID string, qty int) domain.OrderLine {
+	for _, p := range testProducts {
+		if p.ID == productID {
+			total, err := p.Price.Mul(qty)
+			if err != nil {
+				panic(err)
+			}
+			return domain.OrderLine{
+				ProductID:   p.ID,
+				ProductName: p.Name,
+				Quantity:    qty,
+				UnitPrice:   p.Price,
+				LineTotal:   total,
+			}
+		}
+	}
+	panic("unknown product " + productID)
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    domain.CouponRule
+		lines   []domain.OrderLine
+		want    domain.Money
+		wantErr error
+	}{
+		{
+			name:  "percentage of whole basket",
+			rule:  domain.CouponRule{Type: domain.CouponRulePercentage, PercentOff: 10},
+			lines: []domain.OrderLine{line("1", 2), line("3", 1)},
+			want:  210,
+		},
+		{
+			name:  "percentage limited to categories",
+			rule:  domain.CouponRule{Type: domain.CouponRulePercentage, PercentOff: 50, Categories: []string{"Macaron"}},
+			lines: []domain.OrderLine{line("1", 2), line("3", 1)},
+			want:  400,
+		},
+		{
+			name:  "percentage capped",
+			rule:  domain.CouponRule{Type: domain.CouponRulePercentage, PercentOff: 50, MaxDiscount: 300},
+			lines: []domain.OrderLine{line("1", 2)},
+			want:  300,
+		},
+		{
+			name:  "fixed amount",
+			rule:  domain.CouponRule{Type: domain.CouponRuleFixed, AmountOff: 500},
+			lines: []domain.OrderLine{line("1", 2)},
+			want:  500,
+		},
+		{
+			name:  "fixed amount never exceeds basket",
+			rule:  domain.CouponRule{Type: domain.CouponRuleFixed, AmountOff: 5000},
+			lines: []domain.OrderLine{line("1", 1)},
+			want:  650,
+		},
+		{
+			name:    "below minimum basket",
+			rule:    domain.CouponRule{Type: domain.CouponRuleFixed, AmountOff: 500, MinBasket: 2000},
+			lines:   []domain.OrderLine{line("1", 2)},
+			wantErr: ErrBelowMinimumBasket,
+		},
+		{
+			name:  "free item",
+			rule:  domain.CouponRule{Type: domain.CouponRuleFreeItem, ProductID: "5"},
+			lines: []domain.OrderLine{line("1", 1), line("5", 3)},
+			want:  400,
+		},
+		{
+			name:    "free item not in basket",
+			rule:    domain.CouponRule{Type: domain.CouponRuleFreeItem, ProductID: "5"},
+			lines:   []domain.OrderLine{line("1", 1)},
+			wantErr: ErrNoEligibleItems,
+		},
+		{
+			name:  "buy two get one, cheapest free",
+			rule:  domain.CouponRule{Type: domain.CouponRuleBuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			lines: []domain.OrderLine{line("3", 4), line("5", 2)},
+			want:  800,
+		},
+		{
+			name:    "buy two get one, not enough items",
+			rule:    domain.CouponRule{Type: domain.CouponRuleBuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			lines:   []domain.OrderLine{line("3", 2)},
+			wantErr: ErrNotEnoughItems,
+		},
+	}
+
+	engine := NewEngine()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := engine.Evaluate(tt.rule, tt.lines, testProducts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected discount %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStack(t *testing.T) {
+	candidates := []StackCandidate{
+		{Discount: 300, Categories: []string{"Waffle"}},
+		{Discount: 500, Categories: []string{"Baklava", "Waffle"}},
+		{Discount: 200, Categories: []string{"Macaron"}},
+		{Discount: 500, Categories: []string{"Macaron"}},
+	}
+
+	tests := []struct {
+		name   string
+		policy domain.StackingPolicy
+		want   []int
+	}{
+		{name: "zero policy is exclusive", want: []int{0}},
+		{name: "exclusive keeps request order", policy: domain.StackingPolicy{Type: domain.StackExclusive}, want: []int{0}},
+		{name: "best single breaks ties by request order", policy: domain.StackingPolicy{Type: domain.StackBestSingle}, want: []int{1}},
+		{name: "stack up to max", policy: domain.StackingPolicy{Type: domain.StackUpTo, MaxCoupons: 3}, want: []int{1, 3, 0}},
+		{name: "by category skips overlaps", policy: domain.StackingPolicy{Type: domain.StackByCategory}, want: []int{1, 3}},
+		{name: "by category capped", policy: domain.StackingPolicy{Type: domain.StackByCategory, MaxCoupons: 1}, want: []int{1}},
+	}
+
+	engine := NewEngine()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := engine.Stack(tt.policy, candidates)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEligibleCategories(t *testing.T) {
+	lines := []domain.OrderLine{line("5", 1), line("1", 2), line("3", 1)}
+	engine := NewEngine()
+
+	got := engine.EligibleCategories(domain.CouponRule{Type: domain.CouponRulePercentage, PercentOff: 10}, lines, testProducts)
+	if want := []string{"Baklava", "Macaron", "Waffle"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	got = engine.EligibleCategories(domain.CouponRule{Type: domain.CouponRuleFreeItem, ProductID: "3"}, lines, testProducts)
+	if want := []string{"Macaron"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,76 @@
+package pricing
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+)
+
+// StackCandidate is a coupon that applies to the basket on its own: the
+// discount it grants and the categories of the lines it discounts.
+type StackCandidate struct {
+	Discount   domain.Money
+	Categories []string
+}
+
+// Stack returns the indexes of the candidates policy lets apply together, in
+// the order their discounts should be taken. Candidates are listed in request
+// order; ties on discount go to the earlier candidate.
+func (e *Engine) Stack(policy domain.StackingPolicy, candidates []StackCandidate) []int {
+	if len(candidates) == 0 {
+		return nil
+	}
+	if policy.Type == "" || policy.Type == domain.StackExclusive {
+		return []int{0}
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(candidates[b].Discount, candidates[a].Discount)
+	})
+
+	switch policy.Type {
+	case domain.StackBestSingle:
+		return order[:1]
+	case domain.StackUpTo:
+		return order[:min(policy.MaxCoupons, len(order))]
+	}
+
+	var chosen []int
+	taken := make(map[string]bool)
+	for _, i := range order {
+		if policy.MaxCoupons > 0 && len(chosen) == policy.MaxCoupons {
+			break
+		}
+		if slices.ContainsFunc(candidates[i].Categories, func(c string) bool { return taken[c] }) {
+			continue
+		}
+		for _, c := range candidates[i].Categories {
+			taken[c] = true
+		}
+		chosen = append(chosen, i)
+	}
+	return chosen
+}
+
+// EligibleCategories returns the distinct categories of the lines rule
+// discounts, sorted.
+func (e *Engine) EligibleCategories(rule domain.CouponRule, lines []domain.OrderLine, products []domain.Product) []string {
+	categories := make(map[string]string, len(products))
+	for _, p := range products {
+		categories[p.ID] = p.Category
+	}
+
+	var out []string
+	for _, l := range eligibleLines(rule, lines, products) {
+		if c := categories[l.ProductID]; !slices.Contains(out, c) {
+			out = append(out, c)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
@@ -1,15 +1,91 @@
 package service
 
-import "github.com/Sanjaiy/foodieapp/internal/helpers"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
+	"github.com/Sanjaiy/foodieapp/internal/store"
+)
+
+// ErrReloadUnsupported is returned by ReloadCodes and CodesStatus when the
+// coupon store is not loaded from a file, e.g. the Postgres store.
+var ErrReloadUnsupported = errors.New("coupon store does not support reloading")
+
+// codeReloader is implemented by coupon stores that load codes from a file.
+type codeReloader interface {
+	Reload() error
+	Status() helpers.CouponLookupStatus
+}
 
 type PromoService struct {
-	lookup *helpers.CouponLookup
+	coupons store.CouponStore
+	rules   *helpers.CouponRules
+	guard   *CouponGuard
+	now     func() time.Time
+}
+
+// NewPromoService checks validity periods and coupon hours against now,
+// normally time.Now. A nil guard disables brute-force protection.
+func NewPromoService(coupons store.CouponStore, rules *helpers.CouponRules, guard *CouponGuard, now func() time.Time) *PromoService {
+	return &PromoService{coupons: coupons, rules: rules, guard: guard, now: now}
+}
+
+func (s *PromoService) ValidateCoupon(ctx context.Context, code string) (bool, error) {
+	_, reason, err := s.Lookup(ctx, code)
+	return reason == "" && err == nil, err
 }
 
-func NewPromoService(lookup *helpers.CouponLookup) *PromoService {
-	return &PromoService{lookup: lookup}
+// StackingPolicy returns the policy for orders submitting several coupons.
+func (s *PromoService) StackingPolicy() domain.StackingPolicy {
+	return s.rules.Stacking
+}
+
+// ReloadCodes re-reads the valid codes file without a restart.
+func (s *PromoService) ReloadCodes() error {
+	r, ok := s.coupons.(codeReloader)
+	if !ok {
+		return ErrReloadUnsupported
+	}
+	return r.Reload()
+}
+
+func (s *PromoService) CodesStatus() (helpers.CouponLookupStatus, error) {
+	r, ok := s.coupons.(codeReloader)
+	if !ok {
+		return helpers.CouponLookupStatus{}, ErrReloadUnsupported
+	}
+	return r.Status(), nil
+}
+
+// Lookup returns the coupon for code together with its discount rule, or the
+// reason the code is not valid right now.
+func (s *PromoService) Lookup(ctx context.Context, code string) (*domain.Coupon, domain.CouponRejection, error) {
+	stored, reason, err := s.coupons.LookupCoupon(ctx, code)
+	if err != nil {
+		return nil, "", err
+	}
+	if reason != "" {
+		return nil, reason, nil
+	}
+
+	now := s.now()
+	if reason := stored.Validity.Check(now); reason != "" {
+		return nil, reason, nil
+	}
+	rule := s.ruleFor(stored)
+	if !rule.InHours(now) {
+		return nil, domain.CouponOutsideHours, nil
+	}
+	return &domain.Coupon{Code: code, Rule: rule}, "", nil
 }
 
-func (s *PromoService) ValidateCoupon(code string) bool {
-	return s.lookup.IsValid(code)
+// ruleFor returns the rule stored with c, or its rule from the rules file.
+func (s *PromoService) ruleFor(c domain.CouponCode) domain.CouponRule {
+	if c.Rule != nil {
+		return *c.Rule
+	}
+	return s.rules.Rule(c.Code)
 }
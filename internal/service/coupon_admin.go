@@ -0,0 +1,250 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
+	"github.com/Sanjaiy/foodieapp/internal/store"
+)
+
+const (
+	DefaultCouponPageSize = 50
+	MaxCouponPageSize     = 500
+)
+
+var (
+	// ErrCouponAdminUnsupported is returned by the coupon administration
+	// methods when the coupon store cannot be changed, e.g. the file store.
+	ErrCouponAdminUnsupported = errors.New("coupon store does not support changing codes")
+	ErrCouponNotFound         = errors.New("coupon not found")
+	ErrCouponExists           = errors.New("coupon already exists")
+	ErrInvalidCoupon          = errors.New("invalid coupon")
+)
+
+// AdminCoupon is a stored code together with its rule and its Status at the
+// time of the request.
+type AdminCoupon struct {
+	domain.CouponCode
+	Status string
+	Rule   domain.CouponRule
+}
+
+type ListCouponsParams struct {
+	Source   domain.CouponSource
+	Disabled *bool
+	Cursor   string
+	Limit    int
+}
+
+type CouponPage struct {
+	Coupons    []AdminCoupon
+	NextCursor string
+}
+
+// CreateCouponInput adds Code. Rule is optional: without it the code uses
+// its rule from the rules file, or the default rule.
+type CreateCouponInput struct {
+	Code     string
+	StartsAt *time.Time
+	EndsAt   *time.Time
+	Rule     *domain.CouponRule
+}
+
+// CouponUpload counts the distinct codes of an upload and how many of them
+// were added or had their validity changed.
+type CouponUpload struct {
+	Codes   int
+	Added   int64
+	Updated int64
+}
+
+func (s *PromoService) admin() (store.CouponAdminStore, error) {
+	a, ok := s.coupons.(store.CouponAdminStore)
+	if !ok {
+		return nil, ErrCouponAdminUnsupported
+	}
+	return a, nil
+}
+
+func (s *PromoService) adminCoupon(c domain.CouponCode) AdminCoupon {
+	return AdminCoupon{CouponCode: c, Status: c.Status(s.now()), Rule: s.ruleFor(c)}
+}
+
+func (s *PromoService) ListCoupons(ctx context.Context, params ListCouponsParams) (*CouponPage, error) {
+	a, err := s.admin()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = DefaultCouponPageSize
+	}
+	if limit > MaxCouponPageSize {
+		limit = MaxCouponPageSize
+	}
+
+	filter := store.CouponCodeFilter{
+		Source:   params.Source,
+		Disabled: params.Disabled,
+		Limit:    limit + 1,
+	}
+	if params.Cursor != "" {
+		after, err := base64.RawURLEncoding.DecodeString(params.Cursor)
+		if err != nil || len(after) == 0 {
+			return nil, ErrInvalidCursor
+		}
+		filter.AfterCode = string(after)
+	}
+
+	codes, err := a.ListCouponCodes(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &CouponPage{}
+	if len(codes) > limit {
+		codes = codes[:limit]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(codes[limit-1].Code))
+	}
+	page.Coupons = make([]AdminCoupon, len(codes))
+	for i, c := range codes {
+		page.Coupons[i] = s.adminCoupon(c)
+	}
+	return page, nil
+}
+
+func (s *PromoService) GetCoupon(ctx context.Context, code string) (*AdminCoupon, error) {
+	a, err := s.admin()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := a.GetCouponCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrCouponNotFound
+	}
+
+	coupon := s.adminCoupon(*c)
+	return &coupon, nil
+}
+
+func (s *PromoService) CreateCoupon(ctx context.Context, input CreateCouponInput) (*AdminCoupon, error) {
+	a, err := s.admin()
+	if err != nil {
+		return nil, err
+	}
+
+	code := store.NewCouponCode{Code: strings.TrimSpace(input.Code)}
+	if code.Code == "" {
+		return nil, fmt.Errorf("%w: code is required", ErrInvalidCoupon)
+	}
+	if input.StartsAt != nil {
+		code.Validity.StartsAt = input.StartsAt.UTC().Truncate(time.Second)
+	}
+	if input.EndsAt != nil {
+		code.Validity.EndsAt = input.EndsAt.UTC().Truncate(time.Second)
+	}
+	if v := code.Validity; !v.StartsAt.IsZero() && !v.EndsAt.IsZero() && !v.StartsAt.Before(v.EndsAt) {
+		return nil, fmt.Errorf("%w: startsAt must be before endsAt", ErrInvalidCoupon)
+	}
+	if input.Rule != nil {
+		if err := input.Rule.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: rule: %v", ErrInvalidCoupon, err)
+		}
+		code.Rule = input.Rule
+	}
+
+	c, err := a.CreateCouponCode(ctx, code)
+	switch {
+	case errors.Is(err, store.ErrCouponCodeExists):
+		return nil, ErrCouponExists
+	case errors.Is(err, store.ErrInvalidCouponCode):
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCoupon, err)
+	case err != nil:
+		return nil, err
+	}
+
+	coupon := s.adminCoupon(*c)
+	return &coupon, nil
+}
+
+// SetCouponDisabled switches a code off or back on. Orders and quotes see
+// the change at once.
+func (s *PromoService) SetCouponDisabled(ctx context.Context, code string, disabled bool) (*AdminCoupon, error) {
+	a, err := s.admin()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := a.SetCouponCodeDisabled(ctx, code, disabled)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrCouponNotFound
+	}
+
+	coupon := s.adminCoupon(*c)
+	return &coupon, nil
+}
+
+// UploadCoupons merges a code list in the preprocessor's text format into
+// the stored codes: one code per line, optionally followed by ",start,end".
+// Blank lines are skipped and repeated lines count once. Nothing is stored
+// unless every line is valid.
+func (s *PromoService) UploadCoupons(ctx context.Context, r io.Reader) (*CouponUpload, error) {
+	a, err := s.admin()
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []store.NewCouponCode
+	seen := make(map[string]domain.CouponValidity)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		code, validity, err := helpers.ParseCouponLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidCoupon, n, err)
+		}
+		if prev, ok := seen[code]; ok {
+			if !prev.Equal(validity) {
+				return nil, fmt.Errorf("%w: line %d: %s is listed with different validity periods", ErrInvalidCoupon, n, code)
+			}
+			continue
+		}
+		seen[code] = validity
+		codes = append(codes, store.NewCouponCode{Code: code, Validity: validity})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading upload: %w", err)
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("%w: upload contains no codes", ErrInvalidCoupon)
+	}
+
+	res, err := a.MergeCouponCodes(ctx, codes)
+	if errors.Is(err, store.ErrInvalidCouponCode) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCoupon, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CouponUpload{Codes: len(codes), Added: res.Added, Updated: res.Updated}, nil
+}
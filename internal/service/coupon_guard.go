@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/store"
+)
+
+const (
+	DefaultLockoutReportDays = 7
+	DefaultLockoutPageSize   = 100
+	MaxLockoutPageSize       = 1000
+)
+
+var ErrLockoutsUnsupported = errors.New("coupon lockouts are not recorded")
+
+// CouponClient identifies who submitted a coupon code. Failures are tracked
+// per IP address; a client with no IP is not tracked. There is no per-key
+// counter because every customer shares the same API key, and locking it
+// out would lock out every customer.
+type CouponClient struct {
+	IP string
+}
+
+// CouponLockedError is returned while a client is locked out of coupon
+// lookups.
+type CouponLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CouponLockedError) Error() string {
+	return fmt.Sprintf("too many rejected coupon codes, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// CouponGuardConfig configures brute-force protection. A client that
+// submits MaxFailures rejected codes within Window is locked out for
+// Lockout; every further lockout doubles, up to MaxLockout. A client that
+// stays clear of lockouts for MaxLockout starts over at Lockout. A
+// MaxFailures of zero disables lockouts. Clients whose IP address falls in
+// Allowlist are never counted or locked out.
+type CouponGuardConfig struct {
+	MaxFailures int
+	Window      time.Duration
+	Lockout     time.Duration
+	MaxLockout  time.Duration
+	Allowlist   []netip.Prefix
+}
+
+// CouponGuard tracks failed coupon lookups per IP address.
+// State is kept in memory, per API process; lockouts are also written to
+// the audit store.
+type CouponGuard struct {
+	cfg   CouponGuardConfig
+	audit store.LockoutStore
+
+	mu        sync.Mutex
+	attempts  map[guardSubject]*attempts
+	lastPrune time.Time
+}
+
+type guardSubject struct {
+	kind domain.LockoutKind
+	id   string
+}
+
+type attempts struct {
+	failures    int
+	windowStart time.Time
+	strikes     int
+	lockedUntil time.Time
+}
+
+// NewCouponGuard records lockouts in audit, which may be nil.
+func NewCouponGuard(cfg CouponGuardConfig, audit store.LockoutStore) *CouponGuard {
+	return &CouponGuard{
+		cfg:      cfg,
+		audit:    audit,
+		attempts: make(map[guardSubject]*attempts),
+	}
+}
+
+// subjects returns the counters that apply to c, none if c has no IP or is
+// allowlisted.
+func (g *CouponGuard) subjects(c CouponClient) []guardSubject {
+	if c.IP == "" || g.allowed(c.IP) {
+		return nil
+	}
+	return []guardSubject{{domain.LockoutIP, c.IP}}
+}
+
+func (g *CouponGuard) allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range g.cfg.Allowlist {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// countsAsFailure reports whether a rejection from Lookup counts towards a
+// lockout. Every one does: if expired, disabled or not yet valid codes went
+// uncounted, a guesser could keep probing to tell issued codes apart.
+func countsAsFailure(reason domain.CouponRejection) bool {
+	switch reason {
+	case domain.CouponUnknownCode, domain.CouponWrongLength,
+		domain.CouponExpired, domain.CouponDisabled,
+		domain.CouponNotYetValid, domain.CouponOutsideHours:
+		return true
+	}
+	return false
+}
+
+// check returns how long client remains locked out, or zero.
+func (g *CouponGuard) check(client CouponClient, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var wait time.Duration
+	for _, subj := range g.subjects(client) {
+		if a := g.attempts[subj]; a != nil && a.lockedUntil.After(now) {
+			wait = max(wait, a.lockedUntil.Sub(now))
+		}
+	}
+	return wait
+}
+
+// fail counts a rejected code submitted by client and returns the lockouts
+// it started.
+func (g *CouponGuard) fail(client CouponClient, now time.Time) []domain.CouponLockout {
+	if g.cfg.MaxFailures <= 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prune(now)
+
+	var started []domain.CouponLockout
+	for _, subj := range g.subjects(client) {
+		a := g.attempts[subj]
+		if a == nil {
+			a = &attempts{}
+			g.attempts[subj] = a
+		}
+		if now.Sub(a.windowStart) >= g.cfg.Window {
+			a.failures = 0
+			a.windowStart = now
+		}
+		a.failures++
+		if a.failures < g.cfg.MaxFailures {
+			continue
+		}
+
+		if !a.lockedUntil.IsZero() && now.Sub(a.lockedUntil) >= g.cfg.MaxLockout {
+			a.strikes = 0
+		}
+		a.strikes++
+		a.lockedUntil = now.Add(g.lockout(a.strikes))
+		started = append(started, domain.CouponLockout{
+			Kind:        subj.kind,
+			Subject:     subj.id,
+			Failures:    a.failures,
+			Strike:      a.strikes,
+			LockedAt:    now,
+			LockedUntil: a.lockedUntil,
+		})
+		a.failures = 0
+		a.windowStart = a.lockedUntil
+	}
+	return started
+}
+
+// lockout returns the duration of the strike-th consecutive lockout.
+func (g *CouponGuard) lockout(strike int) time.Duration {
+	d := g.cfg.Lockout
+	for i := 1; i < strike && d < g.cfg.MaxLockout; i++ {
+		d *= 2
+	}
+	return min(d, g.cfg.MaxLockout)
+}
+
+// prune forgets clients with no recent failures whose strikes have expired.
+// It runs at most once per Window, with g.mu held.
+func (g *CouponGuard) prune(now time.Time) {
+	if now.Sub(g.lastPrune) < g.cfg.Window {
+		return
+	}
+	g.lastPrune = now
+	for subj, a := range g.attempts {
+		if now.Sub(a.windowStart) >= g.cfg.Window && now.Sub(a.lockedUntil) >= g.cfg.MaxLockout {
+			delete(g.attempts, subj)
+		}
+	}
+}
+
+// record writes a lockout to the log and the audit store. A failure to
+// store it is logged but does not fail the request that caused it.
+func (g *CouponGuard) record(ctx context.Context, l domain.CouponLockout) {
+	log.Printf("AUDIT: coupon lookups locked for %s %s until %s after %d rejected codes (strike %d)",
+		l.Kind, l.Subject, l.LockedUntil.UTC().Format(time.RFC3339), l.Failures, l.Strike)
+	if g.audit == nil {
+		return
+	}
+	if err := g.audit.RecordCouponLockout(context.WithoutCancel(ctx), l); err != nil {
+		log.Printf("ERROR: recording coupon lockout: %v", err)
+	}
+}
+
+// LookupFrom is Lookup for a code submitted by client. While client is
+// locked out it fails with a *CouponLockedError without looking the code
+// up; rejected codes count towards the next lockout.
+func (s *PromoService) LookupFrom(ctx context.Context, client CouponClient, code string) (*domain.Coupon, domain.CouponRejection, error) {
+	if s.guard == nil {
+		return s.Lookup(ctx, code)
+	}
+	if wait := s.guard.check(client, s.now()); wait > 0 {
+		return nil, "", &CouponLockedError{RetryAfter: wait}
+	}
+
+	coupon, reason, err := s.Lookup(ctx, code)
+	if err == nil && countsAsFailure(reason) {
+		for _, l := range s.guard.fail(client, s.now()) {
+			s.guard.record(ctx, l)
+		}
+	}
+	return coupon, reason, err
+}
+
+type LockoutReportParams struct {
+	From    *time.Time
+	To      *time.Time
+	Subject string
+	Limit   int
+}
+
+type LockoutReport struct {
+	From     time.Time
+	To       time.Time
+	Lockouts []domain.CouponLockout
+}
+
+// LockoutReport lists the lockouts that started in [From, To), newest
+// first. To defaults to now and From to DefaultLockoutReportDays before To.
+// Subject limits it to one IP address.
+func (s *PromoService) LockoutReport(ctx context.Context, params LockoutReportParams) (*LockoutReport, error) {
+	if s.guard == nil || s.guard.audit == nil {
+		return nil, ErrLockoutsUnsupported
+	}
+
+	report := &LockoutReport{To: s.now()}
+	if params.To != nil {
+		report.To = *params.To
+	}
+	report.From = report.To.AddDate(0, 0, -DefaultLockoutReportDays)
+	if params.From != nil {
+		report.From = *params.From
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = DefaultLockoutPageSize
+	}
+	limit = min(limit, MaxLockoutPageSize)
+
+	lockouts, err := s.guard.audit.ListCouponLockouts(ctx, store.LockoutFilter{
+		From:    report.From,
+		To:      report.To,
+		Subject: params.Subject,
+		Limit:   limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Lockouts = lockouts
+	return report, nil
+}
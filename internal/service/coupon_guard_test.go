@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
+	"github.com/Sanjaiy/foodieapp/internal/store"
+)
+
+// fakeLockouts records lockouts in memory.
+type fakeLockouts struct {
+	recorded []domain.CouponLockout
+}
+
+func (f *fakeLockouts) RecordCouponLockout(ctx context.Context, l domain.CouponLockout) error {
+	f.recorded = append(f.recorded, l)
+	return nil
+}
+
+func (f *fakeLockouts) ListCouponLockouts(ctx context.Context, filter store.LockoutFilter) ([]domain.CouponLockout, error) {
+	return f.recorded, nil
+}
+
+func TestCouponGuardLockout(t *testing.T) {
+	now := mustTime(t, "2025-03-01T00:00:00Z")
+	audit := &fakeLockouts{}
+	guard := NewCouponGuard(CouponGuardConfig{
+		MaxFailures: 3,
+		Window:      time.Minute,
+		Lockout:     10 * time.Second,
+		MaxLockout:  30 * time.Second,
+	}, audit)
+	rules := &helpers.CouponRules{Default: helpers.DefaultCouponRule}
+	coupons := fakeCoupons{"VALIDONE": {}, "EXPIRED": {EndsAt: now.Add(-time.Hour)}}
+	promo := NewPromoService(coupons, rules, guard, func() time.Time { return now })
+
+	ctx := context.Background()
+	client := CouponClient{IP: "192.0.2.1"}
+	lookup := func(c CouponClient, code string) error {
+		_, _, err := promo.LookupFrom(ctx, c, code)
+		return err
+	}
+
+	// Valid codes never count towards a lockout.
+	for range 5 {
+		if err := lookup(client, "VALIDONE"); err != nil {
+			t.Fatalf("valid code: %v", err)
+		}
+	}
+
+	// Rejected codes count whatever the reason, expired ones included.
+	for i, code := range []string{"GUESSED", "EXPIRED", "GUESSED"} {
+		if err := lookup(client, code); err != nil {
+			t.Fatalf("failure %d: %v", i+1, err)
+		}
+	}
+	var locked *CouponLockedError
+	if err := lookup(client, "VALIDONE"); !errors.As(err, &locked) {
+		t.Fatalf("expected CouponLockedError after 3 failures, got %v", err)
+	}
+	if locked.RetryAfter != 10*time.Second {
+		t.Errorf("RetryAfter = %s, want 10s", locked.RetryAfter)
+	}
+
+	if err := lookup(CouponClient{IP: "192.0.2.2"}, "VALIDONE"); err != nil {
+		t.Errorf("expected another client to be unaffected, got %v", err)
+	}
+
+	if len(audit.recorded) != 1 {
+		t.Fatalf("expected 1 audit record, got %+v", audit.recorded)
+	}
+	l := audit.recorded[0]
+	if l.Kind != domain.LockoutIP || l.Subject != "192.0.2.1" || l.Failures != 3 || l.Strike != 1 || !l.LockedUntil.Equal(now.Add(10*time.Second)) {
+		t.Errorf("unexpected lockout %+v", l)
+	}
+
+	// Repeated lockouts double, up to MaxLockout.
+	for _, want := range []time.Duration{20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		now = now.Add(locked.RetryAfter)
+		for range 3 {
+			lookup(CouponClient{IP: "192.0.2.1"}, "GUESSED")
+		}
+		if err := lookup(CouponClient{IP: "192.0.2.1"}, "VALIDONE"); !errors.As(err, &locked) {
+			t.Fatalf("expected another lockout, got %v", err)
+		}
+		if locked.RetryAfter != want {
+			t.Errorf("RetryAfter = %s, want %s", locked.RetryAfter, want)
+		}
+	}
+
+	// A client that stays clear of lockouts for MaxLockout starts over.
+	now = now.Add(locked.RetryAfter + 30*time.Second)
+	for range 3 {
+		lookup(CouponClient{IP: "192.0.2.1"}, "GUESSED")
+	}
+	if err := lookup(CouponClient{IP: "192.0.2.1"}, "VALIDONE"); !errors.As(err, &locked) || locked.RetryAfter != 10*time.Second {
+		t.Errorf("expected a fresh 10s lockout, got %v", err)
+	}
+}
+
+func TestCouponGuardWindow(t *testing.T) {
+	now := mustTime(t, "2025-03-01T00:00:00Z")
+	guard := NewCouponGuard(CouponGuardConfig{
+		MaxFailures: 3,
+		Window:      time.Minute,
+		Lockout:     10 * time.Second,
+		MaxLockout:  time.Minute,
+	}, nil)
+	rules := &helpers.CouponRules{Default: helpers.DefaultCouponRule}
+	promo := NewPromoService(fakeCoupons{}, rules, guard, func() time.Time { return now })
+	client := CouponClient{IP: "192.0.2.1"}
+
+	// Failures spread over more than one window never add up to a lockout.
+	for range 10 {
+		if _, _, err := promo.LookupFrom(context.Background(), client, "GUESSED"); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(31 * time.Second)
+	}
+}
+
+func TestCouponGuardAllowlist(t *testing.T) {
+	now := mustTime(t, "2025-03-01T00:00:00Z")
+	guard := NewCouponGuard(CouponGuardConfig{
+		MaxFailures: 3,
+		Window:      time.Minute,
+		Lockout:     10 * time.Second,
+		MaxLockout:  time.Minute,
+		Allowlist:   []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	}, nil)
+	rules := &helpers.CouponRules{Default: helpers.DefaultCouponRule}
+	promo := NewPromoService(fakeCoupons{}, rules, guard, func() time.Time { return now })
+
+	for _, ip := range []string{"10.1.2.3", "::ffff:10.1.2.3"} {
+		for range 10 {
+			if _, _, err := promo.LookupFrom(context.Background(), CouponClient{IP: ip}, "GUESSED"); err != nil {
+				t.Fatalf("allowlisted %s: %v", ip, err)
+			}
+		}
+	}
+
+	for range 3 {
+		promo.LookupFrom(context.Background(), CouponClient{IP: "192.0.2.1"}, "GUESSED")
+	}
+	var locked *CouponLockedError
+	if _, _, err := promo.LookupFrom(context.Background(), CouponClient{IP: "192.0.2.1"}, "GUESSED"); !errors.As(err, &locked) {
+		t.Errorf("expected an address outside the allowlist to be locked out, got %v", err)
+	}
+}
+
+func TestLockoutReportUnsupported(t *testing.T) {
+	rules := &helpers.CouponRules{Default: helpers.DefaultCouponRule}
+	promo := NewPromoService(fakeCoupons{}, rules, nil, time.Now)
+	if _, err := promo.LockoutReport(context.Background(), LockoutReportParams{}); !errors.Is(err, ErrLockoutsUnsupported) {
+		t.Errorf("expected ErrLockoutsUnsupported, got %v", err)
+	}
+}
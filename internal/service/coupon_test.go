@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
+	"github.com/Sanjaiy/foodieapp/internal/store"
+)
+
+// fakeCoupons lists codes with their validity periods.
+type fakeCoupons map[string]domain.CouponValidity
+
+func (f fakeCoupons) LookupCoupon(ctx context.Context, code string) (domain.CouponCode, domain.CouponRejection, error) {
+	v, ok := f[code]
+	if !ok {
+		return domain.CouponCode{}, domain.CouponUnknownCode, nil
+	}
+	return domain.CouponCode{Code: code, Validity: v}, "", nil
+}
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestPromoLookupValidityBoundaries(t *testing.T) {
+	start := mustTime(t, "2025-03-01T00:00:00Z")
+	end := mustTime(t, "2025-04-01T00:00:00Z")
+	coupons := fakeCoupons{
+		"WINDOWED": {StartsAt: start, EndsAt: end},
+		"OPENEND":  {StartsAt: start},
+		"FOREVER":  {},
+	}
+	rules := &helpers.CouponRules{Default: helpers.DefaultCouponRule}
+
+	tests := []struct {
+		code string
+		now  time.Time
+		want domain.CouponRejection
+	}{
+		{"WINDOWED", start.Add(-time.Second), domain.CouponNotYetValid},
+		{"WINDOWED", start, ""},
+		{"WINDOWED", end.Add(-time.Second), ""},
+		{"WINDOWED", end, domain.CouponExpired},
+		{"OPENEND", start.AddDate(10, 0, 0), ""},
+		{"OPENEND", start.Add(-time.Second), domain.CouponNotYetValid},
+		{"FOREVER", time.Time{}, ""},
+		{"UNLISTED", start, domain.CouponUnknownCode},
+	}
+	for _, tt := range tests {
+		promo := NewPromoService(coupons, rules, nil, func() time.Time { return tt.now })
+		coupon, reason, err := promo.Lookup(context.Background(), tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason != tt.want {
+			t.Errorf("%s at %s: expected %q, got %q", tt.code, tt.now, tt.want, reason)
+		}
+		if (coupon != nil) != (tt.want == "") {
+			t.Errorf("%s at %s: expected coupon only when valid, got %+v", tt.code, tt.now, coupon)
+		}
+	}
+}
+
+func TestPromoLookupHours(t *testing.T) {
+	rules := &helpers.CouponRules{
+		Default: helpers.DefaultCouponRule,
+		Coupons: map[string]domain.CouponRule{
+			"HAPPYHR1": {
+				Type: domain.CouponRulePercentage, PercentOff: 20,
+				Hours:    []domain.CouponHours{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, From: "17:00", To: "19:00"}},
+				TimeZone: "Europe/Berlin",
+			},
+			"LATENITE": {
+				Type: domain.CouponRulePercentage, PercentOff: 15,
+				Hours: []domain.CouponHours{{Days: []string{"fri"}, From: "22:00", To: "02:00"}},
+			},
+		},
+	}
+	for code, rule := range rules.Coupons {
+		if err := rule.Validate(); err != nil {
+			t.Fatalf("%s: %v", code, err)
+		}
+	}
+	coupons := fakeCoupons{"HAPPYHR1": {}, "LATENITE": {}}
+
+	tests := []struct {
+		code string
+		now  string
+		want domain.CouponRejection
+	}{
+		// Friday 2025-03-07; Berlin is UTC+1 in March before DST.
+		{"HAPPYHR1", "2025-03-07T15:59:59Z", domain.CouponOutsideHours},
+		{"HAPPYHR1", "2025-03-07T16:00:00Z", ""},
+		{"HAPPYHR1", "2025-03-07T17:59:59Z", ""},
+		{"HAPPYHR1", "2025-03-07T18:00:00Z", domain.CouponOutsideHours},
+		{"HAPPYHR1", "2025-03-08T16:30:00Z", domain.CouponOutsideHours}, // Saturday
+		// Friday night into Saturday morning, UTC.
+		{"LATENITE", "2025-03-07T21:59:59Z", domain.CouponOutsideHours},
+		{"LATENITE", "2025-03-07T22:00:00Z", ""},
+		{"LATENITE", "2025-03-08T01:59:59Z", ""},
+		{"LATENITE", "2025-03-08T02:00:00Z", domain.CouponOutsideHours},
+		{"LATENITE", "2025-03-08T22:30:00Z", domain.CouponOutsideHours}, // Saturday night
+		{"LATENITE", "2025-03-07T01:00:00Z", domain.CouponOutsideHours}, // Thursday night
+	}
+	for _, tt := range tests {
+		now := mustTime(t, tt.now)
+		promo := NewPromoService(coupons, rules, nil, func() time.Time { return now })
+		_, reason, err := promo.Lookup(context.Background(), tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason != tt.want {
+			t.Errorf("%s at %s: expected %q, got %q", tt.code, tt.now, tt.want, reason)
+		}
+	}
+}
+
+// fakeAdminCoupons records merged codes; every code is new.
+type fakeAdminCoupons struct {
+	fakeCoupons
+	merged []store.NewCouponCode
+}
+
+func (f *fakeAdminCoupons) GetCouponCode(ctx context.Context, code string) (*domain.CouponCode, error) {
+	return nil, nil
+}
+
+func (f *fakeAdminCoupons) ListCouponCodes(ctx context.Context, filter store.CouponCodeFilter) ([]domain.CouponCode, error) {
+	return nil, nil
+}
+
+func (f *fakeAdminCoupons) CreateCouponCode(ctx context.Context, code store.NewCouponCode) (*domain.CouponCode, error) {
+	return &domain.CouponCode{Code: code.Code, Source: domain.CouponSourceAdmin, Validity: code.Validity, Rule: code.Rule}, nil
+}
+
+func (f *fakeAdminCoupons) SetCouponCodeDisabled(ctx context.Context, code string, disabled bool) (*domain.CouponCode, error) {
+	return nil, nil
+}
+
+func (f *fakeAdminCoupons) MergeCouponCodes(ctx context.Context, codes []store.NewCouponCode) (store.CouponMergeResult, error) {
+	f.merged = codes
+	return store.CouponMergeResult{Added: int64(len(codes))}, nil
+}
+
+func TestPromoUploadCoupons(t *testing.T) {
+	rules := &helpers.CouponRules{Default: helpers.DefaultCouponRule}
+	now := func() time.Time { return mustTime(t, "2025-03-01T00:00:00Z") }
+
+	admin := &fakeAdminCoupons{}
+	promo := NewPromoService(admin, rules, nil, now)
+	upload, err := promo.UploadCoupons(context.Background(), strings.NewReader(
+		"AAAAAAAA\r\n\nBBBBBBBB,2025-01-01,\nAAAAAAAA\nBBBBBBBB,2025-01-01T00:00:00Z,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Codes != 2 || upload.Added != 2 || len(admin.merged) != 2 {
+		t.Fatalf("expected two distinct codes, got %+v (%+v)", upload, admin.merged)
+	}
+	if b := admin.merged[1]; b.Code != "BBBBBBBB" || !b.Validity.StartsAt.Equal(mustTime(t, "2025-01-01T00:00:00Z")) {
+		t.Errorf("unexpected validity for BBBBBBBB: %+v", b)
+	}
+
+	for _, body := range []string{
+		"AAAAAAAA\nBBBBBBBB,tomorrow,\n",
+		"AAAAAAAA,2025-01-01,\nAAAAAAAA,2025-02-01,\n",
+		"\n\n",
+	} {
+		admin.merged = nil
+		if _, err := promo.UploadCoupons(context.Background(), strings.NewReader(body)); !errors.Is(err, ErrInvalidCoupon) {
+			t.Errorf("%q: expected ErrInvalidCoupon, got %v", body, err)
+		}
+		if admin.merged != nil {
+			t.Errorf("%q: expected nothing to be stored", body)
+		}
+	}
+
+	fileOnly := NewPromoService(fakeCoupons{}, rules, nil, now)
+	if _, err := fileOnly.UploadCoupons(context.Background(), strings.NewReader("AAAAAAAA\n")); !errors.Is(err, ErrCouponAdminUnsupported) {
+		t.Errorf("expected ErrCouponAdminUnsupported, got %v", err)
+	}
+	if _, err := fileOnly.CreateCoupon(context.Background(), CreateCouponInput{Code: "AAAAAAAA"}); !errors.Is(err, ErrCouponAdminUnsupported) {
+		t.Errorf("expected ErrCouponAdminUnsupported, got %v", err)
+	}
+}
+
+func TestPromoCreateCouponValidity(t *testing.T) {
+	rules := &helpers.CouponRules{Default: helpers.DefaultCouponRule}
+	now := mustTime(t, "2025-03-01T00:00:00Z")
+	promo := NewPromoService(&fakeAdminCoupons{}, rules, nil, func() time.Time { return now })
+
+	start, end := now.Add(time.Hour), now
+	if _, err := promo.CreateCoupon(context.Background(), CreateCouponInput{Code: "AAAAAAAA", StartsAt: &start, EndsAt: &end}); !errors.Is(err, ErrInvalidCoupon) {
+		t.Errorf("expected ErrInvalidCoupon for inverted period, got %v", err)
+	}
+
+	coupon, err := promo.CreateCoupon(context.Background(), CreateCouponInput{Code: "AAAAAAAA", StartsAt: &start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coupon.Status != string(domain.CouponNotYetValid) {
+		t.Errorf("expected not_yet_valid, got %q", coupon.Status)
+	}
+}
+
+// storedRuleCoupons lists codes that carry their own rule.
+type storedRuleCoupons map[string]domain.CouponRule
+
+func (f storedRuleCoupons) LookupCoupon(ctx context.Context, code string) (domain.CouponCode, domain.CouponRejection, error) {
+	rule, ok := f[code]
+	if !ok {
+		return domain.CouponCode{}, domain.CouponUnknownCode, nil
+	}
+	return domain.CouponCode{Code: code, Rule: &rule}, "", nil
+}
+
+func TestPromoStoredRule(t *testing.T) {
+	fixed := domain.CouponRule{Type: domain.CouponRuleFixed, AmountOff: 500}
+	rules := &helpers.CouponRules{
+		Default: helpers.DefaultCouponRule,
+		Coupons: map[string]domain.CouponRule{"AAAAAAAA": {Type: domain.CouponRulePercentage, PercentOff: 50}},
+	}
+	now := func() time.Time { return mustTime(t, "2025-03-01T00:00:00Z") }
+
+	promo := NewPromoService(storedRuleCoupons{"AAAAAAAA": fixed}, rules, nil, now)
+	coupon, _, err := promo.Lookup(context.Background(), "AAAAAAAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coupon == nil || coupon.Rule.Type != fixed.Type || coupon.Rule.AmountOff != fixed.AmountOff {
+		t.Errorf("expected the stored rule to win over the rules file, got %+v", coupon)
+	}
+
+	admin := NewPromoService(&fakeAdminCoupons{}, rules, nil, now)
+	created, err := admin.CreateCoupon(context.Background(), CreateCouponInput{Code: "BBBBBBBB", Rule: &fixed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Rule.Type != fixed.Type || created.Rule.AmountOff != fixed.AmountOff {
+		t.Errorf("expected the created coupon to report its rule, got %+v", created.Rule)
+	}
+
+	bad := domain.CouponRule{Type: domain.CouponRulePercentage, PercentOff: 150}
+	if _, err := admin.CreateCoupon(context.Background(), CreateCouponInput{Code: "CCCCCCCC", Rule: &bad}); !errors.Is(err, ErrInvalidCoupon) {
+		t.Errorf("expected ErrInvalidCoupon for an invalid rule, got %v", err)
+	}
+}
@@ -2,29 +2,211 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 
 	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/pricing"
 	"github.com/Sanjaiy/foodieapp/internal/store"
 )
 
-const discountPercent = 10.0
+const (
+	DefaultOrderPageSize = 20
+	MaxOrderPageSize     = 100
+)
+
+const maxIdempotencyKeyLength = 255
+
+// MaxCouponCodes is the most coupon codes one order may submit.
+const MaxCouponCodes = 10
+
+// MaxItemQuantity is the largest quantity one order item may have. Order
+// items store it as a 32-bit integer.
+const MaxItemQuantity = 1000
+
+var (
+	ErrInvalidCursor     = errors.New("invalid cursor")
+	ErrOrderNotFound     = errors.New("order not found")
+	ErrInvalidStatus     = errors.New("unknown order status")
+	ErrInvalidTransition = errors.New("illegal status transition")
+
+	ErrInvalidIdempotencyKey = errors.New("Idempotency-Key must be 1-255 printable ASCII characters")
+	ErrIdempotencyMismatch   = errors.New("Idempotency-Key was already used with a different request body")
+
+	ErrCouponCodesConflict = errors.New("couponCode and couponCodes cannot be used together")
+	ErrTooManyCoupons      = fmt.Errorf("at most %d coupon codes can be used", MaxCouponCodes)
+
+	ErrQuantityTooLarge = fmt.Errorf("quantity must be at most %d", MaxItemQuantity)
+)
+
+type PlaceOrderInput struct {
+	Items []domain.OrderItem
+	// CustomerID identifies the customer for per-customer coupon limits. It
+	// comes from the request body unverified, so those limits are advisory.
+	CustomerID string
+	CouponCode string
+	// CouponCodes submits several coupons instead of CouponCode; the
+	// stacking policy of the coupon rules decides which of them apply.
+	CouponCodes []string
+	// StrictCoupon makes PlaceOrder fail with a CouponRejectedError instead
+	// of placing the order without a coupon that does not apply.
+	StrictCoupon   bool
+	IdempotencyKey string
+	// Client identifies the caller for coupon brute-force protection.
+	Client CouponClient
+}
+
+// Quote is a priced basket that has not been stored as an order. Coupons
+// has one entry per submitted code, in request order; Coupon is the first.
+type Quote struct {
+	Items     []domain.OrderLine
+	Products  []domain.Product
+	Coupon    *domain.OrderCoupon
+	Coupons   []domain.OrderCoupon
+	Subtotal  domain.Money
+	Discounts domain.Money
+	Total     domain.Money
+}
+
+type CouponRejectedError struct {
+	Code   string
+	Reason domain.CouponRejection
+}
+
+func (e *CouponRejectedError) Error() string {
+	return fmt.Sprintf("coupon %s was not applied: %s", e.Code, e.Reason)
+}
+
+type ListOrdersParams struct {
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	CouponCode  string
+	Status      domain.OrderStatus
+	MinTotal    *domain.Money
+	MaxTotal    *domain.Money
+	Cursor      string
+	Limit       int
+}
+
+// DefaultRedemptionReportDays is the period covered by RedemptionReport
+// when no start is given.
+const DefaultRedemptionReportDays = 30
+
+type RedemptionReportParams struct {
+	From       *time.Time
+	To         *time.Time
+	CouponCode string
+}
+
+type RedemptionReport struct {
+	From time.Time
+	To   time.Time
+	Days []domain.CouponRedemptionDay
+}
+
+type OrderPage struct {
+	Orders     []domain.Order
+	NextCursor string
+}
 
 type OrderService struct {
-	store store.OrderStore
-	promo *PromoService
+	store          store.OrderStore
+	promo          *PromoService
+	pricing        *pricing.Engine
+	idempotencyTTL time.Duration
 }
 
-func NewOrderService(s store.OrderStore, promo *PromoService) *OrderService {
+func NewOrderService(s store.OrderStore, promo *PromoService, engine *pricing.Engine, idempotencyTTL time.Duration) *OrderService {
 	return &OrderService{
-		store: s,
-		promo: promo,
+		store:          s,
+		promo:          promo,
+		pricing:        engine,
+		idempotencyTTL: idempotencyTTL,
+	}
+}
+
+// PlaceOrder validates, prices and stores an order. When the input carries an
+// idempotency key that was already used for the same request, the stored
+// order is returned instead and replayed is true.
+func (s *OrderService) PlaceOrder(ctx context.Context, in PlaceOrderInput) (*domain.Order, bool, error) {
+	var idempotency *store.IdempotencyInput
+	if in.IdempotencyKey != "" {
+		if !validIdempotencyKey(in.IdempotencyKey) {
+			return nil, false, ErrInvalidIdempotencyKey
+		}
+
+		idempotency = &store.IdempotencyInput{
+			Key:         in.IdempotencyKey,
+			RequestHash: hashPlaceOrderInput(in),
+			ExpiresAt:   time.Now().Add(s.idempotencyTTL),
+		}
+
+		order, err := s.replayOrder(ctx, idempotency)
+		if err != nil {
+			return nil, false, err
+		}
+		if order != nil {
+			return order, true, nil
+		}
+	}
+
+	order, err := s.placeOrder(ctx, in, idempotency)
+	if errors.Is(err, store.ErrIdempotencyKeyExists) {
+		// Lost a race with a concurrent request using the same key.
+		order, err = s.replayOrder(ctx, idempotency)
+		if err != nil {
+			return nil, false, err
+		}
+		if order == nil {
+			return nil, false, fmt.Errorf("failed to create order")
+		}
+		return order, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return order, false, nil
+}
+
+func (s *OrderService) replayOrder(ctx context.Context, idempotency *store.IdempotencyInput) (*domain.Order, error) {
+	record, err := s.store.GetIdempotencyRecord(ctx, idempotency.Key)
+	if err != nil {
+		log.Printf("ERROR: fetching idempotency key: %v", err)
+		return nil, fmt.Errorf("failed to create order")
+	}
+	if record == nil {
+		return nil, nil
+	}
+	if record.RequestHash != idempotency.RequestHash {
+		return nil, ErrIdempotencyMismatch
 	}
+	return record.Order, nil
 }
 
-func (s *OrderService) PlaceOrder(ctx context.Context, items []domain.OrderItem, couponCode string) (*domain.Order, error) {
+func (s *OrderService) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	return s.store.PurgeExpiredIdempotencyKeys(ctx)
+}
+
+// Quote prices the basket described by in without storing an order. It applies the same validation
+// and coupon rules as PlaceOrder, including StrictCoupon.
+func (s *OrderService) Quote(ctx context.Context, in PlaceOrderInput) (*Quote, error) {
+	return s.quote(ctx, in, nil)
+}
+
+// quote is Quote with the codes in excluded rejected for the given reason
+// without being evaluated.
+func (s *OrderService) quote(ctx context.Context, in PlaceOrderInput, excluded map[string]domain.CouponRejection) (*Quote, error) {
+	items := in.Items
 	if len(items) == 0 {
 		return nil, fmt.Errorf("at least one item is required")
 	}
@@ -36,6 +218,14 @@ func (s *OrderService) PlaceOrder(ctx context.Context, items []domain.OrderItem,
 		if item.Quantity <= 0 {
 			return nil, fmt.Errorf("quantity must be greater than 0")
 		}
+		if item.Quantity > MaxItemQuantity {
+			return nil, ErrQuantityTooLarge
+		}
+	}
+
+	codes, err := in.couponCodes()
+	if err != nil {
+		return nil, err
 	}
 
 	productIDSet := make(map[string]struct{})
@@ -56,36 +246,414 @@ func (s *OrderService) PlaceOrder(ctx context.Context, items []domain.OrderItem,
 		return nil, fmt.Errorf("invalid product specified")
 	}
 
-	priceMap := make(map[string]float64, len(products))
+	productMap := make(map[string]domain.Product, len(products))
 	for _, p := range products {
-		priceMap[p.ID] = p.Price
+		productMap[p.ID] = p
 	}
 
-	var total float64
-	for _, item := range items {
-		total += priceMap[item.ProductID] * float64(item.Quantity)
+	lines := make([]domain.OrderLine, len(items))
+	var subtotal domain.Money
+	for i, item := range items {
+		p := productMap[item.ProductID]
+		lineTotal, err := p.Price.Mul(item.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = domain.OrderLine{
+			ProductID:   item.ProductID,
+			ProductName: p.Name,
+			Quantity:    item.Quantity,
+			UnitPrice:   p.Price,
+			LineTotal:   lineTotal,
+		}
+		subtotal += lines[i].LineTotal
+	}
+
+	quote := &Quote{
+		Items:    lines,
+		Products: products,
+		Subtotal: subtotal,
+	}
+	if len(codes) > 0 {
+		quote.Coupons, err = s.applyCoupons(ctx, codes, in.CustomerID, in.Client, lines, products, excluded)
+		if err != nil {
+			return nil, err
+		}
+		quote.Coupon = &quote.Coupons[0]
+	}
+	for _, c := range quote.Coupons {
+		if !c.Applied && in.StrictCoupon {
+			return nil, &CouponRejectedError{Code: c.Code, Reason: c.Reason}
+		}
+		quote.Discounts += c.Discount
+	}
+	quote.Total = subtotal - quote.Discounts
+	return quote, nil
+}
+
+// couponCodes returns the submitted codes in request order.
+func (in PlaceOrderInput) couponCodes() ([]string, error) {
+	switch {
+	case len(in.CouponCodes) == 0:
+		if in.CouponCode == "" {
+			return nil, nil
+		}
+		return []string{in.CouponCode}, nil
+	case in.CouponCode != "":
+		return nil, ErrCouponCodesConflict
+	case len(in.CouponCodes) > MaxCouponCodes:
+		return nil, ErrTooManyCoupons
+	}
+	return in.CouponCodes, nil
+}
+
+func (s *OrderService) placeOrder(ctx context.Context, in PlaceOrderInput, idempotency *store.IdempotencyInput) (*domain.Order, error) {
+	var excluded map[string]domain.CouponRejection
+	for {
+		quote, err := s.quote(ctx, in, excluded)
+		if err != nil {
+			return nil, err
+		}
+
+		input := store.CreateOrderInput{
+			Items:      quote.Items,
+			CustomerID: in.CustomerID,
+			Coupons:    quote.Coupons,
+			Products:   quote.Products,
+			Total:      quote.Total,
+			Discounts:  quote.Discounts,
+
+			Idempotency: idempotency,
+		}
+		if quote.Coupon != nil {
+			input.CouponCode = quote.Coupon.Code
+		}
+
+		order, err := s.store.CreateOrder(ctx, input)
+		var limit *store.CouponLimitError
+		if errors.As(err, &limit) {
+			if _, seen := excluded[limit.Code]; !seen {
+				// The quote saw room under the limit, but concurrent orders
+				// used it up before this one committed. Treat it like any
+				// other rejection and price the order again without it.
+				reason, _ := exhaustedReason(err)
+				if in.StrictCoupon {
+					return nil, &CouponRejectedError{Code: limit.Code, Reason: reason}
+				}
+				if excluded == nil {
+					excluded = make(map[string]domain.CouponRejection)
+				}
+				excluded[limit.Code] = reason
+				continue
+			}
+		}
+		if err != nil {
+			if errors.Is(err, store.ErrIdempotencyKeyExists) {
+				return nil, err
+			}
+			log.Printf("ERROR: creating order: %v", err)
+			return nil, fmt.Errorf("failed to create order")
+		}
+
+		return order, nil
 	}
-	total = math.Round(total*100) / 100
+}
 
-	var discounts float64
-	if couponCode != "" && s.promo.ValidateCoupon(couponCode) {
-		discounts = math.Round(total*discountPercent) / 100
-		total = math.Round((total-discounts)*100) / 100
+func exhaustedReason(err error) (domain.CouponRejection, bool) {
+	switch {
+	case errors.Is(err, store.ErrCouponExhausted):
+		return domain.CouponUsageExhausted, true
+	case errors.Is(err, store.ErrCouponCustomerExhausted):
+		return domain.CouponCustomerExhausted, true
 	}
+	return "", false
+}
 
-	input := store.CreateOrderInput{
-		Items:      items,
-		CouponCode: couponCode,
-		Products:   products,
-		Total:      total,
-		Discounts:  discounts,
+// applyCoupons evaluates each code against the priced basket and lets the
+// stacking policy choose which of the applicable ones apply together. The
+// result has one entry per code, in request order.
+func (s *OrderService) applyCoupons(ctx context.Context, codes []string, customerID string, client CouponClient, lines []domain.OrderLine, products []domain.Product, excluded map[string]domain.CouponRejection) ([]domain.OrderCoupon, error) {
+	var subtotal domain.Money
+	for _, l := range lines {
+		subtotal += l.LineTotal
 	}
 
-	order, err := s.store.CreateOrder(ctx, input)
+	coupons := make([]domain.OrderCoupon, len(codes))
+	var applicable []int
+	var candidates []pricing.StackCandidate
+	seen := make(map[string]bool, len(codes))
+	for i, code := range codes {
+		if seen[code] {
+			coupons[i] = domain.OrderCoupon{Code: code, Reason: domain.CouponDuplicate}
+			continue
+		}
+		seen[code] = true
+		if reason, ok := excluded[code]; ok {
+			coupons[i] = domain.OrderCoupon{Code: code, Reason: reason}
+			continue
+		}
+
+		c, err := s.applyCoupon(ctx, code, customerID, client, lines, products)
+		if err != nil {
+			return nil, err
+		}
+		coupons[i] = *c
+		if c.Applied {
+			applicable = append(applicable, i)
+			candidates = append(candidates, pricing.StackCandidate{
+				Discount:   c.Discount,
+				Categories: s.pricing.EligibleCategories(*c.Rule, lines, products),
+			})
+		}
+	}
+
+	stacked := make(map[int]bool, len(applicable))
+	var discounts domain.Money
+	for _, k := range s.pricing.Stack(s.promo.StackingPolicy(), candidates) {
+		c := &coupons[applicable[k]]
+		// Stacked coupons never discount more than the basket is worth; one
+		// left with nothing to discount is dropped.
+		discount := min(c.Discount, subtotal-discounts)
+		if discount == 0 && c.Discount > 0 {
+			continue
+		}
+		c.Discount = discount
+		discounts += discount
+		stacked[applicable[k]] = true
+	}
+	for _, i := range applicable {
+		if !stacked[i] {
+			coupons[i] = domain.OrderCoupon{Code: codes[i], Reason: domain.CouponNotStackable}
+		}
+	}
+	return coupons, nil
+}
+
+// applyCoupon evaluates code against the priced basket. The result is never
+// nil unless looking the code up fails; when the coupon does not apply it
+// carries the rejection reason. A client locked out of coupon lookups gets a
+// *CouponLockedError.
+func (s *OrderService) applyCoupon(ctx context.Context, code, customerID string, client CouponClient, lines []domain.OrderLine, products []domain.Product) (*domain.OrderCoupon, error) {
+	result := &domain.OrderCoupon{Code: code}
+
+	coupon, reason, err := s.promo.LookupFrom(ctx, client, code)
+	var locked *CouponLockedError
+	if errors.As(err, &locked) {
+		return nil, err
+	}
 	if err != nil {
-		log.Printf("ERROR: creating order: %v", err)
-		return nil, fmt.Errorf("failed to create order")
+		log.Printf("ERROR: looking up coupon: %v", err)
+		return nil, fmt.Errorf("failed to check coupon")
+	}
+	if reason == "" {
+		reason, err = s.checkRedemptionLimits(ctx, coupon, customerID)
+		if err != nil {
+			log.Printf("ERROR: checking coupon usage: %v", err)
+			return nil, fmt.Errorf("failed to check coupon")
+		}
+	}
+	if reason != "" {
+		result.Reason = reason
+		return result, nil
+	}
+
+	discount, err := s.pricing.Evaluate(coupon.Rule, lines, products)
+	switch {
+	case errors.Is(err, pricing.ErrBelowMinimumBasket):
+		result.Reason = domain.CouponBasketTooSmall
+	case err != nil:
+		result.Reason = domain.CouponNotApplicable
+	default:
+		result.Applied = true
+		result.Rule = &coupon.Rule
+		result.Discount = discount
+	}
+	return result, nil
+}
+
+// checkRedemptionLimits reports whether coupon still has redemptions left.
+// It does not reserve one: CreateOrder claims the redemption atomically, so
+// a quote can still be overtaken by concurrent orders.
+func (s *OrderService) checkRedemptionLimits(ctx context.Context, coupon *domain.Coupon, customerID string) (domain.CouponRejection, error) {
+	rule := coupon.Rule
+	if rule.MaxRedemptionsPerCustomer > 0 && customerID == "" {
+		return domain.CouponCustomerRequired, nil
+	}
+	if rule.MaxRedemptions == 0 && rule.MaxRedemptionsPerCustomer == 0 {
+		return "", nil
+	}
+
+	usage, err := s.store.GetCouponUsage(ctx, coupon.Code, customerID)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case rule.MaxRedemptions > 0 && usage.Redemptions >= rule.MaxRedemptions:
+		return domain.CouponUsageExhausted, nil
+	case rule.MaxRedemptionsPerCustomer > 0 && usage.CustomerRedemptions >= rule.MaxRedemptionsPerCustomer:
+		return domain.CouponCustomerExhausted, nil
+	}
+	return "", nil
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// hashPlaceOrderInput fingerprints the parts of the request that affect the
+// resulting order, so formatting differences in the body do not count as a
+// different request.
+func hashPlaceOrderInput(in PlaceOrderInput) string {
+	b, _ := json.Marshal(struct {
+		Items        []domain.OrderItem `json:"items"`
+		CustomerID   string             `json:"customerId,omitempty"`
+		CouponCode   string             `json:"couponCode"`
+		CouponCodes  []string           `json:"couponCodes,omitempty"`
+		StrictCoupon bool               `json:"strictCoupon,omitempty"`
+	}{in.Items, in.CustomerID, in.CouponCode, in.CouponCodes, in.StrictCoupon})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *OrderService) GetOrder(ctx context.Context, id string) (*domain.Order, error) {
+	return s.store.GetOrder(ctx, id)
+}
+
+func (s *OrderService) ListOrders(ctx context.Context, params ListOrdersParams) (*OrderPage, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = DefaultOrderPageSize
+	}
+	if limit > MaxOrderPageSize {
+		limit = MaxOrderPageSize
+	}
+
+	filter := store.ListOrdersFilter{
+		CreatedFrom: params.CreatedFrom,
+		CreatedTo:   params.CreatedTo,
+		CouponCode:  params.CouponCode,
+		Status:      params.Status,
+		MinTotal:    params.MinTotal,
+		MaxTotal:    params.MaxTotal,
+		Limit:       limit + 1,
+	}
+
+	if params.Cursor != "" {
+		cursor, err := decodeOrderCursor(params.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		filter.After = cursor
 	}
 
-	return order, nil
+	orders, err := s.store.ListOrders(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = encodeOrderCursor(store.OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	return page, nil
+}
+
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, id string, status domain.OrderStatus) (*domain.Order, error) {
+	if !status.Valid() {
+		return nil, ErrInvalidStatus
+	}
+
+	order, err := s.store.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+
+	if !order.Status.CanTransitionTo(status) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, order.Status, status)
+	}
+
+	err = s.store.UpdateOrderStatus(ctx, id, order.Status, status)
+	if err != nil {
+		if errors.Is(err, store.ErrStaleStatus) {
+			return nil, fmt.Errorf("%w: order is no longer %s", ErrInvalidTransition, order.Status)
+		}
+		return nil, err
+	}
+
+	return s.store.GetOrder(ctx, id)
+}
+
+func encodeOrderCursor(c store.OrderCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeOrderCursor(s string) (*store.OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, err
+	}
+
+	return &store.OrderCursor{CreatedAt: t, ID: id}, nil
+}
+
+// RedemptionReport counts coupon redemptions per code and UTC day in
+// [From, To). To defaults to now and From to DefaultRedemptionReportDays
+// before To.
+func (s *OrderService) RedemptionReport(ctx context.Context, params RedemptionReportParams) (*RedemptionReport, error) {
+	report := &RedemptionReport{To: time.Now()}
+	if params.To != nil {
+		report.To = *params.To
+	}
+	report.From = report.To.AddDate(0, 0, -DefaultRedemptionReportDays)
+	if params.From != nil {
+		report.From = *params.From
+	}
+
+	days, err := s.store.CouponRedemptionsByDay(ctx, store.RedemptionReportFilter{
+		From:       report.From,
+		To:         report.To,
+		CouponCode: params.CouponCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Days = days
+	return report, nil
+}
+
+// CouponRedemptions returns how many orders have redeemed code.
+func (s *OrderService) CouponRedemptions(ctx context.Context, code string) (int, error) {
+	usage, err := s.store.GetCouponUsage(ctx, code, "")
+	if err != nil {
+		return 0, err
+	}
+	return usage.Redemptions, nil
 }
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
+	"github.com/Sanjaiy/foodieapp/internal/pricing"
+	"github.com/Sanjaiy/foodieapp/internal/store"
+)
+
+// fakeOrders keeps orders and idempotency records in memory. CreateOrder
+// fails with a CouponLimitError for any applied coupon listed in limits, and
+// when concurrent is set it behaves as if a concurrent request had just
+// stored that order under the same idempotency key.
+type fakeOrders struct {
+	products   map[string]domain.Product
+	limits     map[string]error
+	concurrent *domain.Order
+
+	created []store.CreateOrderInput
+	records map[string]*store.IdempotencyRecord
+}
+
+func (f *fakeOrders) ValidateProducts(ctx context.Context, productIDs []string) ([]domain.Product, error) {
+	var out []domain.Product
+	for _, id := range productIDs {
+		p, ok := f.products[id]
+		if !ok {
+			return nil, nil
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (f *fakeOrders) CreateOrder(ctx context.Context, input store.CreateOrderInput) (*domain.Order, error) {
+	for _, c := range input.Coupons {
+		if err, ok := f.limits[c.Code]; ok && c.Applied {
+			return nil, &store.CouponLimitError{Code: c.Code, Err: err}
+		}
+	}
+	if f.records == nil {
+		f.records = make(map[string]*store.IdempotencyRecord)
+	}
+	if f.concurrent != nil {
+		f.records[input.Idempotency.Key] = &store.IdempotencyRecord{
+			Key:         input.Idempotency.Key,
+			RequestHash: input.Idempotency.RequestHash,
+			Order:       f.concurrent,
+		}
+		return nil, store.ErrIdempotencyKeyExists
+	}
+
+	f.created = append(f.created, input)
+	order := &domain.Order{
+		ID:         fmt.Sprintf("order-%d", len(f.created)),
+		Items:      input.Items,
+		CouponCode: input.CouponCode,
+		Coupons:    input.Coupons,
+		Total:      input.Total,
+		Discounts:  input.Discounts,
+		Products:   input.Products,
+		Status:     domain.OrderStatusPlaced,
+	}
+	if input.Idempotency != nil {
+		f.records[input.Idempotency.Key] = &store.IdempotencyRecord{
+			Key:         input.Idempotency.Key,
+			RequestHash: input.Idempotency.RequestHash,
+			Order:       order,
+			ExpiresAt:   input.Idempotency.ExpiresAt,
+		}
+	}
+	return order, nil
+}
+
+func (f *fakeOrders) GetIdempotencyRecord(ctx context.Context, key string) (*store.IdempotencyRecord, error) {
+	return f.records[key], nil
+}
+
+func (f *fakeOrders) GetCouponUsage(ctx context.Context, code, customerID string) (store.CouponUsage, error) {
+	return store.CouponUsage{}, nil
+}
+
+func (f *fakeOrders) GetOrder(ctx context.Context, id string) (*domain.Order, error) {
+	return nil, nil
+}
+
+func (f *fakeOrders) ListOrders(ctx context.Context, filter store.ListOrdersFilter) ([]domain.Order, error) {
+	return nil, nil
+}
+
+func (f *fakeOrders) UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) error {
+	return nil
+}
+
+func (f *fakeOrders) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeOrders) CouponRedemptionsByDay(ctx context.Context, filter store.RedemptionReportFilter) ([]domain.CouponRedemptionDay, error) {
+	return nil, nil
+}
+
+// newTestOrderService prices a waffle at 10.00 and a cake at 20.00 with the
+// coupons below, stacked by policy:
+//
+//	PCT10    10% off everything
+//	FIXED5   5.00 off
+//	CAKE25   25% off cakes
+//	WAFFLE20 20% off waffles
+func newTestOrderService(policy domain.StackingPolicy) (*OrderService, *fakeOrders) {
+	orders := &fakeOrders{products: map[string]domain.Product{
+		"1": {ID: "1", Name: "Waffle", Price: 1000, Category: "Waffle"},
+		"2": {ID: "2", Name: "Cake", Price: 2000, Category: "Cake"},
+	}}
+	coupons := storedRuleCoupons{
+		"PCT10":    {Type: domain.CouponRulePercentage, PercentOff: 10},
+		"FIXED5":   {Type: domain.CouponRuleFixed, AmountOff: 500},
+		"CAKE25":   {Type: domain.CouponRulePercentage, PercentOff: 25, Categories: []string{"Cake"}},
+		"WAFFLE20": {Type: domain.CouponRulePercentage, PercentOff: 20, Categories: []string{"Waffle"}},
+	}
+	rules := &helpers.CouponRules{Default: helpers.DefaultCouponRule, Stacking: policy}
+	promo := NewPromoService(coupons, rules, nil, time.Now)
+	return NewOrderService(orders, promo, pricing.NewEngine(), time.Hour), orders
+}
+
+var testBasket = []domain.OrderItem{{ProductID: "1", Quantity: 1}, {ProductID: "2", Quantity: 1}}
+
+func TestQuoteStackingPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy domain.StackingPolicy
+		codes  []string
+		want   map[string]domain.Money
+	}{
+		{
+			name:   "exclusive takes the first applicable code",
+			policy: domain.StackingPolicy{Type: domain.StackExclusive},
+			codes:  []string{"UNKNOWN", "PCT10", "FIXED5"},
+			want:   map[string]domain.Money{"PCT10": 300},
+		},
+		{
+			name:  "no policy is exclusive",
+			codes: []string{"FIXED5", "PCT10"},
+			want:  map[string]domain.Money{"FIXED5": 500},
+		},
+		{
+			name:   "best_single takes the largest discount, ties to the first",
+			policy: domain.StackingPolicy{Type: domain.StackBestSingle},
+			codes:  []string{"PCT10", "FIXED5", "CAKE25"},
+			want:   map[string]domain.Money{"FIXED5": 500},
+		},
+		{
+			name:   "stack takes up to maxCoupons largest discounts",
+			policy: domain.StackingPolicy{Type: domain.StackUpTo, MaxCoupons: 2},
+			codes:  []string{"WAFFLE20", "PCT10", "CAKE25", "FIXED5"},
+			want:   map[string]domain.Money{"CAKE25": 500, "FIXED5": 500},
+		},
+		{
+			name:   "stack with room for every code",
+			policy: domain.StackingPolicy{Type: domain.StackUpTo, MaxCoupons: 5},
+			codes:  []string{"WAFFLE20", "PCT10", "CAKE25"},
+			want:   map[string]domain.Money{"WAFFLE20": 200, "PCT10": 300, "CAKE25": 500},
+		},
+		{
+			name:   "by_category skips codes on categories already discounted",
+			policy: domain.StackingPolicy{Type: domain.StackByCategory},
+			codes:  []string{"PCT10", "WAFFLE20", "CAKE25"},
+			want:   map[string]domain.Money{"CAKE25": 500, "WAFFLE20": 200},
+		},
+		{
+			name:   "by_category with maxCoupons",
+			policy: domain.StackingPolicy{Type: domain.StackByCategory, MaxCoupons: 1},
+			codes:  []string{"WAFFLE20", "CAKE25"},
+			want:   map[string]domain.Money{"CAKE25": 500},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newTestOrderService(tt.policy)
+			quote, err := svc.Quote(context.Background(), PlaceOrderInput{Items: testBasket, CouponCodes: tt.codes})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(quote.Coupons) != len(tt.codes) {
+				t.Fatalf("expected %d coupons, got %+v", len(tt.codes), quote.Coupons)
+			}
+
+			var discounts domain.Money
+			for i, c := range quote.Coupons {
+				if c.Code != tt.codes[i] {
+					t.Errorf("coupon %d is %s, want %s", i, c.Code, tt.codes[i])
+				}
+				want, ok := tt.want[c.Code]
+				switch {
+				case ok && (!c.Applied || c.Discount != want):
+					t.Errorf("%s: applied %v with %d off, want %d off", c.Code, c.Applied, c.Discount, want)
+				case !ok && c.Applied:
+					t.Errorf("%s: applied with %d off, want it left out", c.Code, c.Discount)
+				case c.Code == "UNKNOWN" && c.Reason != domain.CouponUnknownCode:
+					t.Errorf("%s: reason %q, want %q", c.Code, c.Reason, domain.CouponUnknownCode)
+				case !ok && c.Code != "UNKNOWN" && c.Reason != domain.CouponNotStackable:
+					t.Errorf("%s: reason %q, want %q", c.Code, c.Reason, domain.CouponNotStackable)
+				}
+				discounts += want
+			}
+			if quote.Discounts != discounts || quote.Total != quote.Subtotal-discounts {
+				t.Errorf("discounts %d, total %d; want %d, %d", quote.Discounts, quote.Total, discounts, quote.Subtotal-discounts)
+			}
+			if quote.Coupon == nil || quote.Coupon.Code != tt.codes[0] {
+				t.Errorf("expected coupon to be the first code, got %+v", quote.Coupon)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderCouponLimitRetry(t *testing.T) {
+	svc, orders := newTestOrderService(domain.StackingPolicy{Type: domain.StackExclusive})
+	orders.limits = map[string]error{"PCT10": store.ErrCouponExhausted}
+
+	// The quote applies PCT10, but the store finds it used up; the order is
+	// priced again without it and the next code applies instead.
+	order, replayed, err := svc.PlaceOrder(context.Background(), PlaceOrderInput{
+		Items:       testBasket,
+		CouponCodes: []string{"PCT10", "FIXED5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed {
+		t.Error("expected a new order")
+	}
+	if len(orders.created) != 1 {
+		t.Fatalf("expected 1 stored order, got %d", len(orders.created))
+	}
+	if c := order.Coupons[0]; c.Applied || c.Reason != domain.CouponUsageExhausted {
+		t.Errorf("PCT10: got %+v, want reason %q", c, domain.CouponUsageExhausted)
+	}
+	if c := order.Coupons[1]; !c.Applied || c.Discount != 500 {
+		t.Errorf("FIXED5: got %+v, want 500 off", c)
+	}
+	if order.Discounts != 500 || order.Total != 2500 {
+		t.Errorf("discounts %d, total %d; want 500, 2500", order.Discounts, order.Total)
+	}
+
+	// With strictCoupon the order fails instead.
+	orders.limits = map[string]error{"PCT10": store.ErrCouponCustomerExhausted}
+	_, _, err = svc.PlaceOrder(context.Background(), PlaceOrderInput{
+		Items:        testBasket,
+		CouponCode:   "PCT10",
+		StrictCoupon: true,
+	})
+	var rejected *CouponRejectedError
+	if !errors.As(err, &rejected) || rejected.Code != "PCT10" || rejected.Reason != domain.CouponCustomerExhausted {
+		t.Errorf("expected PCT10 to be rejected as %q, got %v", domain.CouponCustomerExhausted, err)
+	}
+	if len(orders.created) != 1 {
+		t.Errorf("expected no further orders, got %d", len(orders.created))
+	}
+}
+
+func TestPlaceOrderIdempotentReplay(t *testing.T) {
+	svc, orders := newTestOrderService(domain.StackingPolicy{})
+	ctx := context.Background()
+	in := PlaceOrderInput{Items: testBasket, CouponCode: "PCT10", IdempotencyKey: "order-key"}
+
+	first, replayed, err := svc.PlaceOrder(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed {
+		t.Error("first request: expected a new order")
+	}
+
+	second, replayed, err := svc.PlaceOrder(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replayed || second.ID != first.ID {
+		t.Errorf("second request: got order %s (replayed %v), want a replay of %s", second.ID, replayed, first.ID)
+	}
+	if len(orders.created) != 1 {
+		t.Errorf("expected 1 stored order, got %d", len(orders.created))
+	}
+
+	changed := in
+	changed.CouponCode = "FIXED5"
+	if _, _, err := svc.PlaceOrder(ctx, changed); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Errorf("different body: expected ErrIdempotencyMismatch, got %v", err)
+	}
+
+	if _, _, err := svc.PlaceOrder(ctx, PlaceOrderInput{Items: testBasket, IdempotencyKey: "bad\nkey"}); !errors.Is(err, ErrInvalidIdempotencyKey) {
+		t.Errorf("expected ErrInvalidIdempotencyKey, got %v", err)
+	}
+
+	// A concurrent request that stores its order first is replayed too.
+	orders.concurrent = &domain.Order{ID: "concurrent"}
+	raced, replayed, err := svc.PlaceOrder(ctx, PlaceOrderInput{Items: testBasket, IdempotencyKey: "raced-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replayed || raced.ID != "concurrent" {
+		t.Errorf("lost race: got order %s (replayed %v), want a replay of the concurrent order", raced.ID, replayed)
+	}
+}
+
+func TestQuoteQuantityLimit(t *testing.T) {
+	// Quantities are checked before the store is consulted.
+	svc := NewOrderService(nil, nil, nil, 0)
+	_, err := svc.Quote(context.Background(), PlaceOrderInput{
+		Items: []domain.OrderItem{{ProductID: "1", Quantity: MaxItemQuantity + 1}},
+	})
+	if !errors.Is(err, ErrQuantityTooLarge) {
+		t.Errorf("expected ErrQuantityTooLarge, got %v", err)
+	}
+}
@@ -2,11 +2,73 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/Sanjaiy/foodieapp/internal/domain"
 	"github.com/Sanjaiy/foodieapp/internal/store"
 )
 
+const (
+	DefaultProductPageSize = 100
+	MaxProductPageSize     = 500
+	// MaxProductSearchLength bounds the search term of ListProducts.
+	MaxProductSearchLength = 100
+)
+
+// maxProductPrice is the largest price the NUMERIC(10,2) column holds.
+const maxProductPrice = domain.Money(99999999_99)
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrInvalidProduct  = errors.New("invalid product")
+	ErrUnknownCategory = errors.New("unknown category")
+)
+
+type ListProductsParams struct {
+	Categories []string
+	MinPrice   *domain.Money
+	MaxPrice   *domain.Money
+	Search     string
+	Sort       domain.ProductSort
+	Cursor     string
+	Limit      int
+}
+
+type ProductPage struct {
+	Products   []domain.Product
+	NextCursor string
+}
+
+// ProductInput describes a whole product, for creating or replacing one.
+// Image URLs that are left empty are stored empty.
+type ProductInput struct {
+	Name     string
+	Price    domain.Money
+	Category string
+	Image    domain.ProductImage
+}
+
+// ProductPatch changes the fields of a product that are not nil.
+type ProductPatch struct {
+	Name     *string
+	Price    *domain.Money
+	Category *string
+	Image    ProductImagePatch
+}
+
+type ProductImagePatch struct {
+	Thumbnail *string
+	Mobile    *string
+	Tablet    *string
+	Desktop   *string
+}
+
 type ProductService struct {
 	store store.ProductStore
 }
@@ -17,10 +79,235 @@ func NewProductService(s store.ProductStore) *ProductService {
 	}
 }
 
-func (s *ProductService) ListProducts(ctx context.Context) ([]domain.Product, error) {
-	return s.store.ListProducts(ctx)
+// ListProducts returns a page of the catalog. Without a Limit or a Cursor
+// it returns every match in one page; a Cursor alone gets
+// DefaultProductPageSize. A cursor is only valid with the sort it was
+// returned for.
+func (s *ProductService) ListProducts(ctx context.Context, params ListProductsParams) (*ProductPage, error) {
+	limit := params.Limit
+	if limit <= 0 && params.Cursor != "" {
+		limit = DefaultProductPageSize
+	}
+	limit = min(limit, MaxProductPageSize)
+
+	if len(params.Categories) > 0 {
+		categories, err := s.store.ListCategories(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing categories: %w", err)
+		}
+		for _, c := range params.Categories {
+			if !slices.Contains(categories, c) {
+				return nil, fmt.Errorf("%w %q", ErrUnknownCategory, c)
+			}
+		}
+	}
+
+	filter := store.ProductFilter{
+		Categories: params.Categories,
+		MinPrice:   params.MinPrice,
+		MaxPrice:   params.MaxPrice,
+		Search:     params.Search,
+		Sort:       params.Sort,
+	}
+	if limit > 0 {
+		filter.Limit = limit + 1
+	}
+	if params.Cursor != "" {
+		cursor, err := decodeProductCursor(params.Cursor, params.Sort)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		filter.After = cursor
+	}
+
+	products, err := s.store.ListProducts(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ProductPage{Products: products}
+	if limit > 0 && len(products) > limit {
+		page.Products = products[:limit]
+		last := page.Products[limit-1]
+		page.NextCursor = encodeProductCursor(params.Sort, store.ProductCursor{ID: last.ID, Name: last.Name, Price: last.Price})
+	}
+	return page, nil
 }
 
 func (s *ProductService) GetProduct(ctx context.Context, id string) (*domain.Product, error) {
 	return s.store.GetProduct(ctx, id)
 }
+
+func (s *ProductService) CreateProduct(ctx context.Context, in ProductInput) (*domain.Product, error) {
+	update, err := s.validate(ctx, in.update())
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store.CreateProduct(ctx, store.NewProduct{
+		Name:     *update.Name,
+		Price:    in.Price,
+		Category: *update.Category,
+		Image:    in.Image,
+	})
+}
+
+// ReplaceProduct overwrites every field of a product.
+func (s *ProductService) ReplaceProduct(ctx context.Context, id string, in ProductInput) (*domain.Product, error) {
+	return s.updateProduct(ctx, id, in.update())
+}
+
+// PatchProduct changes the fields of a product that patch sets.
+func (s *ProductService) PatchProduct(ctx context.Context, id string, patch ProductPatch) (*domain.Product, error) {
+	return s.updateProduct(ctx, id, store.ProductUpdate{
+		Name:     patch.Name,
+		Price:    patch.Price,
+		Category: patch.Category,
+		Image: store.ProductImageUpdate{
+			Thumbnail: patch.Image.Thumbnail,
+			Mobile:    patch.Image.Mobile,
+			Tablet:    patch.Image.Tablet,
+			Desktop:   patch.Image.Desktop,
+		},
+	})
+}
+
+func (s *ProductService) updateProduct(ctx context.Context, id string, update store.ProductUpdate) (*domain.Product, error) {
+	update, err := s.validate(ctx, update)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := s.store.UpdateProduct(ctx, id, update)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrProductNotFound
+	}
+	return p, nil
+}
+
+// DeleteProduct removes a product from the catalog. Orders that already
+// include it keep showing it.
+func (s *ProductService) DeleteProduct(ctx context.Context, id string) error {
+	deleted, err := s.store.DeleteProduct(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
+// update turns in into an update that sets every field.
+func (in ProductInput) update() store.ProductUpdate {
+	return store.ProductUpdate{
+		Name:     &in.Name,
+		Price:    &in.Price,
+		Category: &in.Category,
+		Image: store.ProductImageUpdate{
+			Thumbnail: &in.Image.Thumbnail,
+			Mobile:    &in.Image.Mobile,
+			Tablet:    &in.Image.Tablet,
+			Desktop:   &in.Image.Desktop,
+		},
+	}
+}
+
+// validate checks the fields update sets and returns it with the name and
+// category trimmed.
+func (s *ProductService) validate(ctx context.Context, update store.ProductUpdate) (store.ProductUpdate, error) {
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return update, fmt.Errorf("%w: name is required", ErrInvalidProduct)
+		}
+		update.Name = &name
+	}
+	if update.Price != nil && (*update.Price <= 0 || *update.Price > maxProductPrice) {
+		return update, fmt.Errorf("%w: price must be greater than 0 and at most %s", ErrInvalidProduct, maxProductPrice)
+	}
+
+	for _, img := range []struct {
+		field string
+		url   *string
+	}{
+		{"image.thumbnail", update.Image.Thumbnail},
+		{"image.mobile", update.Image.Mobile},
+		{"image.tablet", update.Image.Tablet},
+		{"image.desktop", update.Image.Desktop},
+	} {
+		if img.url != nil && *img.url != "" && !validImageURL(*img.url) {
+			return update, fmt.Errorf("%w: %s must be an absolute http or https URL", ErrInvalidProduct, img.field)
+		}
+	}
+
+	if update.Category != nil {
+		category := strings.TrimSpace(*update.Category)
+		if category == "" {
+			return update, fmt.Errorf("%w: category is required", ErrInvalidProduct)
+		}
+		categories, err := s.store.ListCategories(ctx)
+		if err != nil {
+			return update, fmt.Errorf("listing categories: %w", err)
+		}
+		if !slices.Contains(categories, category) {
+			return update, fmt.Errorf("%w: unknown category %q, must be one of %s", ErrInvalidProduct, category, strings.Join(categories, ", "))
+		}
+		update.Category = &category
+	}
+	return update, nil
+}
+
+func validImageURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// productCursor is the JSON form of a store.ProductCursor. It keeps only
+// the sort key in use, and the sort itself so the cursor cannot be used to
+// continue a listing in another order.
+type productCursor struct {
+	Sort  domain.ProductSort `json:"s,omitempty"`
+	ID    string             `json:"i"`
+	Name  string             `json:"n,omitempty"`
+	Price *domain.Money      `json:"p,omitempty"`
+}
+
+func encodeProductCursor(sort domain.ProductSort, c store.ProductCursor) string {
+	pc := productCursor{Sort: sort, ID: c.ID}
+	switch sort {
+	case domain.ProductSortName, domain.ProductSortNameDesc:
+		pc.Name = c.Name
+	case domain.ProductSortPrice, domain.ProductSortPriceDesc:
+		pc.Price = &c.Price
+	}
+	raw, _ := json.Marshal(pc)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeProductCursor(s string, sort domain.ProductSort) (*store.ProductCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var pc productCursor
+	if err := json.Unmarshal(raw, &pc); err != nil {
+		return nil, err
+	}
+	if pc.Sort != sort || pc.ID == "" {
+		return nil, fmt.Errorf("cursor is for another sort")
+	}
+	if (sort == domain.ProductSortPrice || sort == domain.ProductSortPriceDesc) && pc.Price == nil {
+		return nil, fmt.Errorf("cursor has no price")
+	}
+
+	c := &store.ProductCursor{ID: pc.ID, Name: pc.Name}
+	if pc.Price != nil {
+		c.Price = *pc.Price
+	}
+	return c, nil
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/store"
+)
+
+// fakeProducts keeps a catalog in memory.
+type fakeProducts struct {
+	products map[string]domain.Product
+	updates  []store.ProductUpdate
+	filters  []store.ProductFilter
+}
+
+func (f *fakeProducts) ListProducts(ctx context.Context, filter store.ProductFilter) ([]domain.Product, error) {
+	f.filters = append(f.filters, filter)
+	var out []domain.Product
+	for _, id := range []string{"1", "2", "3"} {
+		if p, ok := f.products[id]; ok && (filter.Limit == 0 || len(out) < filter.Limit) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeProducts) GetProduct(ctx context.Context, id string) (*domain.Product, error) {
+	if p, ok := f.products[id]; ok {
+		return &p, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeProducts) ListCategories(ctx context.Context) ([]string, error) {
+	return []string{"Cake", "Pie"}, nil
+}
+
+func (f *fakeProducts) CreateProduct(ctx context.Context, p store.NewProduct) (*domain.Product, error) {
+	created := domain.Product{ID: "10", Name: p.Name, Price: p.Price, Category: p.Category, Image: &p.Image}
+	f.products[created.ID] = created
+	return &created, nil
+}
+
+func (f *fakeProducts) UpdateProduct(ctx context.Context, id string, u store.ProductUpdate) (*domain.Product, error) {
+	f.updates = append(f.updates, u)
+	p, ok := f.products[id]
+	if !ok {
+		return nil, nil
+	}
+	if u.Name != nil {
+		p.Name = *u.Name
+	}
+	if u.Price != nil {
+		p.Price = *u.Price
+	}
+	f.products[id] = p
+	return &p, nil
+}
+
+func (f *fakeProducts) DeleteProduct(ctx context.Context, id string) (bool, error) {
+	_, ok := f.products[id]
+	delete(f.products, id)
+	return ok, nil
+}
+
+func TestCreateProductValidation(t *testing.T) {
+	valid := ProductInput{Name: "Carrot Cake", Price: 550, Category: "Cake"}
+	tests := []struct {
+		name   string
+		modify func(*ProductInput)
+	}{
+		{"blank name", func(in *ProductInput) { in.Name = "  " }},
+		{"zero price", func(in *ProductInput) { in.Price = 0 }},
+		{"negative price", func(in *ProductInput) { in.Price = -100 }},
+		{"price too large", func(in *ProductInput) { in.Price = maxProductPrice + 1 }},
+		{"missing category", func(in *ProductInput) { in.Category = "" }},
+		{"unknown category", func(in *ProductInput) { in.Category = "Soup" }},
+		{"relative image", func(in *ProductInput) { in.Image.Thumbnail = "/images/cake.jpg" }},
+		{"image scheme", func(in *ProductInput) { in.Image.Desktop = "ftp://example.com/cake.jpg" }},
+		{"image without host", func(in *ProductInput) { in.Image.Mobile = "https://" }},
+	}
+	for _, tt := range tests {
+		svc := NewProductService(&fakeProducts{products: map[string]domain.Product{}})
+		in := valid
+		tt.modify(&in)
+		if _, err := svc.CreateProduct(context.Background(), in); !errors.Is(err, ErrInvalidProduct) {
+			t.Errorf("%s: expected ErrInvalidProduct, got %v", tt.name, err)
+		}
+	}
+
+	svc := NewProductService(&fakeProducts{products: map[string]domain.Product{}})
+	in := valid
+	in.Name = "  Carrot Cake "
+	in.Category = " Cake"
+	in.Image.Thumbnail = "https://example.com/cake.jpg"
+	p, err := svc.CreateProduct(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Carrot Cake" || p.Category != "Cake" {
+		t.Errorf("expected trimmed name and category, got %+v", p)
+	}
+}
+
+func TestPatchProduct(t *testing.T) {
+	products := &fakeProducts{products: map[string]domain.Product{
+		"1": {ID: "1", Name: "Waffle", Price: 650, Category: "Cake"},
+	}}
+	svc := NewProductService(products)
+	ctx := context.Background()
+
+	price := domain.Money(700)
+	p, err := svc.PatchProduct(ctx, "1", ProductPatch{Price: &price})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Price != 700 || p.Name != "Waffle" {
+		t.Errorf("unexpected patched product %+v", p)
+	}
+	if u := products.updates[0]; u.Name != nil || u.Category != nil || u.Image.Thumbnail != nil {
+		t.Errorf("expected only the price to be set, got %+v", u)
+	}
+
+	blank := ""
+	if _, err := svc.PatchProduct(ctx, "1", ProductPatch{Name: &blank}); !errors.Is(err, ErrInvalidProduct) {
+		t.Errorf("expected ErrInvalidProduct for blank name, got %v", err)
+	}
+	if _, err := svc.PatchProduct(ctx, "99", ProductPatch{Price: &price}); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("expected ErrProductNotFound, got %v", err)
+	}
+
+	if err := svc.DeleteProduct(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteProduct(ctx, "1"); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("expected ErrProductNotFound for a deleted product, got %v", err)
+	}
+}
+
+func TestListProductsPaging(t *testing.T) {
+	products := &fakeProducts{products: map[string]domain.Product{
+		"1": {ID: "1", Name: "Waffle", Price: 650, Category: "Cake"},
+		"2": {ID: "2", Name: "Brûlée", Price: 700, Category: "Pie"},
+		"3": {ID: "3", Name: "Macaron", Price: 800, Category: "Cake"},
+	}}
+	svc := NewProductService(products)
+	ctx := context.Background()
+
+	page, err := svc.ListProducts(ctx, ListProductsParams{Sort: domain.ProductSortPrice, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Products) != 2 || page.NextCursor == "" {
+		t.Fatalf("expected 2 products and a cursor, got %+v", page)
+	}
+	if f := products.filters[0]; f.Limit != 3 || f.After != nil {
+		t.Errorf("expected one extra product to be requested, got %+v", f)
+	}
+
+	if _, err := svc.ListProducts(ctx, ListProductsParams{Sort: domain.ProductSortPrice, Cursor: page.NextCursor}); err != nil {
+		t.Fatal(err)
+	}
+	after := products.filters[1].After
+	if after == nil || after.ID != "2" || after.Price != 700 {
+		t.Errorf("expected the cursor to resume after product 2, got %+v", after)
+	}
+	if f := products.filters[1]; f.Limit != DefaultProductPageSize+1 {
+		t.Errorf("expected the default page size, got %d", f.Limit)
+	}
+
+	for _, params := range []ListProductsParams{
+		{Sort: domain.ProductSortName, Cursor: page.NextCursor},
+		{Cursor: page.NextCursor},
+		{Cursor: "not a cursor"},
+	} {
+		if _, err := svc.ListProducts(ctx, params); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expected ErrInvalidCursor for %+v, got %v", params, err)
+		}
+	}
+
+	if _, err := svc.ListProducts(ctx, ListProductsParams{Categories: []string{"Cake", "Soup"}}); !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("expected ErrUnknownCategory, got %v", err)
+	}
+
+	page, err = svc.ListProducts(ctx, ListProductsParams{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Products) != 3 || page.NextCursor != "" {
+		t.Errorf("expected a single complete page, got %+v", page)
+	}
+
+	// Without a limit or cursor nothing is cut off.
+	page, err = svc.ListProducts(ctx, ListProductsParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Products) != 3 || page.NextCursor != "" {
+		t.Errorf("expected every product, got %+v", page)
+	}
+	if f := products.filters[len(products.filters)-1]; f.Limit != 0 {
+		t.Errorf("expected no limit, got %d", f.Limit)
+	}
+}
@@ -0,0 +1,31 @@
+package mmap
+
+import (
+	"context"
+
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
+)
+
+// CouponStore serves codes from the file written by cmd/preprocess through
+// a memory-mapped helpers.CouponLookup. It is local to each API process.
+type CouponStore struct {
+	lookup *helpers.CouponLookup
+}
+
+func NewCouponStore(lookup *helpers.CouponLookup) *CouponStore {
+	return &CouponStore{lookup: lookup}
+}
+
+func (s *CouponStore) LookupCoupon(ctx context.Context, code string) (domain.CouponCode, domain.CouponRejection, error) {
+	validity, reason := s.lookup.Lookup(code)
+	return domain.CouponCode{Code: code, Validity: validity}, reason, nil
+}
+
+func (s *CouponStore) Reload() error {
+	return s.lookup.Reload()
+}
+
+func (s *CouponStore) Status() helpers.CouponLookupStatus {
+	return s.lookup.Status()
+}
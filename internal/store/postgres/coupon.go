@@ -0,0 +1,284 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sqlc-dev/pqtype"
+
+	"github.com/Sanjaiy/foodieapp/internal/db"
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/helpers"
+	"github.com/Sanjaiy/foodieapp/internal/store"
+)
+
+// CouponStore serves codes from the coupon_codes table, so every API
+// replica sees the same set. Codes that break rules are rejected without a
+// query, exactly as the file-backed lookup does.
+type CouponStore struct {
+	db    *sql.DB
+	q     *db.Queries
+	rules helpers.CodeRules
+}
+
+func NewCouponStore(dbConn *sql.DB, rules helpers.CodeRules) *CouponStore {
+	return &CouponStore{
+		db:    dbConn,
+		q:     db.New(dbConn),
+		rules: rules,
+	}
+}
+
+func (s *CouponStore) LookupCoupon(ctx context.Context, code string) (domain.CouponCode, domain.CouponRejection, error) {
+	if !s.rules.ValidLength(code) {
+		return domain.CouponCode{}, domain.CouponWrongLength, nil
+	}
+	if !s.rules.Accept(code) {
+		return domain.CouponCode{}, domain.CouponUnknownCode, nil
+	}
+
+	c, err := s.GetCouponCode(ctx, code)
+	if err != nil {
+		return domain.CouponCode{}, "", err
+	}
+	if c == nil {
+		return domain.CouponCode{}, domain.CouponUnknownCode, nil
+	}
+	if c.DisabledAt != nil {
+		return domain.CouponCode{}, domain.CouponDisabled, nil
+	}
+	return *c, "", nil
+}
+
+func (s *CouponStore) GetCouponCode(ctx context.Context, code string) (*domain.CouponCode, error) {
+	row, err := s.q.GetCouponCode(ctx, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetching coupon code: %w", err)
+	}
+	return toCouponCode(row)
+}
+
+func (s *CouponStore) ListCouponCodes(ctx context.Context, filter store.CouponCodeFilter) ([]domain.CouponCode, error) {
+	params := db.ListCouponCodesParams{PageSize: int32(filter.Limit)}
+	if filter.Source != "" {
+		params.Source = sql.NullString{String: string(filter.Source), Valid: true}
+	}
+	if filter.Disabled != nil {
+		params.Disabled = sql.NullBool{Bool: *filter.Disabled, Valid: true}
+	}
+	if filter.AfterCode != "" {
+		params.AfterCode = sql.NullString{String: filter.AfterCode, Valid: true}
+	}
+
+	rows, err := s.q.ListCouponCodes(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("listing coupon codes: %w", err)
+	}
+
+	codes := make([]domain.CouponCode, len(rows))
+	for i, row := range rows {
+		c, err := toCouponCode(row)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = *c
+	}
+	return codes, nil
+}
+
+func (s *CouponStore) CreateCouponCode(ctx context.Context, code store.NewCouponCode) (*domain.CouponCode, error) {
+	if !s.rules.Accept(code.Code) {
+		return nil, fmt.Errorf("%w: %q", store.ErrInvalidCouponCode, code.Code)
+	}
+
+	params := db.CreateCouponCodeParams{
+		Code:      code.Code,
+		StartsAt:  nullTime(code.Validity.StartsAt),
+		ExpiresAt: nullTime(code.Validity.EndsAt),
+	}
+	if code.Rule != nil {
+		rule, err := json.Marshal(code.Rule)
+		if err != nil {
+			return nil, fmt.Errorf("encoding coupon rule: %w", err)
+		}
+		params.Rule = pqtype.NullRawMessage{RawMessage: rule, Valid: true}
+	}
+
+	row, err := s.q.CreateCouponCode(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrCouponCodeExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating coupon code: %w", err)
+	}
+	return toCouponCode(row)
+}
+
+func (s *CouponStore) SetCouponCodeDisabled(ctx context.Context, code string, disabled bool) (*domain.CouponCode, error) {
+	row, err := s.q.SetCouponCodeDisabled(ctx, db.SetCouponCodeDisabledParams{Disabled: disabled, Code: code})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("updating coupon code: %w", err)
+	}
+	return toCouponCode(row)
+}
+
+// MergeCouponCodes stages codes like a load does, but keeps every code that
+// is not listed. New codes are added as admin codes.
+func (s *CouponStore) MergeCouponCodes(ctx context.Context, codes []store.NewCouponCode) (store.CouponMergeResult, error) {
+	for _, c := range codes {
+		if !s.rules.Accept(c.Code) {
+			return store.CouponMergeResult{}, fmt.Errorf("%w: %q", store.ErrInvalidCouponCode, c.Code)
+		}
+	}
+
+	load, err := s.begin(ctx, domain.CouponSourceAdmin, false)
+	if err != nil {
+		return store.CouponMergeResult{}, err
+	}
+	for _, c := range codes {
+		if err := load.WriteValidity(c.Code, c.Validity); err != nil {
+			load.Abort()
+			return store.CouponMergeResult{}, err
+		}
+	}
+	if err := load.Close(); err != nil {
+		return store.CouponMergeResult{}, err
+	}
+	return store.CouponMergeResult{Added: load.Added, Updated: load.Updated}, nil
+}
+
+func toCouponCode(row db.CouponCode) (*domain.CouponCode, error) {
+	c := &domain.CouponCode{
+		Code:   row.Code,
+		Source: domain.CouponSource(row.Source),
+		Validity: domain.CouponValidity{
+			StartsAt: row.StartsAt.Time,
+			EndsAt:   row.ExpiresAt.Time,
+		},
+		CreatedAt: row.CreatedAt,
+	}
+	if row.DisabledAt.Valid {
+		c.DisabledAt = &row.DisabledAt.Time
+	}
+	if row.Rule.Valid {
+		c.Rule = &domain.CouponRule{}
+		if err := json.Unmarshal(row.Rule.RawMessage, c.Rule); err != nil {
+			return nil, fmt.Errorf("decoding rule of coupon %s: %w", row.Code, err)
+		}
+	}
+	return c, nil
+}
+
+// CouponLoad replaces the full set of valid codes in one transaction. Codes
+// are streamed into coupon_codes_staging with COPY; Close then removes codes
+// that are no longer listed, updates the validity of codes that stay and adds
+// new ones. Codes added through the admin API are never removed. Concurrent
+// loads and merges queue on the staging table lock.
+type CouponLoad struct {
+	ctx     context.Context
+	tx      *sql.Tx
+	q       *db.Queries
+	stmt    *sql.Stmt
+	source  domain.CouponSource
+	replace bool
+
+	// Added, Updated and Removed are set by a successful Close.
+	Added   int64
+	Updated int64
+	Removed int64
+}
+
+func (s *CouponStore) BeginLoad(ctx context.Context) (*CouponLoad, error) {
+	return s.begin(ctx, domain.CouponSourcePreprocess, true)
+}
+
+func (s *CouponStore) begin(ctx context.Context, source domain.CouponSource, replace bool) (*CouponLoad, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	qtx := s.q.WithTx(tx)
+	if err := qtx.TruncateCouponCodesStaging(ctx); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("clearing staging table: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("coupon_codes_staging", "code", "starts_at", "expires_at"))
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("starting copy: %w", err)
+	}
+
+	return &CouponLoad{ctx: ctx, tx: tx, q: qtx, stmt: stmt, source: source, replace: replace}, nil
+}
+
+func (l *CouponLoad) Write(code string) error {
+	return l.WriteValidity(code, domain.CouponValidity{})
+}
+
+func (l *CouponLoad) WriteValidity(code string, v domain.CouponValidity) error {
+	_, err := l.stmt.ExecContext(l.ctx, code, nullTime(v.StartsAt), nullTime(v.EndsAt))
+	if err != nil {
+		return fmt.Errorf("copying code: %w", err)
+	}
+	return nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// Close finishes the copy, applies it to coupon_codes and commits.
+func (l *CouponLoad) Close() error {
+	defer l.tx.Rollback()
+
+	if _, err := l.stmt.ExecContext(l.ctx); err != nil {
+		return fmt.Errorf("finishing copy: %w", err)
+	}
+	if err := l.stmt.Close(); err != nil {
+		return fmt.Errorf("finishing copy: %w", err)
+	}
+
+	var removed int64
+	if l.replace {
+		var err error
+		if removed, err = l.q.DeleteUnstagedCouponCodes(l.ctx); err != nil {
+			return fmt.Errorf("removing stale codes: %w", err)
+		}
+	}
+	updated, err := l.q.UpdateStagedCouponCodes(l.ctx)
+	if err != nil {
+		return fmt.Errorf("updating codes: %w", err)
+	}
+	added, err := l.q.InsertStagedCouponCodes(l.ctx, string(l.source))
+	if err != nil {
+		return fmt.Errorf("inserting new codes: %w", err)
+	}
+	if err := l.q.TruncateCouponCodesStaging(l.ctx); err != nil {
+		return fmt.Errorf("clearing staging table: %w", err)
+	}
+
+	if err := l.tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	l.Added, l.Updated, l.Removed = added, updated, removed
+	return nil
+}
+
+// Abort discards the load.
+func (l *CouponLoad) Abort() error {
+	l.stmt.Close()
+	return l.tx.Rollback()
+}
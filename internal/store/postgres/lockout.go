@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Sanjaiy/foodieapp/internal/db"
+	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/store"
+)
+
+// LockoutStore keeps the coupon lockout audit log in coupon_lockouts.
+type LockoutStore struct {
+	q *db.Queries
+}
+
+func NewLockoutStore(dbConn *sql.DB) *LockoutStore {
+	return &LockoutStore{q: db.New(dbConn)}
+}
+
+func (s *LockoutStore) RecordCouponLockout(ctx context.Context, l domain.CouponLockout) error {
+	err := s.q.CreateCouponLockout(ctx, db.CreateCouponLockoutParams{
+		Kind:        string(l.Kind),
+		Subject:     l.Subject,
+		Failures:    int32(l.Failures),
+		Strike:      int32(l.Strike),
+		LockedAt:    l.LockedAt,
+		LockedUntil: l.LockedUntil,
+	})
+	if err != nil {
+		return fmt.Errorf("recording coupon lockout: %w", err)
+	}
+	return nil
+}
+
+func (s *LockoutStore) ListCouponLockouts(ctx context.Context, filter store.LockoutFilter) ([]domain.CouponLockout, error) {
+	params := db.ListCouponLockoutsParams{
+		LockedFrom: filter.From,
+		LockedTo:   filter.To,
+		PageSize:   int32(filter.Limit),
+	}
+	if filter.Subject != "" {
+		params.Subject = sql.NullString{String: filter.Subject, Valid: true}
+	}
+
+	rows, err := s.q.ListCouponLockouts(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("listing coupon lockouts: %w", err)
+	}
+
+	lockouts := make([]domain.CouponLockout, len(rows))
+	for i, row := range rows {
+		lockouts[i] = domain.CouponLockout{
+			Kind:        domain.LockoutKind(row.Kind),
+			Subject:     row.Subject,
+			Failures:    int(row.Failures),
+			Strike:      int(row.Strike),
+			LockedAt:    row.LockedAt,
+			LockedUntil: row.LockedUntil,
+		}
+	}
+	return lockouts, nil
+}
@@ -3,8 +3,14 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"strconv"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sqlc-dev/pqtype"
 
 	"github.com/Sanjaiy/foodieapp/internal/db"
 	"github.com/Sanjaiy/foodieapp/internal/domain"
@@ -32,10 +38,17 @@ func (s *OrderStore) ValidateProducts(ctx context.Context, productIDs []string)
 	if len(rows) != len(productIDs) {
 		return nil, nil
 	}
+	for _, row := range rows {
+		if row.DeletedAt.Valid {
+			return nil, nil
+		}
+	}
 
 	products := make([]domain.Product, len(rows))
 	for i, row := range rows {
-		products[i] = toProduct(row)
+		if products[i], err = toProduct(row); err != nil {
+			return nil, err
+		}
 	}
 
 	return products, nil
@@ -55,37 +68,500 @@ func (s *OrderStore) CreateOrder(ctx context.Context, input store.CreateOrderInp
 		validCouponCode = sql.NullString{String: input.CouponCode, Valid: true}
 	}
 
+	var couponRule pqtype.NullRawMessage
+	var couponRejection sql.NullString
+	if len(input.Coupons) > 0 {
+		couponRule, couponRejection, err = encodeOrderCoupon(input.Coupons[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	orderRow, err := qtx.CreateOrder(ctx, db.CreateOrderParams{
-		CouponCode: validCouponCode,
-		Total:      strconv.FormatFloat(input.Total, 'f', 2, 64),
-		Discounts:  strconv.FormatFloat(input.Discounts, 'f', 2, 64),
+		CouponCode:      validCouponCode,
+		Total:           input.Total.String(),
+		Discounts:       input.Discounts.String(),
+		CouponRule:      couponRule,
+		CouponRejection: couponRejection,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("creating order: %w", err)
 	}
 
+	err = qtx.CreateOrderStatusHistory(ctx, db.CreateOrderStatusHistoryParams{
+		OrderID:  orderRow.ID,
+		ToStatus: orderRow.Status,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("recording order status: %w", err)
+	}
+
 	for _, item := range input.Items {
 		err = qtx.CreateOrderItem(ctx, db.CreateOrderItemParams{
-			OrderID:   orderRow.ID,
-			ProductID: item.ProductID,
-			Quantity:  int32(item.Quantity),
+			OrderID:     orderRow.ID,
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    int32(item.Quantity),
+			UnitPrice:   item.UnitPrice.String(),
+			LineTotal:   item.LineTotal.String(),
 		})
 		if err != nil {
 			return nil, fmt.Errorf("creating order item: %w", err)
 		}
 	}
 
-	if err = tx.Commit(); err != nil {
-		return nil, fmt.Errorf("committing transaction: %w", err)
+	for i, c := range input.Coupons {
+		rule, rejection, err := encodeOrderCoupon(c)
+		if err != nil {
+			return nil, err
+		}
+		err = qtx.CreateOrderCoupon(ctx, db.CreateOrderCouponParams{
+			OrderID:   orderRow.ID,
+			Position:  int32(i),
+			Code:      c.Code,
+			Rule:      rule,
+			Rejection: rejection,
+			Discount:  c.Discount.String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("recording order coupon: %w", err)
+		}
+	}
+
+	// Redeem in code order so that concurrent orders sharing several codes
+	// lock their usage rows in the same order.
+	applied := slices.DeleteFunc(slices.Clone(input.Coupons), func(c domain.OrderCoupon) bool { return !c.Applied })
+	slices.SortFunc(applied, func(a, b domain.OrderCoupon) int { return strings.Compare(a.Code, b.Code) })
+	for _, c := range applied {
+		if err := redeemCoupon(ctx, qtx, orderRow.ID, input.CustomerID, &c); err != nil {
+			return nil, err
+		}
 	}
 
 	order := &domain.Order{
-		ID:        orderRow.ID.String(),
-		Items:     input.Items,
-		Total:     input.Total,
-		Discounts: input.Discounts,
-		Products:  input.Products,
+		ID:         orderRow.ID.String(),
+		Items:      input.Items,
+		CouponCode: input.CouponCode,
+		Total:      input.Total,
+		Discounts:  input.Discounts,
+		Products:   input.Products,
+		Status:     domain.OrderStatus(orderRow.Status),
+		CreatedAt:  orderRow.CreatedAt,
+	}
+	setOrderCoupons(order, input.Coupons)
+
+	if input.Idempotency != nil {
+		response, err := json.Marshal(order)
+		if err != nil {
+			return nil, fmt.Errorf("encoding idempotent response: %w", err)
+		}
+
+		// A concurrent request holding the same key blocks this insert until
+		// it commits, after which the conflict leaves no row to return.
+		_, err = qtx.CreateIdempotencyKey(ctx, db.CreateIdempotencyKeyParams{
+			Key:         input.Idempotency.Key,
+			RequestHash: input.Idempotency.RequestHash,
+			OrderID:     orderRow.ID,
+			Response:    response,
+			ExpiresAt:   input.Idempotency.ExpiresAt,
+		})
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, store.ErrIdempotencyKeyExists
+			}
+			return nil, fmt.Errorf("storing idempotency key: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
 	}
 
 	return order, nil
 }
+
+func (s *OrderStore) GetOrder(ctx context.Context, id string) (*domain.Order, error) {
+	orderID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	orderRow, err := s.q.GetOrder(ctx, orderID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("fetching order: %w", err)
+	}
+
+	itemRows, err := s.q.GetOrderItems(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching order items: %w", err)
+	}
+
+	items := make([]domain.OrderLine, len(itemRows))
+	productIDs := make([]string, 0, len(itemRows))
+	seen := make(map[string]struct{}, len(itemRows))
+	for i, row := range itemRows {
+		if items[i], err = toOrderLine(row); err != nil {
+			return nil, err
+		}
+		if _, ok := seen[row.ProductID]; !ok {
+			seen[row.ProductID] = struct{}{}
+			productIDs = append(productIDs, row.ProductID)
+		}
+	}
+
+	productRows, err := s.q.GetProductsByIDs(ctx, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("fetching products: %w", err)
+	}
+
+	products := make([]domain.Product, len(productRows))
+	for i, row := range productRows {
+		if products[i], err = toProduct(row); err != nil {
+			return nil, err
+		}
+	}
+
+	historyRows, err := s.q.GetOrderStatusHistory(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching order status history: %w", err)
+	}
+
+	history := make([]domain.OrderStatusChange, len(historyRows))
+	for i, row := range historyRows {
+		history[i] = domain.OrderStatusChange{
+			From:      domain.OrderStatus(row.FromStatus.String),
+			To:        domain.OrderStatus(row.ToStatus),
+			ChangedAt: row.ChangedAt,
+		}
+	}
+
+	order, err := toOrder(orderRow)
+	if err != nil {
+		return nil, err
+	}
+	order.Items = items
+	order.Products = products
+	order.StatusHistory = history
+
+	couponRows, err := s.q.GetOrderCoupons(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching order coupons: %w", err)
+	}
+
+	coupons := make([]domain.OrderCoupon, len(couponRows))
+	for i, row := range couponRows {
+		if coupons[i], err = toOrderCoupon(row); err != nil {
+			return nil, err
+		}
+	}
+	setOrderCoupons(&order, coupons)
+
+	return &order, nil
+}
+
+func (s *OrderStore) ListOrders(ctx context.Context, filter store.ListOrdersFilter) ([]domain.Order, error) {
+	params := db.ListOrdersParams{
+		PageSize: int32(filter.Limit),
+	}
+	if filter.CreatedFrom != nil {
+		params.CreatedFrom = sql.NullTime{Time: *filter.CreatedFrom, Valid: true}
+	}
+	if filter.CreatedTo != nil {
+		params.CreatedTo = sql.NullTime{Time: *filter.CreatedTo, Valid: true}
+	}
+	if filter.CouponCode != "" {
+		params.CouponCode = sql.NullString{String: filter.CouponCode, Valid: true}
+	}
+	if filter.Status != "" {
+		params.Status = sql.NullString{String: string(filter.Status), Valid: true}
+	}
+	if filter.MinTotal != nil {
+		params.MinTotal = sql.NullString{String: filter.MinTotal.String(), Valid: true}
+	}
+	if filter.MaxTotal != nil {
+		params.MaxTotal = sql.NullString{String: filter.MaxTotal.String(), Valid: true}
+	}
+	if filter.After != nil {
+		cursorID, err := uuid.Parse(filter.After.ID)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cursor id: %w", err)
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: filter.After.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursorID, Valid: true}
+	}
+
+	rows, err := s.q.ListOrders(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("listing orders: %w", err)
+	}
+
+	orders := make([]domain.Order, len(rows))
+	for i, row := range rows {
+		if orders[i], err = toOrder(row); err != nil {
+			return nil, err
+		}
+	}
+
+	return orders, nil
+}
+
+// setOrderCoupons stores the breakdown on order and makes Coupon describe its
+// first entry. Orders placed before the breakdown was recorded have none and
+// keep the coupon loaded from the order row.
+func setOrderCoupons(order *domain.Order, coupons []domain.OrderCoupon) {
+	if len(coupons) == 0 {
+		return
+	}
+	order.Coupons = coupons
+	order.Coupon = &coupons[0]
+}
+
+func (s *OrderStore) UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) error {
+	orderID, err := uuid.Parse(id)
+	if err != nil {
+		return fmt.Errorf("parsing order id: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	qtx := s.q.WithTx(tx)
+
+	_, err = qtx.UpdateOrderStatus(ctx, db.UpdateOrderStatusParams{
+		ToStatus:   string(to),
+		ID:         orderID,
+		FromStatus: string(from),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return store.ErrStaleStatus
+		}
+		return fmt.Errorf("updating order status: %w", err)
+	}
+
+	err = qtx.CreateOrderStatusHistory(ctx, db.CreateOrderStatusHistoryParams{
+		OrderID:    orderID,
+		FromStatus: sql.NullString{String: string(from), Valid: true},
+		ToStatus:   string(to),
+	})
+	if err != nil {
+		return fmt.Errorf("recording order status: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *OrderStore) GetIdempotencyRecord(ctx context.Context, key string) (*store.IdempotencyRecord, error) {
+	row, err := s.q.GetIdempotencyKey(ctx, key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("fetching idempotency key: %w", err)
+	}
+
+	var order domain.Order
+	if err := json.Unmarshal(row.Response, &order); err != nil {
+		return nil, fmt.Errorf("decoding idempotent response: %w", err)
+	}
+
+	return &store.IdempotencyRecord{
+		Key:         row.Key,
+		RequestHash: row.RequestHash,
+		Order:       &order,
+		ExpiresAt:   row.ExpiresAt,
+	}, nil
+}
+
+func (s *OrderStore) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	n, err := s.q.DeleteExpiredIdempotencyKeys(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("purging idempotency keys: %w", err)
+	}
+	return n, nil
+}
+
+func encodeOrderCoupon(c domain.OrderCoupon) (pqtype.NullRawMessage, sql.NullString, error) {
+	if !c.Applied {
+		return pqtype.NullRawMessage{}, sql.NullString{String: string(c.Reason), Valid: true}, nil
+	}
+	rule, err := json.Marshal(c.Rule)
+	if err != nil {
+		return pqtype.NullRawMessage{}, sql.NullString{}, fmt.Errorf("encoding coupon rule: %w", err)
+	}
+	return pqtype.NullRawMessage{RawMessage: rule, Valid: true}, sql.NullString{}, nil
+}
+
+// redeemCoupon records the redemption in the ledger after claiming it
+// against the code's limits. The global counter is always claimed before the
+// customer's, so concurrent orders lock the rows in the same order.
+func redeemCoupon(ctx context.Context, qtx *db.Queries, orderID uuid.UUID, customerID string, c *domain.OrderCoupon) error {
+	_, err := qtx.ClaimCouponUsage(ctx, db.ClaimCouponUsageParams{
+		Code:           c.Code,
+		MaxRedemptions: redemptionLimit(c.Rule.MaxRedemptions),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &store.CouponLimitError{Code: c.Code, Err: store.ErrCouponExhausted}
+		}
+		return fmt.Errorf("claiming coupon redemption: %w", err)
+	}
+
+	if customerID != "" {
+		_, err = qtx.ClaimCouponCustomerUsage(ctx, db.ClaimCouponCustomerUsageParams{
+			Code:           c.Code,
+			CustomerID:     customerID,
+			MaxRedemptions: redemptionLimit(c.Rule.MaxRedemptionsPerCustomer),
+		})
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return &store.CouponLimitError{Code: c.Code, Err: store.ErrCouponCustomerExhausted}
+			}
+			return fmt.Errorf("claiming customer coupon redemption: %w", err)
+		}
+	}
+
+	err = qtx.CreateCouponRedemption(ctx, db.CreateCouponRedemptionParams{
+		OrderID:    orderID,
+		Code:       c.Code,
+		CustomerID: sql.NullString{String: customerID, Valid: customerID != ""},
+		Discount:   c.Discount.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("recording coupon redemption: %w", err)
+	}
+	return nil
+}
+
+func redemptionLimit(n int) sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(n), Valid: n > 0}
+}
+
+func (s *OrderStore) GetCouponUsage(ctx context.Context, code, customerID string) (store.CouponUsage, error) {
+	row, err := s.q.GetCouponUsage(ctx, db.GetCouponUsageParams{Code: code, CustomerID: customerID})
+	if err != nil {
+		return store.CouponUsage{}, fmt.Errorf("fetching coupon usage: %w", err)
+	}
+	return store.CouponUsage{
+		Redemptions:         int(row.Redemptions),
+		CustomerRedemptions: int(row.CustomerRedemptions),
+	}, nil
+}
+
+func (s *OrderStore) CouponRedemptionsByDay(ctx context.Context, filter store.RedemptionReportFilter) ([]domain.CouponRedemptionDay, error) {
+	params := db.CouponRedemptionsByDayParams{
+		RedeemedFrom: filter.From,
+		RedeemedTo:   filter.To,
+	}
+	if filter.CouponCode != "" {
+		params.Code = sql.NullString{String: filter.CouponCode, Valid: true}
+	}
+
+	rows, err := s.q.CouponRedemptionsByDay(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("fetching coupon redemptions: %w", err)
+	}
+
+	days := make([]domain.CouponRedemptionDay, len(rows))
+	for i, row := range rows {
+		discounts, err := domain.ParseMoney(row.Discounts)
+		if err != nil {
+			return nil, fmt.Errorf("coupon %s discounts: %w", row.Code, err)
+		}
+		days[i] = domain.CouponRedemptionDay{
+			Code:        row.Code,
+			Day:         row.Day.Format(time.DateOnly),
+			Redemptions: int(row.Redemptions),
+			Discounts:   discounts,
+		}
+	}
+	return days, nil
+}
+
+func toOrderLine(row db.GetOrderItemsRow) (domain.OrderLine, error) {
+	unitPrice, err := domain.ParseMoney(row.UnitPrice)
+	if err != nil {
+		return domain.OrderLine{}, fmt.Errorf("order item %s unit price: %w", row.ProductID, err)
+	}
+	lineTotal, err := domain.ParseMoney(row.LineTotal)
+	if err != nil {
+		return domain.OrderLine{}, fmt.Errorf("order item %s line total: %w", row.ProductID, err)
+	}
+	return domain.OrderLine{
+		ProductID:   row.ProductID,
+		ProductName: row.ProductName,
+		Quantity:    int(row.Quantity),
+		UnitPrice:   unitPrice,
+		LineTotal:   lineTotal,
+	}, nil
+}
+
+func toOrderCoupon(row db.OrderCoupon) (domain.OrderCoupon, error) {
+	c := domain.OrderCoupon{Code: row.Code}
+	if !row.Rule.Valid {
+		c.Reason = domain.CouponRejection(row.Rejection.String)
+		return c, nil
+	}
+	var rule domain.CouponRule
+	if err := json.Unmarshal(row.Rule.RawMessage, &rule); err != nil {
+		return c, fmt.Errorf("order %s coupon %s rule: %w", row.OrderID, row.Code, err)
+	}
+	discount, err := domain.ParseMoney(row.Discount)
+	if err != nil {
+		return c, fmt.Errorf("order %s coupon %s discount: %w", row.OrderID, row.Code, err)
+	}
+	c.Applied = true
+	c.Rule = &rule
+	c.Discount = discount
+	return c, nil
+}
+
+func toOrder(row db.Order) (domain.Order, error) {
+	total, err := domain.ParseMoney(row.Total)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("order %s total: %w", row.ID, err)
+	}
+	discounts, err := domain.ParseMoney(row.Discounts)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("order %s discounts: %w", row.ID, err)
+	}
+	var coupon *domain.OrderCoupon
+	switch {
+	case row.CouponRule.Valid:
+		var rule domain.CouponRule
+		if err := json.Unmarshal(row.CouponRule.RawMessage, &rule); err != nil {
+			return domain.Order{}, fmt.Errorf("order %s coupon rule: %w", row.ID, err)
+		}
+		coupon = &domain.OrderCoupon{
+			Code:     row.CouponCode.String,
+			Applied:  true,
+			Rule:     &rule,
+			Discount: discounts,
+		}
+	case row.CouponRejection.Valid:
+		coupon = &domain.OrderCoupon{
+			Code:   row.CouponCode.String,
+			Reason: domain.CouponRejection(row.CouponRejection.String),
+		}
+	}
+
+	return domain.Order{
+		ID:         row.ID.String(),
+		CouponCode: row.CouponCode.String,
+		Coupon:     coupon,
+		Total:      total,
+		Discounts:  discounts,
+		Status:     domain.OrderStatus(row.Status),
+		CreatedAt:  row.CreatedAt,
+	}, nil
+}
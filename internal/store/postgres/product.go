@@ -3,12 +3,18 @@ package postgres
 import (
 	"context"
 	"database/sql"
-	"strconv"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/Sanjaiy/foodieapp/internal/db"
 	"github.com/Sanjaiy/foodieapp/internal/domain"
+	"github.com/Sanjaiy/foodieapp/internal/store"
 )
 
+// likeEscaper quotes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 type ProductStore struct {
 	q *db.Queries
 }
@@ -17,15 +23,39 @@ func NewProductStore(dbConn *sql.DB) *ProductStore {
 	return &ProductStore{q: db.New(dbConn)}
 }
 
-func (s *ProductStore) ListProducts(ctx context.Context) ([]domain.Product, error) {
-	rows, err := s.q.ListProducts(ctx)
+func (s *ProductStore) ListProducts(ctx context.Context, filter store.ProductFilter) ([]domain.Product, error) {
+	params := db.ListProductsParams{
+		Categories: filter.Categories,
+		Sort:       string(filter.Sort),
+	}
+	if filter.Limit > 0 {
+		params.PageSize = sql.NullInt32{Int32: int32(filter.Limit), Valid: true}
+	}
+	if filter.MinPrice != nil {
+		params.MinPrice = sql.NullString{String: filter.MinPrice.String(), Valid: true}
+	}
+	if filter.MaxPrice != nil {
+		params.MaxPrice = sql.NullString{String: filter.MaxPrice.String(), Valid: true}
+	}
+	if filter.Search != "" {
+		params.NamePattern = sql.NullString{String: "%" + likeEscaper.Replace(filter.Search) + "%", Valid: true}
+	}
+	if filter.After != nil {
+		params.CursorID = sql.NullString{String: filter.After.ID, Valid: true}
+		params.CursorName = sql.NullString{String: filter.After.Name, Valid: true}
+		params.CursorPrice = sql.NullString{String: filter.After.Price.String(), Valid: true}
+	}
+
+	rows, err := s.q.ListProducts(ctx, params)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("listing products: %w", err)
 	}
 
 	products := make([]domain.Product, len(rows))
 	for i, row := range rows {
-		products[i] = toProduct(row)
+		if products[i], err = toProduct(row); err != nil {
+			return nil, err
+		}
 	}
 	return products, nil
 }
@@ -38,12 +68,87 @@ func (s *ProductStore) GetProduct(ctx context.Context, id string) (*domain.Produ
 		}
 		return nil, err
 	}
-	p := toProduct(row)
+	p, err := toProduct(row)
+	if err != nil {
+		return nil, err
+	}
 	return &p, nil
 }
 
-func toProduct(row db.Product) domain.Product {
-	price, _ := strconv.ParseFloat(row.Price, 64)
+func (s *ProductStore) ListCategories(ctx context.Context) ([]string, error) {
+	return s.q.ListCategories(ctx)
+}
+
+func (s *ProductStore) CreateProduct(ctx context.Context, p store.NewProduct) (*domain.Product, error) {
+	row, err := s.q.CreateProduct(ctx, db.CreateProductParams{
+		Name:       p.Name,
+		Price:      p.Price.String(),
+		Category:   p.Category,
+		ImgThumb:   p.Image.Thumbnail,
+		ImgMobile:  p.Image.Mobile,
+		ImgTablet:  p.Image.Tablet,
+		ImgDesktop: p.Image.Desktop,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating product: %w", err)
+	}
+	created, err := toProduct(row)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *ProductStore) UpdateProduct(ctx context.Context, id string, u store.ProductUpdate) (*domain.Product, error) {
+	params := db.UpdateProductParams{
+		Name:       nullString(u.Name),
+		Category:   nullString(u.Category),
+		ImgThumb:   nullString(u.Image.Thumbnail),
+		ImgMobile:  nullString(u.Image.Mobile),
+		ImgTablet:  nullString(u.Image.Tablet),
+		ImgDesktop: nullString(u.Image.Desktop),
+		ID:         id,
+	}
+	if u.Price != nil {
+		params.Price = sql.NullString{String: u.Price.String(), Valid: true}
+	}
+
+	row, err := s.q.UpdateProduct(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("updating product: %w", err)
+	}
+	updated, err := toProduct(row)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteProduct hides the product from the catalog. Its row is kept for
+// the orders that refer to it.
+func (s *ProductStore) DeleteProduct(ctx context.Context, id string) (bool, error) {
+	n, err := s.q.DeleteProduct(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("deleting product: %w", err)
+	}
+	return n > 0, nil
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+func toProduct(row db.Product) (domain.Product, error) {
+	price, err := domain.ParseMoney(row.Price)
+	if err != nil {
+		return domain.Product{}, fmt.Errorf("product %s price: %w", row.ID, err)
+	}
 	return domain.Product{
 		ID:       row.ID,
 		Name:     row.Name,
@@ -55,5 +160,5 @@ func toProduct(row db.Product) domain.Product {
 			Tablet:    row.ImgTablet,
 			Desktop:   row.ImgDesktop,
 		},
-	}
+	}, nil
 }
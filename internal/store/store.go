@@ -2,24 +2,230 @@ package store
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Sanjaiy/foodieapp/internal/domain"
 )
 
+// ErrStaleStatus is returned by OrderStore.UpdateOrderStatus when the order is
+// no longer in the expected status, e.g. because another request changed it.
+var ErrStaleStatus = errors.New("order status changed concurrently")
+
+// ErrIdempotencyKeyExists is returned by OrderStore.CreateOrder when another
+// order already holds a live record for the same idempotency key. The order
+// is not created.
+var ErrIdempotencyKeyExists = errors.New("idempotency key already used")
+
+// ErrCouponExhausted and ErrCouponCustomerExhausted are returned by
+// OrderStore.CreateOrder, wrapped in a CouponLimitError, when an applied
+// coupon has reached its global or per-customer redemption limit. The order
+// is not created.
+var (
+	ErrCouponExhausted         = errors.New("coupon redemption limit reached")
+	ErrCouponCustomerExhausted = errors.New("coupon redemption limit reached for customer")
+)
+
+// CouponLimitError names the coupon whose redemption limit stopped an order.
+type CouponLimitError struct {
+	Code string
+	Err  error
+}
+
+func (e *CouponLimitError) Error() string {
+	return fmt.Sprintf("coupon %s: %v", e.Code, e.Err)
+}
+
+func (e *CouponLimitError) Unwrap() error {
+	return e.Err
+}
+
+// CouponStore knows which codes are coupons. LookupCoupon returns a listed
+// code with its validity period, which the caller checks against its clock,
+// and its stored rule, if any. A code that is not listed is reported as a
+// rejection reason; the error is only for failures of the store itself.
+type CouponStore interface {
+	LookupCoupon(ctx context.Context, code string) (domain.CouponCode, domain.CouponRejection, error)
+}
+
+// Errors returned by CouponAdminStore. ErrInvalidCouponCode is wrapped with
+// the offending code.
+var (
+	ErrCouponCodeExists  = errors.New("coupon code already exists")
+	ErrInvalidCouponCode = errors.New("code does not match the coupon code rules")
+)
+
+// NewCouponCode is a code added through the admin API. Rule is optional.
+type NewCouponCode struct {
+	Code     string
+	Validity domain.CouponValidity
+	Rule     *domain.CouponRule
+}
+
+type CouponCodeFilter struct {
+	Source   domain.CouponSource
+	Disabled *bool
+	// AfterCode continues a listing after the last code of the previous page.
+	AfterCode string
+	Limit     int
+}
+
+// CouponMergeResult counts the codes of a merge that were not known yet and
+// the known ones whose validity changed.
+type CouponMergeResult struct {
+	Added   int64
+	Updated int64
+}
+
+// CouponAdminStore is a CouponStore whose codes can be changed while the API
+// runs. GetCouponCode and SetCouponCodeDisabled return nil for an unknown
+// code. MergeCouponCodes adds codes and updates the validity of known ones
+// without touching the rest of the set.
+type CouponAdminStore interface {
+	CouponStore
+	GetCouponCode(ctx context.Context, code string) (*domain.CouponCode, error)
+	ListCouponCodes(ctx context.Context, filter CouponCodeFilter) ([]domain.CouponCode, error)
+	CreateCouponCode(ctx context.Context, code NewCouponCode) (*domain.CouponCode, error)
+	SetCouponCodeDisabled(ctx context.Context, code string, disabled bool) (*domain.CouponCode, error)
+	MergeCouponCodes(ctx context.Context, codes []NewCouponCode) (CouponMergeResult, error)
+}
+
+// ProductStore reads and changes the catalog. GetProduct, UpdateProduct
+// and DeleteProduct treat a deleted product as missing: GetProduct and
+// UpdateProduct return nil and DeleteProduct false.
 type ProductStore interface {
-	ListProducts(ctx context.Context) ([]domain.Product, error)
+	ListProducts(ctx context.Context, filter ProductFilter) ([]domain.Product, error)
 	GetProduct(ctx context.Context, id string) (*domain.Product, error)
+	ListCategories(ctx context.Context) ([]string, error)
+	CreateProduct(ctx context.Context, p NewProduct) (*domain.Product, error)
+	UpdateProduct(ctx context.Context, id string, u ProductUpdate) (*domain.Product, error)
+	DeleteProduct(ctx context.Context, id string) (bool, error)
+}
+
+// ProductCursor is the last product of a page: its ID and the sort key the
+// page was listed by.
+type ProductCursor struct {
+	ID    string
+	Name  string
+	Price domain.Money
 }
 
+// ProductFilter selects products whose name contains Search, ignoring case,
+// and that match every other field that is set.
+// ProductFilter selects products for ProductStore.ListProducts. A Limit of
+// zero lists every match.
+type ProductFilter struct {
+	Categories []string
+	MinPrice   *domain.Money
+	MaxPrice   *domain.Money
+	Search     string
+	Sort       domain.ProductSort
+	After      *ProductCursor
+	Limit      int
+}
+
+// NewProduct is a product to add to the catalog; the store assigns its ID.
+type NewProduct struct {
+	Name     string
+	Price    domain.Money
+	Category string
+	Image    domain.ProductImage
+}
+
+// ProductUpdate changes the fields of a product that are not nil.
+type ProductUpdate struct {
+	Name     *string
+	Price    *domain.Money
+	Category *string
+	Image    ProductImageUpdate
+}
+
+type ProductImageUpdate struct {
+	Thumbnail *string
+	Mobile    *string
+	Tablet    *string
+	Desktop   *string
+}
+
+type IdempotencyInput struct {
+	Key         string
+	RequestHash string
+	ExpiresAt   time.Time
+}
+
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	Order       *domain.Order
+	ExpiresAt   time.Time
+}
+
+// CreateOrderInput.Coupons lists every submitted coupon in request order;
+// the first one is also recorded as the order's CouponCode.
 type CreateOrderInput struct {
-	Items      []domain.OrderItem
+	Items       []domain.OrderLine
+	CustomerID  string
+	CouponCode  string
+	Coupons     []domain.OrderCoupon
+	Products    []domain.Product
+	Total       domain.Money
+	Discounts   domain.Money
+	Idempotency *IdempotencyInput
+}
+
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+type ListOrdersFilter struct {
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	CouponCode  string
+	Status      domain.OrderStatus
+	MinTotal    *domain.Money
+	MaxTotal    *domain.Money
+	After       *OrderCursor
+	Limit       int
+}
+
+// CouponUsage is how often a code has been redeemed, in total and by one
+// customer.
+type CouponUsage struct {
+	Redemptions         int
+	CustomerRedemptions int
+}
+
+type RedemptionReportFilter struct {
+	From       time.Time
+	To         time.Time
 	CouponCode string
-	Products   []domain.Product
-	Total      float64
-	Discounts  float64
+}
+
+type LockoutFilter struct {
+	From    time.Time
+	To      time.Time
+	Subject string
+	Limit   int
+}
+
+// LockoutStore keeps the audit log of coupon lockouts.
+type LockoutStore interface {
+	RecordCouponLockout(ctx context.Context, lockout domain.CouponLockout) error
+	// ListCouponLockouts returns lockouts that started in [From, To), newest
+	// first.
+	ListCouponLockouts(ctx context.Context, filter LockoutFilter) ([]domain.CouponLockout, error)
 }
 
 type OrderStore interface {
 	ValidateProducts(ctx context.Context, productIDs []string) ([]domain.Product, error)
 	CreateOrder(ctx context.Context, input CreateOrderInput) (*domain.Order, error)
+	GetOrder(ctx context.Context, id string) (*domain.Order, error)
+	ListOrders(ctx context.Context, filter ListOrdersFilter) ([]domain.Order, error)
+	UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) error
+	GetIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error)
+	PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+	GetCouponUsage(ctx context.Context, code, customerID string) (CouponUsage, error)
+	CouponRedemptionsByDay(ctx context.Context, filter RedemptionReportFilter) ([]domain.CouponRedemptionDay, error)
 }
@@ -9,15 +9,16 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // coupon hours may name any time zone
 
-	"github.com/pressly/goose/v3"
-
-	"github.com/Sanjaiy/foodieapp/db"
 	"github.com/Sanjaiy/foodieapp/internal/config"
 	"github.com/Sanjaiy/foodieapp/internal/database"
 	"github.com/Sanjaiy/foodieapp/internal/handler"
 	"github.com/Sanjaiy/foodieapp/internal/helpers"
+	"github.com/Sanjaiy/foodieapp/internal/pricing"
 	"github.com/Sanjaiy/foodieapp/internal/service"
+	"github.com/Sanjaiy/foodieapp/internal/store"
+	mmapstore "github.com/Sanjaiy/foodieapp/internal/store/mmap"
 	pgstore "github.com/Sanjaiy/foodieapp/internal/store/postgres"
 )
 
@@ -34,7 +35,7 @@ func main() {
 	}
 	defer dbConn.Close()
 
-	if err := runMigrations(dbConn); err != nil {
+	if err := database.Migrate(dbConn); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
@@ -43,13 +44,38 @@ func main() {
 		validCodesPath = "data/valid_codes.txt"
 	}
 
-	promoLookup, err := helpers.NewCouponLookup(validCodesPath)
+	codeRules, err := helpers.CodeRulesFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load coupon code rules: %v", err)
+	}
+
+	var coupons store.CouponStore
+	switch cfg.CouponStore {
+	case "postgres":
+		coupons = pgstore.NewCouponStore(dbConn, codeRules)
+	default:
+		promoLookup, err := helpers.NewCouponLookup(validCodesPath, codeRules)
+		if err != nil {
+			log.Fatalf("Failed to load promo codes: %v", err)
+		}
+		defer promoLookup.Close()
+		if cfg.CouponReloadInterval > 0 {
+			go promoLookup.Watch(ctx, cfg.CouponReloadInterval)
+		}
+		coupons = mmapstore.NewCouponStore(promoLookup)
+	}
+
+	couponRulesPath := os.Getenv("COUPON_RULES_PATH")
+	if couponRulesPath == "" {
+		couponRulesPath = "data/coupon_rules.json"
+	}
+
+	couponRules, err := helpers.LoadCouponRules(couponRulesPath)
 	if err != nil {
-		log.Fatalf("Failed to load promo codes: %v", err)
+		log.Fatalf("Failed to load coupon rules: %v", err)
 	}
-	defer promoLookup.Close()
 
-	rootHandler := setupApp(dbConn, cfg.APIKey, promoLookup)
+	rootHandler := setupApp(ctx, dbConn, cfg, coupons, couponRules)
 
 	srv := &http.Server{
 		Addr:         ":" + cfg.Port,
@@ -62,26 +88,70 @@ func main() {
 	runServer(srv)
 }
 
-func setupApp(dbConn *sql.DB, apiKey string, promoLookup *helpers.CouponLookup) http.Handler {
-	promoSvc := service.NewPromoService(promoLookup)
+func setupApp(ctx context.Context, dbConn *sql.DB, cfg *config.Config, coupons store.CouponStore, couponRules *helpers.CouponRules) http.Handler {
+	guard := service.NewCouponGuard(service.CouponGuardConfig{
+		MaxFailures: cfg.CouponMaxFailures,
+		Window:      cfg.CouponFailureWindow,
+		Lockout:     cfg.CouponLockout,
+		MaxLockout:  cfg.CouponMaxLockout,
+		Allowlist:   cfg.CouponLockoutAllowlist,
+	}, pgstore.NewLockoutStore(dbConn))
+	promoSvc := service.NewPromoService(coupons, couponRules, guard, time.Now)
+	pricingEngine := pricing.NewEngine()
 
 	productStore := pgstore.NewProductStore(dbConn)
 	orderStore := pgstore.NewOrderStore(dbConn)
 
 	productSvc := service.NewProductService(productStore)
-	orderSvc := service.NewOrderService(orderStore, promoSvc)
+	orderSvc := service.NewOrderService(orderStore, promoSvc, pricingEngine, cfg.IdempotencyTTL)
+	go purgeIdempotencyKeys(ctx, orderSvc, time.Hour)
 
 	productHandler := handler.NewProductHandler(productSvc)
-	orderHandler := handler.NewOrderHandler(orderSvc)
+	orderHandler := handler.NewOrderHandler(orderSvc, cfg.TrustedProxies)
+	adminHandler := handler.NewAdminHandler(promoSvc, orderSvc)
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /api/product", productHandler.ListProducts)
 	mux.HandleFunc("GET /api/product/{productId}", productHandler.GetProduct)
 
-	orderMux := http.NewServeMux()
-	orderMux.HandleFunc("POST /api/order", orderHandler.PlaceOrder)
-	mux.Handle("/api/order", handler.AuthMiddleware(apiKey, orderMux))
+	authMux := http.NewServeMux()
+	authMux.HandleFunc("GET /api/order", orderHandler.ListOrders)
+	authMux.HandleFunc("POST /api/order", orderHandler.PlaceOrder)
+	authMux.HandleFunc("POST /api/order/quote", orderHandler.QuoteOrder)
+	authMux.HandleFunc("GET /api/order/{orderId}", orderHandler.GetOrder)
+	authMux.HandleFunc("POST /api/coupon/validate", orderHandler.QuoteOrder)
+	authed := handler.AuthMiddleware(cfg.APIKey, authMux)
+	mux.Handle("/api/order", authed)
+	mux.Handle("/api/order/", authed)
+	mux.Handle("/api/coupon/", authed)
+
+	// Staff endpoints take their own key, so they stay closed to customers
+	// holding the client key. Without one they answer 503.
+	if cfg.AdminAPIKey == "" {
+		log.Printf("WARNING: ADMIN_API_KEY is not set; admin and menu endpoints are disabled")
+	}
+	staff := func(h http.HandlerFunc) http.Handler {
+		return handler.StaffMiddleware(cfg.AdminAPIKey, h)
+	}
+	mux.Handle("POST /api/product", staff(productHandler.CreateProduct))
+	mux.Handle("PUT /api/product/{productId}", staff(productHandler.ReplaceProduct))
+	mux.Handle("PATCH /api/product/{productId}", staff(productHandler.PatchProduct))
+	mux.Handle("DELETE /api/product/{productId}", staff(productHandler.DeleteProduct))
+	mux.Handle("PATCH /api/order/{orderId}/status", staff(orderHandler.UpdateOrderStatus))
+
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("POST /admin/coupons/reload", adminHandler.ReloadCoupons)
+	adminMux.HandleFunc("GET /admin/coupons/status", adminHandler.CouponStatus)
+	adminMux.HandleFunc("GET /admin/coupons/redemptions", adminHandler.CouponRedemptions)
+	adminMux.HandleFunc("GET /admin/coupons/lockouts", adminHandler.CouponLockouts)
+	adminMux.HandleFunc("GET /admin/coupons", adminHandler.ListCoupons)
+	adminMux.HandleFunc("POST /admin/coupons", adminHandler.CreateCoupon)
+	adminMux.HandleFunc("POST /admin/coupons/bulk", adminHandler.UploadCoupons)
+	adminMux.HandleFunc("GET /admin/coupons/{code}", adminHandler.GetCoupon)
+	adminMux.HandleFunc("POST /admin/coupons/{code}/disable", adminHandler.DisableCoupon)
+	adminMux.HandleFunc("POST /admin/coupons/{code}/enable", adminHandler.EnableCoupon)
+	mux.Handle("/admin/", staff(adminMux.ServeHTTP))
 
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -95,6 +165,27 @@ func setupApp(dbConn *sql.DB, apiKey string, promoLookup *helpers.CouponLookup)
 	return root
 }
 
+func purgeIdempotencyKeys(ctx context.Context, orderSvc *service.OrderService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := orderSvc.PurgeExpiredIdempotencyKeys(ctx)
+			if err != nil {
+				log.Printf("ERROR: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("Purged %d expired idempotency keys", n)
+			}
+		}
+	}
+}
+
 func runServer(srv *http.Server) {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
@@ -117,11 +208,3 @@ func runServer(srv *http.Server) {
 	}
 	log.Println("Server stopped gracefully")
 }
-
-func runMigrations(dbConn *sql.DB) error {
-	goose.SetBaseFS(db.MigrationsFS)
-	if err := goose.SetDialect("postgres"); err != nil {
-		return err
-	}
-	return goose.Up(dbConn, "migrations")
-}